@@ -0,0 +1,330 @@
+package ippresize
+
+import (
+	"bytes"
+	"github.com/anight/go-ippresize/diskcache"
+	"image"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// BatchItem is an image to be processed by Batch with Thumbnail() options
+type BatchItem struct {
+	Reader  io.Reader
+	Options []Option
+}
+
+// BatchResult is the outcome of the item, Index is the position of the item in the input stream
+type BatchResult struct {
+	Index  int
+	Result *Result
+	Err    error
+}
+
+// Batch resizes streams of images concurrently with Thumbnail()
+type Batch struct {
+	Concurrency int // number of images processed at once, GOMAXPROCS if 0
+
+	// MemoryLimit caps the estimated bytes of encoded, decoded and resized images in flight, 0 means no limit.
+	// The memory of an image is accounted until its result is received from the results channel.
+	// An image exceeding the limit alone is processed when nothing else is in flight. The input is accounted
+	// before it is read, the readers not telling their size (like bytes.Reader and os.File do) take the whole limit meanwhile.
+	MemoryLimit int64
+
+	Ordered bool // deliver results in input order instead of as they complete
+
+	// Cache keeps the results by ThumbnailCacheKey(), identical items in flight are processed once, nil disables caching
+	Cache *diskcache.Cache
+}
+
+type batchDone struct {
+	result BatchResult
+	memory int64
+}
+
+// Run processes items until the channel is closed. Results are delivered to the returned channel,
+// which is closed after the last one. The results channel must be drained.
+func (b *Batch) Run(items <-chan BatchItem) <-chan BatchResult {
+	concurrency := b.Concurrency
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+
+	budget := newMemoryBudget(b.MemoryLimit, b.Ordered)
+
+	type job struct {
+		index int
+		item  BatchItem
+	}
+
+	jobs := make(chan job)
+	done := make(chan batchDone)
+	out := make(chan BatchResult)
+
+	go func() {
+		index := 0
+		for item := range items {
+			jobs <- job{index, item}
+			index++
+		}
+		close(jobs)
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				done <- processBatchItem(j.index, j.item, budget, b.Cache)
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	go func() {
+		defer close(out)
+		pending := make(map[int]batchDone)
+		next := 0
+		for d := range done {
+			if !b.Ordered {
+				out <- d.result
+				budget.release(d.memory)
+				continue
+			}
+			pending[d.result.Index] = d
+			for {
+				p, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				out <- p.result
+				budget.release(p.memory)
+				next++
+			}
+		}
+	}()
+
+	return out
+}
+
+// Process processes the items and returns the results in the order of the items
+func (b *Batch) Process(items []BatchItem) []BatchResult {
+	in := make(chan BatchItem)
+	go func() {
+		for _, item := range items {
+			in <- item
+		}
+		close(in)
+	}()
+
+	results := make([]BatchResult, len(items))
+	for r := range b.Run(in) {
+		results[r.Index] = r
+	}
+	return results
+}
+
+func processBatchItem(index int, item BatchItem, budget *memoryBudget, cache *diskcache.Cache) (d batchDone) {
+	d.result.Index = index
+
+	if item.Reader == nil {
+		budget.acquire(index, 0)
+		d.result.Err = NewError(0, "batch item %v has no reader", index)
+		return
+	}
+
+	// the input is accounted before it is read: the header gives the dimensions, the reader may tell the size
+	header, err := io.ReadAll(io.LimitReader(item.Reader, batchHeaderSize))
+	if err != nil {
+		budget.acquire(index, 0)
+		d.result.Err = err
+		return
+	}
+
+	size, known := int64(len(header)), len(header) < batchHeaderSize
+	if !known {
+		var rest int64
+		rest, known = readerSize(item.Reader)
+		size += rest
+	}
+
+	reserve, ok := estimateMemorySize(header, size, item.Options)
+	if !known || !ok {
+		// nothing else runs while the item of unknown size is read
+		reserve = budget.limit
+	}
+	d.memory = budget.acquire(index, reserve)
+
+	data := header
+	if len(header) == batchHeaderSize {
+		buf := bytes.NewBuffer(make([]byte, 0, size+bytes.MinRead))
+		buf.Write(header)
+		if _, err = buf.ReadFrom(item.Reader); err != nil {
+			d.result.Err = err
+			return
+		}
+		data = buf.Bytes()
+	}
+
+	// the reservation only shrinks to the estimate of the complete data, growing it could wait for the items holding the rest
+	if memory := estimateMemory(data, item.Options); memory < d.memory {
+		budget.release(d.memory - memory)
+		d.memory = memory
+	}
+
+	if cache == nil {
+		d.result.Result, d.result.Err = Thumbnail(bytes.NewReader(data), item.Options...)
+		return
+	}
+
+	encoded, _, err := cache.Do(ThumbnailCacheKey(data, item.Options...), func() ([]byte, error) {
+		r, err := Thumbnail(bytes.NewReader(data), item.Options...)
+		if err != nil {
+			return nil, err
+		}
+		return encodeResult(r)
+	})
+	if err != nil {
+		d.result.Err = err
+		return
+	}
+
+	d.result.Result, d.result.Err = decodeResult(encoded)
+	return
+}
+
+// batchHeaderSize is the size of the head of the input read before accounting its memory
+const batchHeaderSize = 64 << 10
+
+// readerSize returns the number of bytes left in the reader if it tells it
+func readerSize(reader io.Reader) (int64, bool) {
+	switch r := reader.(type) {
+	case interface{ Len() int }:
+		return int64(r.Len()), true
+	case *os.File:
+		info, err := r.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return 0, false
+		}
+		offset, err := r.Seek(0, io.SeekCurrent)
+		if err != nil || offset > info.Size() {
+			return 0, false
+		}
+		return info.Size() - offset, true
+	}
+	return 0, false
+}
+
+// estimateMemory returns the estimated peak memory of Thumbnail() for the encoded image: the input data
+// with its copy, the decoded images counted with 4 bytes per pixel and the result
+func estimateMemory(data []byte, options []Option) int64 {
+	memory, _ := estimateMemorySize(data, int64(len(data)), options)
+	return memory
+}
+
+// estimateMemorySize works like estimateMemory() for the encoded image of the size starting with the header,
+// ok is false if the header doesn't give the dimensions and only the input is counted
+func estimateMemorySize(header []byte, size int64, options []Option) (memory int64, ok bool) {
+	memory = 2 * size
+
+	o := newThumbnailOptions(options)
+
+	orig_size, format, err := SniffSize(header)
+	if err != nil {
+		return
+	}
+	if format == ImageFormatJPEG && o.decode_opts.autoOrient() {
+		orig_size = exifOrientation(header).Size(orig_size)
+	}
+
+	scale_target, layout_func := o.layoutFuncs()
+	target := o.decode_opts.scaleTarget(orig_size, scale_target(orig_size))
+
+	// images decoded at full size unless the format scales while decoding
+	decoded_size := orig_size
+	buffers := int64(1)
+
+	switch format {
+	case ImageFormatWebP:
+		decoded_size = webpScaledSize(orig_size, target)
+	case ImageFormatJPEG:
+		if o.decode_opts.colorManagement() && convertsColors(header) {
+			// the decoded image and its converted copy, CMYK images are decoded at full size
+			buffers = 2
+			if segments, _ := jpegSegments(header); jpegComponents(segments) == 4 {
+				break
+			}
+		}
+		if target.X <= 0 && target.Y <= 0 {
+			break
+		}
+		// libjpeg scales by n/8 rounding up
+		for n := 1; n <= 8; n++ {
+			size := image.Point{(orig_size.X*n + 7) / 8, (orig_size.Y*n + 7) / 8}
+			if size.X >= target.X && size.Y >= target.Y {
+				decoded_size = size
+				break
+			}
+		}
+	default:
+		// the image of the standard decoder and its normalized copy
+		buffers = 2
+	}
+
+	out_size := layout_func(orig_size, decoded_size).Size
+
+	memory += buffers * 4 * int64(decoded_size.X) * int64(decoded_size.Y)
+	memory += int64(o.format.Channels()) * int64(out_size.X) * int64(out_size.Y)
+	return memory, true
+}
+
+// memoryBudget is a counting semaphore of bytes. Ordered budget is granted in the order of item indexes,
+// so results delivered in order never wait for an item starved by the items after it.
+type memoryBudget struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	limit   int64
+	used    int64
+	ordered bool
+	next    int
+}
+
+func newMemoryBudget(limit int64, ordered bool) *memoryBudget {
+	m := &memoryBudget{limit: limit, ordered: ordered}
+	m.cond = sync.NewCond(&m.mu)
+	return m
+}
+
+// acquire waits until n bytes are available for the item and returns the amount to release later
+func (m *memoryBudget) acquire(index int, n int64) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.limit > 0 && n > m.limit {
+		n = m.limit
+	}
+
+	for (m.ordered && index != m.next) || (m.limit > 0 && m.used+n > m.limit) {
+		m.cond.Wait()
+	}
+
+	m.used += n
+	m.next++
+	m.cond.Broadcast()
+	return n
+}
+
+func (m *memoryBudget) release(n int64) {
+	m.mu.Lock()
+	m.used -= n
+	m.mu.Unlock()
+	m.cond.Broadcast()
+}
@@ -0,0 +1,245 @@
+package ippresize
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBatch(t *testing.T) {
+	data, err := os.ReadFile("./test.jpg")
+	if err != nil {
+		t.Fatalf("os.ReadFile() failed: %v", err)
+	}
+
+	var items []BatchItem
+	for i := 0; i < 20; i++ {
+		items = append(items, BatchItem{Reader: bytes.NewReader(data), Options: []Option{WithSize(image.Point{10 + i, 0})}})
+	}
+	items[5] = BatchItem{Reader: bytes.NewReader([]byte("garbage"))}
+	items[7] = BatchItem{}
+
+	for _, b := range []*Batch{
+		{},
+		{Concurrency: 3, MemoryLimit: 1, Ordered: true},
+		{Concurrency: 4, MemoryLimit: 2 * estimateMemory(data, items[0].Options)},
+	} {
+		for i := range items {
+			if r, ok := items[i].Reader.(*bytes.Reader); ok {
+				r.Seek(0, 0)
+			}
+		}
+
+		in := make(chan BatchItem)
+		go func() {
+			for _, item := range items {
+				in <- item
+			}
+			close(in)
+		}()
+
+		seen := make(map[int]bool)
+		next := 0
+		for r := range b.Run(in) {
+			if b.Ordered && r.Index != next {
+				t.Errorf("%+v: expected result %v, got %v", b, next, r.Index)
+			}
+			next++
+			seen[r.Index] = true
+
+			if r.Index == 5 || r.Index == 7 {
+				if r.Err == nil {
+					t.Errorf("%+v: item %v should fail", b, r.Index)
+				}
+				continue
+			}
+			if r.Err != nil {
+				t.Fatalf("%+v: item %v failed: %v", b, r.Index, r.Err)
+			}
+			if r.Result.Size.X != 10+r.Index {
+				t.Errorf("%+v: item %v: unexpected size %v", b, r.Index, r.Result.Size)
+			}
+		}
+		if len(seen) != len(items) {
+			t.Errorf("%+v: expected %v results, got %v", b, len(items), len(seen))
+		}
+	}
+}
+
+func TestBatchProcess(t *testing.T) {
+	data, err := os.ReadFile("./test.jpg")
+	if err != nil {
+		t.Fatalf("os.ReadFile() failed: %v", err)
+	}
+
+	items := []BatchItem{
+		{Reader: bytes.NewReader(data), Options: []Option{WithSize(image.Point{50, 50}), WithFit(FitCover), WithFormat(PixelFormatGray)}},
+		{Reader: bytes.NewReader(data), Options: []Option{WithSize(image.Point{40, 0})}},
+	}
+	results := (&Batch{}).Process(items)
+	for i, r := range results {
+		if r.Index != i || r.Err != nil {
+			t.Fatalf("unexpected result %v: %+v", i, r)
+		}
+	}
+	if results[0].Result.Size != (image.Point{50, 50}) || results[0].Result.Format != PixelFormatGray {
+		t.Errorf("unexpected result 0: %v %v", results[0].Result.Size, results[0].Result.Format)
+	}
+	if results[1].Result.Size != (image.Point{40, 60}) {
+		t.Errorf("unexpected result 1: %v", results[1].Result.Size)
+	}
+}
+
+func TestEstimateMemory(t *testing.T) {
+	data, err := os.ReadFile("./test.jpg")
+	if err != nil {
+		t.Fatalf("os.ReadFile() failed: %v", err)
+	}
+
+	full := estimateMemory(data, nil)
+	if expect := 2*int64(len(data)) + 4*566*850 + 3*566*850; full != expect {
+		t.Errorf("expected %v, got %v", expect, full)
+	}
+
+	// libjpeg prescaling to 1/8 gives 71x107
+	small := estimateMemory(data, []Option{WithSize(image.Point{50, 0})})
+	if expect := 2*int64(len(data)) + 4*71*107 + 3*50*75; small != expect {
+		t.Errorf("expected %v, got %v", expect, small)
+	}
+
+	if m := estimateMemory([]byte("garbage"), nil); m != 14 {
+		t.Errorf("expected 14, got %v", m)
+	}
+
+	// the standard decoders keep their image and the normalized copy at full size
+	var png_data bytes.Buffer
+	png.Encode(&png_data, image.NewRGBA(image.Rect(0, 0, 64, 32)))
+	if m, expect := estimateMemory(png_data.Bytes(), nil), 2*int64(png_data.Len())+2*4*64*32+3*64*32; m != expect {
+		t.Errorf("png: expected %v, got %v", expect, m)
+	}
+
+	// the header and the size give the same estimate as the complete data
+	if m, ok := estimateMemorySize(data[:batchHeaderSize], int64(len(data)), nil); !ok || m != full {
+		t.Errorf("header: expected %v, got %v %v", full, m, ok)
+	}
+}
+
+// budgetReader records the budget in use when the input is read past the header
+type budgetReader struct {
+	io.Reader
+	budget *memoryBudget
+	read   int
+	used   int64
+}
+
+func (r *budgetReader) Read(p []byte) (int, error) {
+	if r.read >= batchHeaderSize {
+		r.budget.mu.Lock()
+		r.used = r.budget.used
+		r.budget.mu.Unlock()
+	}
+	n, err := r.Reader.Read(p)
+	r.read += n
+	return n, err
+}
+
+// sizedReader tells the size of the input like bytes.Reader does
+type sizedReader struct {
+	*budgetReader
+	size int
+}
+
+func (r *sizedReader) Len() int {
+	return r.size - r.read
+}
+
+func TestBatchInputMemory(t *testing.T) {
+	data, err := os.ReadFile("./test.jpg")
+	if err != nil {
+		t.Fatalf("os.ReadFile() failed: %v", err)
+	}
+	options := []Option{WithSize(image.Point{50, 0})}
+	estimate := estimateMemory(data, options)
+
+	// the size is known from the reader
+	budget := newMemoryBudget(1<<40, false)
+	r := &budgetReader{Reader: bytes.NewReader(data), budget: budget}
+	d := processBatchItem(0, BatchItem{Reader: &sizedReader{r, len(data)}, Options: options}, budget, nil)
+	if d.result.Err != nil {
+		t.Fatalf("processBatchItem() failed: %v", d.result.Err)
+	}
+	if r.used != estimate || d.memory != estimate {
+		t.Errorf("sized reader: expected %v accounted while reading, got %v, then %v", estimate, r.used, d.memory)
+	}
+
+	// the whole budget is reserved while the input of unknown size is read, then shrinks to the estimate
+	budget = newMemoryBudget(10<<20, false)
+	r = &budgetReader{Reader: bytes.NewReader(data), budget: budget}
+	d = processBatchItem(0, BatchItem{Reader: r, Options: options}, budget, nil)
+	if d.result.Err != nil {
+		t.Fatalf("processBatchItem() failed: %v", d.result.Err)
+	}
+	if r.used != 10<<20 || d.memory != estimate || budget.used != estimate {
+		t.Errorf("unknown size: expected %v accounted while reading, got %v, then %v", 10<<20, r.used, d.memory)
+	}
+}
+
+func TestMemoryBudget(t *testing.T) {
+	budget := newMemoryBudget(100, false)
+
+	if n := budget.acquire(0, 60); n != 60 {
+		t.Fatalf("expected 60, got %v", n)
+	}
+
+	acquired := make(chan int64)
+	go func() {
+		acquired <- budget.acquire(1, 60)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatalf("budget exceeded")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	budget.release(60)
+	if n := <-acquired; n != 60 {
+		t.Errorf("expected 60, got %v", n)
+	}
+	budget.release(60)
+
+	// larger than the limit is clamped
+	if n := budget.acquire(2, 1000); n != 100 {
+		t.Errorf("expected 100, got %v", n)
+	}
+	budget.release(100)
+
+	// ordered budget is granted by index
+	ordered := newMemoryBudget(0, true)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	count := 0
+	for i := 3; i >= 1; i-- {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ordered.acquire(i, 1)
+			mu.Lock()
+			count++
+			mu.Unlock()
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	if count != 0 {
+		t.Errorf("budget granted before index 0")
+	}
+	mu.Unlock()
+	ordered.acquire(0, 1)
+	wg.Wait()
+}
@@ -0,0 +1,144 @@
+package ippresize
+
+//go:generate stringer -type=BorderMode -trimprefix Border
+
+/*
+#include "image.h"
+*/
+import "C"
+
+import (
+	"image"
+	"runtime"
+	"unsafe"
+)
+
+type BorderMode C.image_border_t
+
+const (
+	BorderReplicate  BorderMode = C.IMAGE_BORDER_REPLICATE   // aaa|abcd|ddd
+	BorderReflect    BorderMode = C.IMAGE_BORDER_REFLECT     // cba|abcd|dcb
+	BorderReflect101 BorderMode = C.IMAGE_BORDER_REFLECT_101 // dcb|abcd|cba
+	BorderWrap       BorderMode = C.IMAGE_BORDER_WRAP        // bcd|abcd|abc
+	BorderConstant   BorderMode = C.IMAGE_BORDER_CONSTANT    // vvv|abcd|vvv
+)
+
+func borderValue(channels int, mode BorderMode, value []uint8) (*C.uchar, error) {
+	if mode != BorderConstant || value == nil {
+		return nil, nil
+	}
+	if len(value) != channels {
+		return nil, NewError(0, "border value doesn't match number of channels: {channels: %v}, len=%v", channels, len(value))
+	}
+	return (*C.uchar)(unsafe.Pointer(&value[0])), nil
+}
+
+// PadBorder fills the area of the image outside of src rectangle using src pixels according to mode.
+// For BorderConstant the area is filled with value, one byte per channel, zeros if value is nil.
+func PadBorder(in []uint8, in_stride int, in_size image.Point, channels int, src image.Rectangle, mode BorderMode, value []uint8) error {
+
+	if in_size.X <= 0 || in_size.Y <= 0 {
+		return NewError(0, "one of the input image dimensions is invalid: {width: %v, height: %v}", in_size.X, in_size.Y)
+	}
+
+	if len(in) < channels*in_size.X*in_size.Y {
+		return NewError(0, "input image buffer size doesn't match image dimensions: {width: %v, height: %v, channels: %v}, len=%v",
+			in_size.X, in_size.Y, channels, len(in))
+	}
+
+	if src.Empty() || !src.In(image.Rectangle{Max: in_size}) {
+		return NewError(0, "source rectangle %v doesn't fit into the image: {width: %v, height: %v}", src, in_size.X, in_size.Y)
+	}
+
+	value_data, err := borderValue(channels, mode, value)
+	if err != nil {
+		return err
+	}
+
+	var img C.struct_image_s
+	img.w = C.uint(in_size.X)
+	img.h = C.uint(in_size.Y)
+	img.channels = C.uint(channels)
+	img.rowstep = C.size_t(in_stride)
+	img_data := (*C.uchar)(unsafe.Pointer(&in[0]))
+
+	const err_size = 1024
+	var cerr [err_size]C.char
+
+	ret := C.image_ipp_copy_border_inplace(&img, img_data, C.uint(src.Min.X), C.uint(src.Min.Y), C.uint(src.Dx()), C.uint(src.Dy()), C.image_border_t(mode), value_data, &cerr[0], err_size)
+
+	/* make 100% sure garbage collector wont kill these objects in the middle of execution of c function */
+	runtime.KeepAlive(img)
+	runtime.KeepAlive(img_data)
+	runtime.KeepAlive(value)
+
+	if ret != 0 {
+		return NewError(int(ret), "C.image_ipp_copy_border_inplace() failed: %v", C.GoString(&cerr[0]))
+	}
+
+	return nil
+}
+
+// PadBorderCopy copies the input image into the larger output image at offset and fills the rest
+// of the output image according to mode, see PadBorder()
+func PadBorderCopy(in []uint8, in_stride int, in_size image.Point, out []uint8, out_stride int, out_size image.Point, offset image.Point, channels int, mode BorderMode, value []uint8) error {
+
+	if in_size.X <= 0 || in_size.Y <= 0 {
+		return NewError(0, "one of the input image dimensions is invalid: {width: %v, height: %v}", in_size.X, in_size.Y)
+	}
+
+	if out_size.X <= 0 || out_size.Y <= 0 {
+		return NewError(0, "one of the output image dimensions is invalid: {width: %v, height: %v}", out_size.X, out_size.Y)
+	}
+
+	if len(in) < channels*in_size.X*in_size.Y {
+		return NewError(0, "input image buffer size doesn't match image dimensions: {width: %v, height: %v, channels: %v}, len=%v",
+			in_size.X, in_size.Y, channels, len(in))
+	}
+
+	if len(out) < channels*out_size.X*out_size.Y {
+		return NewError(0, "output image buffer size doesn't match image dimensions: {width: %v, height: %v, channels: %v}, len=%v",
+			out_size.X, out_size.Y, channels, len(out))
+	}
+
+	if dst := (image.Rectangle{offset, offset.Add(in_size)}); !dst.In(image.Rectangle{Max: out_size}) {
+		return NewError(0, "input image placed at %v doesn't fit into the output image: {width: %v, height: %v}", dst, out_size.X, out_size.Y)
+	}
+
+	value_data, err := borderValue(channels, mode, value)
+	if err != nil {
+		return err
+	}
+
+	var img_in C.struct_image_s
+	img_in.w = C.uint(in_size.X)
+	img_in.h = C.uint(in_size.Y)
+	img_in.channels = C.uint(channels)
+	img_in.rowstep = C.size_t(in_stride)
+	img_in_data := (*C.uchar)(unsafe.Pointer(&in[0]))
+
+	var img_out C.struct_image_s
+	img_out.w = C.uint(out_size.X)
+	img_out.h = C.uint(out_size.Y)
+	img_out.channels = C.uint(channels)
+	img_out.rowstep = C.size_t(out_stride)
+	img_out_data := (*C.uchar)(unsafe.Pointer(&out[0]))
+
+	const err_size = 1024
+	var cerr [err_size]C.char
+
+	ret := C.image_ipp_copy_border(&img_in, img_in_data, &img_out, img_out_data, C.uint(offset.X), C.uint(offset.Y), C.image_border_t(mode), value_data, &cerr[0], err_size)
+
+	/* make 100% sure garbage collector wont kill these objects in the middle of execution of c function */
+	runtime.KeepAlive(img_in)
+	runtime.KeepAlive(img_in_data)
+	runtime.KeepAlive(img_out)
+	runtime.KeepAlive(img_out_data)
+	runtime.KeepAlive(value)
+
+	if ret != 0 {
+		return NewError(int(ret), "C.image_ipp_copy_border() failed: %v", C.GoString(&cerr[0]))
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package ippresize
+
+import (
+	"bytes"
+	"image"
+	"testing"
+)
+
+func TestPadBorder(t *testing.T) {
+	tests := []struct {
+		mode       BorderMode
+		horizontal []uint8
+		vertical   []uint8
+	}{
+		{BorderReplicate, []uint8{1, 1, 1, 2, 3, 4, 4, 4}, []uint8{1, 1, 1, 2, 3, 3, 3}},
+		{BorderReflect, []uint8{2, 1, 1, 2, 3, 4, 4, 3}, []uint8{2, 1, 1, 2, 3, 3, 2}},
+		{BorderReflect101, []uint8{3, 2, 1, 2, 3, 4, 3, 2}, []uint8{3, 2, 1, 2, 3, 2, 1}},
+		{BorderWrap, []uint8{3, 4, 1, 2, 3, 4, 1, 2}, []uint8{2, 3, 1, 2, 3, 1, 2}},
+		{BorderConstant, []uint8{9, 9, 1, 2, 3, 4, 9, 9}, []uint8{9, 9, 1, 2, 3, 9, 9}},
+	}
+
+	for _, item := range tests {
+		horizontal := []uint8{0, 0, 1, 2, 3, 4, 0, 0}
+		err := PadBorder(horizontal, 8, image.Point{8, 1}, 1, image.Rect(2, 0, 6, 1), item.mode, []uint8{9})
+		if err != nil {
+			t.Fatalf("%v: PadBorder() failed: %v", item.mode, err)
+		}
+		if !bytes.Equal(horizontal, item.horizontal) {
+			t.Errorf("%v: expected %v, got %v", item.mode, item.horizontal, horizontal)
+		}
+
+		vertical := []uint8{0, 0, 1, 2, 3, 0, 0}
+		err = PadBorder(vertical, 1, image.Point{1, 7}, 1, image.Rect(0, 2, 1, 5), item.mode, []uint8{9})
+		if err != nil {
+			t.Fatalf("%v: PadBorder() failed: %v", item.mode, err)
+		}
+		if !bytes.Equal(vertical, item.vertical) {
+			t.Errorf("%v: expected %v, got %v", item.mode, item.vertical, vertical)
+		}
+	}
+
+	if err := PadBorder(make([]uint8, 8), 8, image.Point{8, 1}, 1, image.Rect(6, 0, 9, 1), BorderReplicate, nil); err == nil {
+		t.Errorf("expected error for source rectangle outside of the image")
+	}
+}
+
+func TestPadBorderCopy(t *testing.T) {
+	in := []uint8{
+		1, 2, 3, 4, 5, 6,
+		7, 8, 9, 10, 11, 12,
+	}
+	expected := []uint8{
+		10, 11, 12, 7, 8, 9, 10, 11, 12, 7, 8, 9,
+		4, 5, 6, 1, 2, 3, 4, 5, 6, 1, 2, 3,
+		10, 11, 12, 7, 8, 9, 10, 11, 12, 7, 8, 9,
+	}
+	out := make([]uint8, 3*4*3)
+	err := PadBorderCopy(in, 6, image.Point{2, 2}, out, 12, image.Point{4, 3}, image.Point{1, 1}, 3, BorderWrap, nil)
+	if err != nil {
+		t.Fatalf("PadBorderCopy() failed: %v", err)
+	}
+	if !bytes.Equal(out, expected) {
+		t.Errorf("expected %v, got %v", expected, out)
+	}
+
+	out = make([]uint8, 3*4*3)
+	err = PadBorderCopy(in, 6, image.Point{2, 2}, out, 12, image.Point{4, 3}, image.Point{1, 1}, 3, BorderConstant, []uint8{0, 0, 0})
+	if err != nil {
+		t.Fatalf("PadBorderCopy() failed: %v", err)
+	}
+	if out[0] != 0 || out[3*4+3] != 1 || out[3*4*3-1] != 0 {
+		t.Errorf("unexpected result: %v", out)
+	}
+}
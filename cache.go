@@ -0,0 +1,50 @@
+package ippresize
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"image/color"
+)
+
+// CacheKey returns the key of the output of processing the source data with the parameters given in their canonical form,
+// the key is bound to BackendVersion() as well
+func CacheKey(data []byte, params string) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%v\n%v\n", BackendVersion(), params)
+	hash.Write(data)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// String returns the canonical form of the options, equal options give equal strings
+func (o *thumbnailOptions) String() string {
+	var decode_opts DecodeOptions
+	if o.decode_opts != nil {
+		decode_opts = *o.decode_opts
+	}
+	background := color.RGBA64Model.Convert(decode_opts.background())
+	decode_opts.Background = nil
+
+	return fmt.Sprintf("format=%v box=%v fit=%v fit_opts=%+v proportional=%v interpolation=%v decode_opts=%+v background=%+v",
+		o.format, o.box, o.fit, o.fit_opts, o.proportional, o.interpolation, decode_opts, background)
+}
+
+// ThumbnailCacheKey returns the key of Thumbnail() result for the source data and the options
+func ThumbnailCacheKey(data []byte, options ...Option) string {
+	o := newThumbnailOptions(options)
+	return CacheKey(data, "thumbnail "+o.String())
+}
+
+func encodeResult(r *Result) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(r)
+	return buf.Bytes(), err
+}
+
+func decodeResult(data []byte) (r *Result, err error) {
+	r = &Result{}
+	err = gob.NewDecoder(bytes.NewReader(data)).Decode(r)
+	return
+}
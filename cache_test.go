@@ -0,0 +1,96 @@
+package ippresize
+
+import (
+	"bytes"
+	"github.com/anight/go-ippresize/diskcache"
+	"image"
+	"image/color"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestCacheKey(t *testing.T) {
+	if BackendVersion() == "" {
+		t.Errorf("empty backend version")
+	}
+
+	data := []byte("data")
+	key := ThumbnailCacheKey(data, WithSize(image.Point{100, 0}))
+
+	for _, options := range [][]Option{
+		{WithSize(image.Point{100, 0}), WithFit(FitContain), WithInterpolation(InterpolationLinear)},
+		{WithSize(image.Point{100, 0}), WithDecodeOptions(&DecodeOptions{})},
+		{WithSize(image.Point{100, 0}), WithDecodeOptions(&DecodeOptions{Background: color.Gray{255}})},
+	} {
+		if k := ThumbnailCacheKey(data, options...); k != key {
+			t.Errorf("%v: equivalent options should give the same key", newThumbnailOptions(options))
+		}
+	}
+
+	for _, options := range [][]Option{
+		{WithSize(image.Point{101, 0})},
+		{WithSize(image.Point{100, 0}), WithFit(FitCover)},
+		{WithSize(image.Point{100, 0}), WithInterpolation(InterpolationLanczos)},
+		{WithSize(image.Point{100, 0}), WithPadding([]uint8{1, 2, 3})},
+		{WithSize(image.Point{100, 0}), WithFormat(PixelFormatGray)},
+		{WithSize(image.Point{100, 0}), WithDecodeOptions(&DecodeOptions{MaxPrescale: 1})},
+		{WithSize(image.Point{100, 0}), WithDecodeOptions(&DecodeOptions{Background: color.Black})},
+	} {
+		if k := ThumbnailCacheKey(data, options...); k == key {
+			t.Errorf("%v: different options should give different keys", newThumbnailOptions(options))
+		}
+	}
+
+	if ThumbnailCacheKey([]byte("other"), WithSize(image.Point{100, 0})) == key {
+		t.Errorf("different data should give different keys")
+	}
+	if CacheKey(data, "a") == CacheKey(data, "b") || CacheKey(data, "a") != CacheKey(data, "a") {
+		t.Errorf("unexpected CacheKey()")
+	}
+}
+
+func TestBatchCache(t *testing.T) {
+	data, err := os.ReadFile("./test.jpg")
+	if err != nil {
+		t.Fatalf("os.ReadFile() failed: %v", err)
+	}
+
+	cache, err := diskcache.Open(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatalf("diskcache.Open() failed: %v", err)
+	}
+
+	items := func() []BatchItem {
+		return []BatchItem{
+			{Reader: bytes.NewReader(data), Options: []Option{WithSize(image.Point{50, 50}), WithFit(FitCover)}},
+			{Reader: bytes.NewReader(data), Options: []Option{WithSize(image.Point{50, 50}), WithFit(FitCover)}},
+			{Reader: bytes.NewReader(data), Options: []Option{WithSize(image.Point{40, 0}), WithFormat(PixelFormatGray)}},
+			{Reader: bytes.NewReader([]byte("garbage"))},
+		}
+	}
+
+	expected := (&Batch{}).Process(items())
+
+	b := &Batch{Concurrency: 4, Cache: cache}
+	for run := 0; run < 2; run++ {
+		results := b.Process(items())
+		for i, r := range results {
+			if i == 3 {
+				if r.Err == nil {
+					t.Errorf("run %v: item %v should fail", run, i)
+				}
+				continue
+			}
+			if r.Err != nil {
+				t.Fatalf("run %v: item %v failed: %v", run, i, r.Err)
+			}
+			if !reflect.DeepEqual(r.Result, expected[i].Result) {
+				t.Errorf("run %v: item %v: cached result differs", run, i)
+			}
+		}
+		if cache.Len() != 2 {
+			t.Errorf("run %v: expected 2 cache entries, got %v", run, cache.Len())
+		}
+	}
+}
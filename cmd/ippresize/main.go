@@ -0,0 +1,390 @@
+// Command ippresize resizes images with the library from the shell.
+//
+// Usage:
+//
+//	ippresize [flags] -o OUTPUT INPUT...
+//
+// Inputs are image files or directories searched recursively for images. A single input file is written
+// to OUTPUT unless it is an existing directory or ends with a slash, otherwise the outputs are written
+// to the OUTPUT directory keeping the paths relative to the input directories. Errors are reported
+// per file and the exit status is 1 if any file fails.
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"github.com/anight/go-ippresize"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// extensions of the files searched in input directories
+var imageExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".bmp": true, ".webp": true,
+}
+
+var formatExtensions = map[ippresize.ImageFormat]string{
+	ippresize.ImageFormatJPEG: ".jpg",
+	ippresize.ImageFormatPNG:  ".png",
+	ippresize.ImageFormatWebP: ".webp",
+}
+
+type config struct {
+	box           image.Point
+	fit           ippresize.Fit
+	gravity       ippresize.Gravity
+	crop          ippresize.CropStrategy
+	interpolation ippresize.Interpolation
+	pad_color     []uint8
+	format        ippresize.ImageFormat // ImageFormatUnknown means by the output extension or the input format
+	quality       int
+}
+
+// job is an input file and its output, out_dir is set if the output file name is derived from rel
+type job struct {
+	in      string
+	out     string
+	out_dir string
+	rel     string
+	err     error // the job is reported as failed without processing
+}
+
+// parseSize parses "WxH", "Wx", "xH" and "W", missing dimension is zero
+func parseSize(s string) (size image.Point, err error) {
+	wh := strings.SplitN(s, "x", 2)
+	if wh[0] != "" {
+		if size.X, err = strconv.Atoi(wh[0]); err != nil || size.X < 0 {
+			return size, fmt.Errorf("invalid width in size %q", s)
+		}
+	}
+	if len(wh) == 2 && wh[1] != "" {
+		if size.Y, err = strconv.Atoi(wh[1]); err != nil || size.Y < 0 {
+			return size, fmt.Errorf("invalid height in size %q", s)
+		}
+	}
+	if size.X == 0 && size.Y == 0 {
+		return size, fmt.Errorf("invalid size %q", s)
+	}
+	return size, nil
+}
+
+// parseColor parses "#rrggbb", "#rrggbbaa" or comma separated decimal values
+func parseColor(s string) ([]uint8, error) {
+	if strings.HasPrefix(s, "#") {
+		c, err := hex.DecodeString(s[1:])
+		if err != nil || (len(c) != 3 && len(c) != 4) {
+			return nil, fmt.Errorf("invalid color %q", s)
+		}
+		return c, nil
+	}
+
+	var c []uint8
+	for _, v := range strings.Split(s, ",") {
+		n, err := strconv.ParseUint(strings.TrimSpace(v), 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid color %q", s)
+		}
+		c = append(c, uint8(n))
+	}
+	if len(c) != 1 && len(c) != 3 && len(c) != 4 {
+		return nil, fmt.Errorf("invalid color %q", s)
+	}
+	return c, nil
+}
+
+// padColor returns the pad color for the number of channels
+func (c *config) padColor(channels int) []uint8 {
+	color := c.pad_color
+	switch {
+	case len(color) == 1:
+		color = []uint8{color[0], color[0], color[0]}
+	case len(color) == 4 && channels == 3:
+		color = color[:3]
+	}
+	if len(color) == 3 && channels == 4 {
+		color = append(color[:3:3], 255)
+	}
+	return color
+}
+
+func (c *config) options(channels int) []ippresize.Option {
+	options := []ippresize.Option{
+		ippresize.WithFit(c.fit),
+		ippresize.WithGravity(c.gravity),
+		ippresize.WithCropStrategy(c.crop),
+		ippresize.WithInterpolation(c.interpolation),
+	}
+	if c.pad_color != nil {
+		options = append(options, ippresize.WithPadding(c.padColor(channels)))
+	}
+	return options
+}
+
+// outputFormat returns the format of the output for the input format
+func (c *config) outputFormat(j *job, source ippresize.ImageFormat) (ippresize.ImageFormat, error) {
+	if c.format != ippresize.ImageFormatUnknown {
+		return c.format, nil
+	}
+
+	if j.out_dir == "" {
+		format, err := ippresize.ParseImageFormat(filepath.Ext(j.out))
+		if err != nil || formatExtensions[format] == "" {
+			return 0, fmt.Errorf("can't determine output format by the name %q, use -format", j.out)
+		}
+		return format, nil
+	}
+
+	if formatExtensions[source] != "" {
+		return source, nil
+	}
+	return ippresize.ImageFormatPNG, nil
+}
+
+// outPath returns the output file of the job for the output format
+func (j *job) outPath(format ippresize.ImageFormat) string {
+	if j.out_dir == "" {
+		return j.out
+	}
+	return filepath.Join(j.out_dir, strings.TrimSuffix(j.rel, filepath.Ext(j.rel))+formatExtensions[format])
+}
+
+// guessFormat returns the output format of the job expected by the input extension, the actual one
+// follows the sniffed input format
+func (c *config) guessFormat(j *job) ippresize.ImageFormat {
+	if c.format != ippresize.ImageFormatUnknown {
+		return c.format
+	}
+	source, err := ippresize.ParseImageFormat(filepath.Ext(j.in))
+	if err != nil {
+		source = ippresize.ImageFormatUnknown
+	}
+	format, _ := c.outputFormat(j, source)
+	return format
+}
+
+// resize resizes the file of the job and writes the output, the output file and size are returned
+func (c *config) resize(j *job) (out string, size image.Point, err error) {
+	data, err := os.ReadFile(j.in)
+	if err != nil {
+		return
+	}
+
+	format, err := c.outputFormat(j, ippresize.SniffFormat(data))
+	if err != nil {
+		return
+	}
+
+	out = j.outPath(format)
+
+	var buf bytes.Buffer
+
+	if format == ippresize.ImageFormatJPEG {
+		var transform ippresize.Transform
+		transform, err = ippresize.ResizeJpeg(bytes.NewReader(data), &buf, c.box, &ippresize.JpegOptions{Quality: c.quality}, c.options(3)...)
+		size = transform.OutSize
+	} else {
+		var r *ippresize.Result
+		options := append(c.options(4), ippresize.WithSize(c.box), ippresize.WithFormat(ippresize.PixelFormatRGBA))
+		r, err = ippresize.Thumbnail(bytes.NewReader(data), options...)
+		if err == nil {
+			size = r.Size
+			err = r.Encode(&buf, format, c.quality)
+		}
+	}
+	if err != nil {
+		return
+	}
+
+	if err = os.MkdirAll(filepath.Dir(out), 0777); err != nil {
+		return
+	}
+
+	err = os.WriteFile(out, buf.Bytes(), 0666)
+	return
+}
+
+// jobs lists the input files and their outputs, the jobs writing the output of an earlier job fail
+func (c *config) jobs(inputs []string, output string) ([]job, error) {
+	out_is_dir := strings.HasSuffix(output, "/") || strings.HasSuffix(output, string(filepath.Separator))
+	if fi, err := os.Stat(output); err == nil && fi.IsDir() {
+		out_is_dir = true
+	}
+
+	var list []job
+
+	for _, in := range inputs {
+		fi, err := os.Stat(in)
+		if err != nil {
+			return nil, err
+		}
+
+		if !fi.IsDir() {
+			if len(inputs) == 1 && !out_is_dir {
+				list = append(list, job{in: in, out: output})
+			} else {
+				list = append(list, job{in: in, out_dir: output, rel: filepath.Base(in)})
+			}
+			continue
+		}
+
+		err = filepath.Walk(in, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() || !imageExtensions[strings.ToLower(filepath.Ext(path))] {
+				return nil
+			}
+			rel, err := filepath.Rel(in, path)
+			if err != nil {
+				return err
+			}
+			list = append(list, job{in: path, out_dir: output, rel: rel})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	seen := map[string]string{}
+	for i := range list {
+		j := &list[i]
+		out := filepath.Clean(j.outPath(c.guessFormat(j)))
+		if in, ok := seen[out]; ok {
+			j.err = fmt.Errorf("output %v is also written for %v", out, in)
+			continue
+		}
+		seen[out] = j.in
+	}
+
+	return list, nil
+}
+
+// run parses the arguments and processes the files, it returns the exit status
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("ippresize", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: ippresize [flags] -o OUTPUT INPUT...\n\nFlags:\n")
+		flags.PrintDefaults()
+	}
+
+	output := flags.String("o", "", "output file or directory")
+	size := flags.String("size", "", "box size: WxH, Wx or xH, the missing dimension follows the aspect ratio")
+	fit := flags.String("fit", "contain", "fit mode: contain, cover, fill, inside or outside")
+	gravity := flags.String("gravity", "center", "placement for contain and cover: center, top, bottom, left, right, top-left, ..., or smart for the most detailed crop of cover")
+	crop := flags.String("crop-strategy", "edges", "scoring of the smart crop: edges, entropy or skin")
+	interpolation := flags.String("interpolation", "linear", "interpolation: nearest-neighbour, linear, cubic, lanczos, super, antialiasing-linear, antialiasing-cubic or antialiasing-lanczos")
+	pad := flags.String("pad", "", "pad color for contain: #rrggbb, #rrggbbaa or r,g,b, gray by default")
+	format := flags.String("format", "", "output format: jpeg, png or webp, by the output extension or the input format by default")
+	quality := flags.Int("quality", 75, "quality of jpeg and webp output 1..100")
+	parallel := flags.Int("j", runtime.NumCPU(), "number of files processed in parallel")
+	verbose := flags.Bool("v", false, "print the processed files")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	usage := func(format string, args ...interface{}) int {
+		fmt.Fprintf(stderr, "ippresize: "+format+"\n", args...)
+		flags.Usage()
+		return 2
+	}
+
+	if *output == "" || flags.NArg() == 0 {
+		return usage("-o and at least one input are required")
+	}
+
+	c := &config{quality: *quality}
+	var err error
+
+	if c.box, err = parseSize(*size); err != nil {
+		return usage("-size: %v", err)
+	}
+	if c.fit, err = ippresize.ParseFit(*fit); err != nil {
+		return usage("-fit: %v", err)
+	}
+	if c.gravity, err = ippresize.ParseGravity(*gravity); err != nil {
+		return usage("-gravity: %v", err)
+	}
+	if c.crop, err = ippresize.ParseCropStrategy(*crop); err != nil {
+		return usage("-crop-strategy: %v", err)
+	}
+	if c.interpolation, err = ippresize.ParseInterpolation(*interpolation); err != nil {
+		return usage("-interpolation: %v", err)
+	}
+	if *pad != "" {
+		if c.pad_color, err = parseColor(*pad); err != nil {
+			return usage("-pad: %v", err)
+		}
+	}
+	if *format != "" {
+		if c.format, err = ippresize.ParseImageFormat(*format); err != nil || formatExtensions[c.format] == "" {
+			return usage("-format: unsupported output format %q", *format)
+		}
+	}
+	if c.quality < 1 || c.quality > 100 {
+		return usage("-quality: must be 1..100")
+	}
+	if *parallel < 1 {
+		return usage("-j: must be positive")
+	}
+
+	list, err := c.jobs(flags.Args(), *output)
+	if err != nil {
+		fmt.Fprintf(stderr, "ippresize: %v\n", err)
+		return 1
+	}
+
+	var mu sync.Mutex
+	failed := 0
+
+	ch := make(chan *job)
+	var wg sync.WaitGroup
+	for i := 0; i < *parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range ch {
+				var out string
+				var size image.Point
+				err := j.err
+				if err == nil {
+					out, size, err = c.resize(j)
+				}
+				mu.Lock()
+				if err != nil {
+					failed++
+					fmt.Fprintf(stderr, "ippresize: %v: %v\n", j.in, err)
+				} else if *verbose {
+					fmt.Fprintf(stdout, "%v -> %v %vx%v\n", j.in, out, size.X, size.Y)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range list {
+		ch <- &list[i]
+	}
+	close(ch)
+	wg.Wait()
+
+	if failed > 0 {
+		fmt.Fprintf(stderr, "ippresize: %v of %v files failed\n", failed, len(list))
+		return 1
+	}
+
+	return 0
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func decodeConfig(t *testing.T, path string) (image.Config, string) {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("os.Open() failed: %v", err)
+	}
+	defer f.Close()
+	config, format, err := image.DecodeConfig(f)
+	if err != nil {
+		t.Fatalf("%v: image.DecodeConfig() failed: %v", path, err)
+	}
+	return config, format
+}
+
+func TestRun(t *testing.T) {
+	data, err := os.ReadFile("../../test.jpg")
+	if err != nil {
+		t.Fatalf("os.ReadFile() failed: %v", err)
+	}
+
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in")
+	for _, name := range []string{"a.jpg", "sub/b.jpeg", "sub/c.JPG"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(in, name)), 0777)
+		if err := os.WriteFile(filepath.Join(in, name), data, 0666); err != nil {
+			t.Fatalf("os.WriteFile() failed: %v", err)
+		}
+	}
+	os.WriteFile(filepath.Join(in, "notes.txt"), []byte("not an image"), 0666)
+
+	var stdout, stderr bytes.Buffer
+
+	// single file
+	out := filepath.Join(dir, "out.png")
+	if code := run([]string{"-size", "100x100", "-fit", "cover", "-interpolation", "lanczos", "-o", out, filepath.Join(in, "a.jpg")}, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit status %v: %v", code, stderr.String())
+	}
+	if config, format := decodeConfig(t, out); format != "png" || config.Width != 100 || config.Height != 100 {
+		t.Errorf("unexpected output: %v %+v", format, config)
+	}
+
+	// directory, format of the input is kept
+	out = filepath.Join(dir, "out")
+	if code := run([]string{"-size", "50x", "-j", "2", "-v", "-o", out, in}, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit status %v: %v", code, stderr.String())
+	}
+	for _, name := range []string{"a.jpg", "sub/b.jpg", "sub/c.jpg"} {
+		if config, format := decodeConfig(t, filepath.Join(out, name)); format != "jpeg" || config.Width != 50 || config.Height != 75 {
+			t.Errorf("%v: unexpected output: %v %+v", name, format, config)
+		}
+	}
+	if strings.Count(stdout.String(), "\n") != 3 {
+		t.Errorf("unexpected verbose output: %q", stdout.String())
+	}
+
+	// padded to the box with the color
+	if code := run([]string{"-size", "80x40", "-pad", "#ff0000", "-format", "png", "-o", out + "/", filepath.Join(in, "a.jpg")}, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit status %v: %v", code, stderr.String())
+	}
+	f, _ := os.Open(filepath.Join(out, "a.png"))
+	im, _, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		t.Fatalf("image.Decode() failed: %v", err)
+	}
+	if r, g, b, _ := im.At(0, 0).RGBA(); im.Bounds().Size() != (image.Point{80, 40}) || r>>8 != 255 || g>>8 != 0 || b>>8 != 0 {
+		t.Errorf("unexpected padded output: %v %v", im.Bounds(), im.At(0, 0))
+	}
+
+	// a broken file fails, the rest are processed
+	os.WriteFile(filepath.Join(in, "broken.jpg"), []byte("garbage"), 0666)
+	stderr.Reset()
+	if code := run([]string{"-size", "20x20", "-o", filepath.Join(dir, "out2"), in}, &stdout, &stderr); code != 1 {
+		t.Errorf("expected exit status 1, got %v", code)
+	}
+	if !strings.Contains(stderr.String(), "broken.jpg") || !strings.Contains(stderr.String(), "1 of 4 files failed") {
+		t.Errorf("unexpected errors: %v", stderr.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "out2", "sub", "c.jpg")); err != nil {
+		t.Errorf("other files should be processed: %v", err)
+	}
+
+	// the same output name from two inputs fails for the second one
+	os.WriteFile(filepath.Join(in, "sub", "a.jpg"), data, 0666)
+	stdout.Reset()
+	stderr.Reset()
+	if code := run([]string{"-size", "20x20", "-v", "-o", filepath.Join(dir, "out3"), filepath.Join(in, "a.jpg"), filepath.Join(in, "sub", "a.jpg")}, &stdout, &stderr); code != 1 {
+		t.Errorf("expected exit status 1, got %v", code)
+	}
+	if !strings.Contains(stderr.String(), "is also written for") || !strings.Contains(stderr.String(), "1 of 2 files failed") {
+		t.Errorf("unexpected errors: %v", stderr.String())
+	}
+	if strings.Count(stdout.String(), "\n") != 1 {
+		t.Errorf("unexpected verbose output: %q", stdout.String())
+	}
+
+	for _, args := range [][]string{
+		{"-size", "10x10", in},
+		{"-size", "axb", "-o", out, in},
+		{"-size", "10x10", "-fit", "stretch", "-o", out, in},
+		{"-size", "10x10", "-interpolation", "bicubic", "-o", out, in},
+		{"-size", "10x10", "-pad", "#12", "-o", out, in},
+		{"-size", "10x10", "-format", "gif", "-o", out, in},
+		{"-size", "10x10", "-quality", "101", "-o", out, in},
+		{"-size", "10x10", "-quality", "0", "-o", out, in},
+		{"-size", "10x10", "-j", "0", "-o", out, in},
+		{"-unknown"},
+	} {
+		if code := run(args, &stdout, &stderr); code != 2 {
+			t.Errorf("%v: expected exit status 2, got %v", args, code)
+		}
+	}
+
+	// unknown output extension
+	if code := run([]string{"-size", "10x10", "-o", filepath.Join(dir, "out.xyz"), filepath.Join(in, "a.jpg")}, &stdout, &stderr); code != 1 {
+		t.Errorf("expected exit status 1, got %v", code)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for s, size := range map[string]image.Point{"320x240": {320, 240}, "320x": {320, 0}, "x240": {0, 240}, "320": {320, 0}} {
+		if got, err := parseSize(s); err != nil || got != size {
+			t.Errorf("%q: expected %v, got %v, %v", s, size, got, err)
+		}
+	}
+	for _, s := range []string{"", "x", "0x0", "-1x5", "ax1"} {
+		if _, err := parseSize(s); err == nil {
+			t.Errorf("%q should fail", s)
+		}
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	for s, c := range map[string][]uint8{"#ff8000": {255, 128, 0}, "#01020304": {1, 2, 3, 4}, "1, 2, 3": {1, 2, 3}, "7": {7}} {
+		if got, err := parseColor(s); err != nil || !bytes.Equal(got, c) {
+			t.Errorf("%q: expected %v, got %v, %v", s, c, got, err)
+		}
+	}
+	for _, s := range []string{"#fff", "#gg0000", "1,2", "256,0,0"} {
+		if _, err := parseColor(s); err == nil {
+			t.Errorf("%q should fail", s)
+		}
+	}
+
+	c := &config{pad_color: []uint8{9}}
+	if got := c.padColor(4); !bytes.Equal(got, []uint8{9, 9, 9, 255}) {
+		t.Errorf("unexpected pad color: %v", got)
+	}
+	c.pad_color = []uint8{1, 2, 3, 4}
+	if got := c.padColor(3); !bytes.Equal(got, []uint8{1, 2, 3}) {
+		t.Errorf("unexpected pad color: %v", got)
+	}
+}
@@ -0,0 +1,89 @@
+// Command ippresized is an HTTP service serving the images of a local directory resized
+// according to the parameters in the URL:
+//
+//	GET /w_320,h_240,fit_cover,q_80/path/to/image.jpg
+//
+// See params for the list of parameters. The output format is negotiated by Accept header
+// unless given explicitly, the responses carry ETag and Cache-Control headers. The ETag is derived from
+// the parameters and the size and modification time of the source, so If-None-Match is answered without reading it.
+//
+// With -sign-keys the URLs must be signed by urlsign with one of the keys: /<signature>/<params>/<path>,
+// requests with a missing or invalid signature are rejected with 403 before the source is read.
+// A key is rotated by putting the new key first and removing the old one later.
+//
+// With -cache-dir the responses are kept on the local disk up to -cache-size bytes, keyed by the content
+// of the source, the parameters and the IPP version. Concurrent requests of the same response resize once.
+//
+// Decode, resize and encode counters are served on /metrics in Prometheus text format
+// and published as "ippresize" expvar variable, -metrics=false disables them.
+package main
+
+import (
+	"flag"
+	"github.com/anight/go-ippresize"
+	"github.com/anight/go-ippresize/diskcache"
+	"github.com/anight/go-ippresize/urlsign"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+func main() {
+	listen := flag.String("listen", ":8080", "address to listen on")
+	root := flag.String("root", ".", "directory of the source images")
+	max_bytes := flag.Int64("max-bytes", 50<<20, "size limit of the source file in bytes, 0 means unlimited")
+	max_pixels := flag.Int64("max-pixels", 100000000, "limit of width * height of the source image, 0 means unlimited")
+	max_size := flag.Int("max-size", 4096, "limit of the output width and height")
+	max_age := flag.Duration("max-age", 24*time.Hour, "Cache-Control max-age of the responses")
+	timeout := flag.Duration("timeout", 30*time.Second, "processing time limit of a request, 0 means unlimited")
+	sign_keys := flag.String("sign-keys", os.Getenv("IPPRESIZED_SIGN_KEYS"), "comma separated hex keys of the URL signatures, $IPPRESIZED_SIGN_KEYS by default, unsigned URLs are accepted if empty")
+	cache_dir := flag.String("cache-dir", "", "directory of the response cache, no caching if empty")
+	cache_size := flag.Int64("cache-size", 1<<30, "size limit of the response cache in bytes")
+	metrics := flag.Bool("metrics", true, "serve the metrics on /metrics")
+	flag.Parse()
+
+	s := &server{
+		root:       *root,
+		max_bytes:  *max_bytes,
+		max_pixels: *max_pixels,
+		max_size:   *max_size,
+		max_age:    *max_age,
+		timeout:    *timeout,
+	}
+
+	if *sign_keys != "" {
+		keys, err := urlsign.ParseKeys(*sign_keys)
+		if err != nil {
+			log.Fatalf("-sign-keys: %v", err)
+		}
+		if s.signer, err = urlsign.New(keys...); err != nil {
+			log.Fatalf("-sign-keys: %v", err)
+		}
+	}
+
+	if *metrics {
+		s.metrics = ippresize.NewExpvarMetrics("ippresize")
+		ippresize.SetMetrics(s.metrics)
+	}
+
+	if *cache_dir != "" {
+		var err error
+		if s.cache, err = diskcache.Open(*cache_dir, *cache_size); err != nil {
+			log.Fatalf("-cache-dir: %v", err)
+		}
+	}
+
+	srv := &http.Server{
+		Addr:              *listen,
+		Handler:           s.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+	if *timeout > 0 {
+		srv.WriteTimeout = *timeout + 10*time.Second
+	}
+
+	log.Printf("serving %v on %v", *root, *listen)
+	log.Fatal(srv.ListenAndServe())
+}
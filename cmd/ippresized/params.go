@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/anight/go-ippresize"
+	"image"
+	"strconv"
+	"strings"
+)
+
+// params are the processing parameters given by the first segment of the URL path,
+// comma separated key_value pairs:
+//
+//	w_320        width of the box
+//	h_240        height of the box
+//	fit_cover    fit mode: contain (default), cover, fill, inside, outside
+//	g_top-left   gravity for contain and cover, center by default, smart picks the most detailed crop for cover
+//	crop_entropy scoring of the smart crop: edges (default), entropy or skin
+//	i_lanczos    interpolation, linear by default
+//	q_80         quality of jpeg and webp output 1..100
+//	f_webp       output format: jpeg, png, webp or auto (default) negotiated by Accept header
+//	bg_ff0000    pad color for contain, #rrggbb or #rrggbbaa without #
+type params struct {
+	box           image.Point
+	fit           ippresize.Fit
+	gravity       ippresize.Gravity
+	crop          ippresize.CropStrategy
+	interpolation ippresize.Interpolation
+	quality       int
+	format        ippresize.ImageFormat // ImageFormatUnknown means negotiated
+	pad_color     []uint8
+}
+
+var outputFormats = map[ippresize.ImageFormat]string{
+	ippresize.ImageFormatJPEG: "image/jpeg",
+	ippresize.ImageFormatPNG:  "image/png",
+	ippresize.ImageFormatWebP: "image/webp",
+}
+
+// parseParams parses the parameters, width and height are limited by max_size
+func parseParams(s string, max_size int) (p params, err error) {
+	p.fit = ippresize.FitContain
+	p.gravity = ippresize.GravityCenter
+	p.interpolation = ippresize.InterpolationLinear
+
+	seen := make(map[string]bool)
+
+	for _, kv := range strings.Split(s, ",") {
+		i := strings.IndexByte(kv, '_')
+		if i < 0 {
+			return p, fmt.Errorf("invalid parameter %q", kv)
+		}
+		key, value := kv[:i], kv[i+1:]
+
+		if seen[key] {
+			return p, fmt.Errorf("duplicate parameter %q", key)
+		}
+		seen[key] = true
+
+		switch key {
+		case "w", "h":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 || n > max_size {
+				return p, fmt.Errorf("invalid %v: %q, must be 0..%v", key, value, max_size)
+			}
+			if key == "w" {
+				p.box.X = n
+			} else {
+				p.box.Y = n
+			}
+		case "fit":
+			if p.fit, err = ippresize.ParseFit(value); err != nil {
+				return
+			}
+		case "g":
+			if p.gravity, err = ippresize.ParseGravity(value); err != nil {
+				return
+			}
+		case "crop":
+			if p.crop, err = ippresize.ParseCropStrategy(value); err != nil {
+				return
+			}
+		case "i":
+			if p.interpolation, err = ippresize.ParseInterpolation(value); err != nil {
+				return
+			}
+		case "q":
+			p.quality, err = strconv.Atoi(value)
+			if err != nil || p.quality < 1 || p.quality > 100 {
+				return p, fmt.Errorf("invalid quality %q, must be 1..100", value)
+			}
+		case "f":
+			if value == "auto" {
+				break
+			}
+			p.format, err = ippresize.ParseImageFormat(value)
+			if err != nil || outputFormats[p.format] == "" {
+				return p, fmt.Errorf("unsupported output format %q", value)
+			}
+		case "bg":
+			p.pad_color, err = hex.DecodeString(value)
+			if err != nil || (len(p.pad_color) != 3 && len(p.pad_color) != 4) {
+				return p, fmt.Errorf("invalid color %q", value)
+			}
+		default:
+			return p, fmt.Errorf("unknown parameter %q", key)
+		}
+	}
+
+	if p.box.X == 0 && p.box.Y == 0 {
+		return p, fmt.Errorf("w or h is required")
+	}
+
+	return p, nil
+}
+
+// String returns the canonical form of the parameters: all of them in the fixed order, equal parameters give equal strings
+func (p *params) String() string {
+	s := fmt.Sprintf("w_%v,h_%v,fit_%v,g_%v,i_%v", p.box.X, p.box.Y, p.fit, p.gravity, p.interpolation)
+	if p.gravity == ippresize.GravitySmart {
+		s += fmt.Sprintf(",crop_%v", p.crop)
+	}
+	if p.quality != 0 {
+		s += fmt.Sprintf(",q_%v", p.quality)
+	}
+	if p.format != ippresize.ImageFormatUnknown {
+		s += fmt.Sprintf(",f_%v", p.format)
+	}
+	if p.pad_color != nil {
+		s += fmt.Sprintf(",bg_%x", p.pad_color)
+	}
+	return strings.ToLower(s)
+}
+
+// padColor returns the pad color for the number of channels
+func (p *params) padColor(channels int) []uint8 {
+	if len(p.pad_color) == 4 && channels == 3 {
+		return p.pad_color[:3]
+	}
+	if len(p.pad_color) == 3 && channels == 4 {
+		return append(p.pad_color[:3:3], 255)
+	}
+	return p.pad_color
+}
+
+func (p *params) options(channels int) []ippresize.Option {
+	options := []ippresize.Option{
+		ippresize.WithFit(p.fit),
+		ippresize.WithGravity(p.gravity),
+		ippresize.WithCropStrategy(p.crop),
+		ippresize.WithInterpolation(p.interpolation),
+	}
+	if p.pad_color != nil {
+		options = append(options, ippresize.WithPadding(p.padColor(channels)))
+	}
+	return options
+}
+
+// negotiateFormat picks the output format by the Accept header: WebP if the client accepts it,
+// otherwise the format of the source if it can be encoded, JPEG for the rest
+func negotiateFormat(accept string, source ippresize.ImageFormat) ippresize.ImageFormat {
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		if strings.TrimSpace(fields[0]) != "image/webp" {
+			continue
+		}
+		q := 1.0
+		for _, f := range fields[1:] {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "q=") {
+				q, _ = strconv.ParseFloat(f[2:], 64)
+			}
+		}
+		if q > 0 {
+			return ippresize.ImageFormatWebP
+		}
+	}
+
+	if source == ippresize.ImageFormatPNG {
+		return ippresize.ImageFormatPNG
+	}
+	return ippresize.ImageFormatJPEG
+}
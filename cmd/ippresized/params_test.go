@@ -0,0 +1,65 @@
+package main
+
+import (
+	"github.com/anight/go-ippresize"
+	"image"
+	"testing"
+)
+
+func TestParseParams(t *testing.T) {
+	p, err := parseParams("w_320,h_240,fit_cover,g_top-left,i_antialiasing-lanczos,q_80,f_webp,bg_ff000080", 1000)
+	if err != nil {
+		t.Fatalf("parseParams() failed: %v", err)
+	}
+	if p.box != (image.Point{320, 240}) || p.fit != ippresize.FitCover || p.gravity != ippresize.GravityTopLeft ||
+		p.interpolation != ippresize.InterpolationAntialiasingLanczos || p.quality != 80 || p.format != ippresize.ImageFormatWebP {
+		t.Errorf("unexpected params: %+v", p)
+	}
+	if s := p.String(); s != "w_320,h_240,fit_cover,g_topleft,i_antialiasinglanczos,q_80,f_webp,bg_ff000080" {
+		t.Errorf("unexpected canonical form: %v", s)
+	}
+
+	// canonical form doesn't depend on the order and defaults
+	a, _ := parseParams("h_10,w_20,fit_contain", 1000)
+	b, _ := parseParams("w_20,h_10,f_auto,g_center", 1000)
+	if a.String() != b.String() {
+		t.Errorf("%v != %v", a.String(), b.String())
+	}
+
+	// the crop strategy matters for smart gravity only
+	a, _ = parseParams("w_20,g_smart", 1000)
+	b, _ = parseParams("w_20,g_smart,crop_edges", 1000)
+	c, _ := parseParams("w_20,g_smart,crop_skin", 1000)
+	if a.String() != b.String() || a.String() == c.String() || c.crop != ippresize.CropSkin {
+		t.Errorf("unexpected canonical forms: %v, %v, %v", a.String(), b.String(), c.String())
+	}
+	a, _ = parseParams("w_20,crop_entropy", 1000)
+	if a.String() != "w_20,h_0,fit_contain,g_center,i_linear" {
+		t.Errorf("unexpected canonical form: %v", a.String())
+	}
+
+	for _, s := range []string{"", "w_", "crop_x,w_1", "w_-1", "w_1001", "w_10,w_20", "h_0", "q_0,w_1", "f_gif,w_1", "bg_fff,w_1", "fit_x,w_1", "g_x,w_1", "i_x,w_1", "zoom_2,w_1", "w10"} {
+		if _, err := parseParams(s, 1000); err == nil {
+			t.Errorf("%q should fail", s)
+		}
+	}
+}
+
+func TestNegotiateFormat(t *testing.T) {
+	for _, tc := range []struct {
+		accept string
+		source ippresize.ImageFormat
+		format ippresize.ImageFormat
+	}{
+		{"image/webp,*/*", ippresize.ImageFormatJPEG, ippresize.ImageFormatWebP},
+		{"image/avif, image/webp;q=0.9", ippresize.ImageFormatPNG, ippresize.ImageFormatWebP},
+		{"image/webp;q=0", ippresize.ImageFormatJPEG, ippresize.ImageFormatJPEG},
+		{"", ippresize.ImageFormatPNG, ippresize.ImageFormatPNG},
+		{"*/*", ippresize.ImageFormatGIF, ippresize.ImageFormatJPEG},
+		{"image/*", ippresize.ImageFormatWebP, ippresize.ImageFormatJPEG},
+	} {
+		if f := negotiateFormat(tc.accept, tc.source); f != tc.format {
+			t.Errorf("%q %v: expected %v, got %v", tc.accept, tc.source, tc.format, f)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/anight/go-ippresize"
+	"github.com/anight/go-ippresize/diskcache"
+	"github.com/anight/go-ippresize/urlsign"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// server serves the images of the root directory resized according to the URL: /<params>/<path>, see params,
+// with the signer set the URL must be signed: /<signature>/<params>/<path>, see urlsign
+type server struct {
+	root       string
+	signer     *urlsign.Signer          // verifies the signatures of the URLs, unsigned URLs are accepted if nil
+	cache      *diskcache.Cache         // keeps the responses, nil disables caching
+	metrics    *ippresize.ExpvarMetrics // served on /metrics unless nil
+	max_bytes  int64                    // size limit of the source file
+	max_pixels int64                    // limit of width * height of the source image
+	max_size   int                      // limit of the output width and height
+	max_age    time.Duration            // Cache-Control max-age of the responses
+	timeout    time.Duration            // processing time limit of a request, unlimited if 0
+
+	mu     sync.Mutex
+	shared map[string]*sharedResize // running resizes of the cache by the key
+}
+
+// sharedResize is a resize coalescing the requests of the same cache key
+type sharedResize struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	waiters int
+}
+
+// httpError is an error with the status of the response
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e *httpError) Error() string {
+	return e.err.Error()
+}
+
+func newHTTPError(status int, format string, args ...interface{}) error {
+	return &httpError{status: status, err: fmt.Errorf(format, args...)}
+}
+
+// handler returns the handler of the server with the timeout applied and the metrics on /metrics
+func (s *server) handler() http.Handler {
+	var h http.Handler = s
+	if s.timeout > 0 {
+		h = http.TimeoutHandler(s, s.timeout, "processing timeout")
+	}
+	if s.metrics == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/metrics" {
+			s.serveMetrics(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// serveMetrics writes the metrics in Prometheus text format
+func (s *server) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := s.metrics.WritePrometheus(w); err != nil {
+		log.Printf("%v: %v", r.URL.Path, err)
+	}
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := s.serve(w, r); err != nil {
+		var e *httpError
+		if errors.As(err, &e) {
+			http.Error(w, e.Error(), e.status)
+			return
+		}
+		log.Printf("%v: %v", r.URL.Path, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// open opens the source file by the slash separated path relative to the root
+func (s *server) open(name string) (f *os.File, fi os.FileInfo, err error) {
+	file := filepath.Join(s.root, filepath.FromSlash(path.Clean("/"+name)))
+
+	f, err = os.Open(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, newHTTPError(http.StatusNotFound, "not found")
+	}
+	if err != nil {
+		return
+	}
+
+	fi, err = f.Stat()
+	if err == nil && fi.IsDir() {
+		err = newHTTPError(http.StatusNotFound, "not found")
+	}
+	if err == nil && s.max_bytes > 0 && fi.Size() > s.max_bytes {
+		err = newHTTPError(http.StatusUnprocessableEntity, "source image is too large: %v bytes", fi.Size())
+	}
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return
+}
+
+// sourceETag returns the validator of the response by the source file metadata and the output parameters,
+// so conditional requests are answered without reading the source
+func sourceETag(name string, fi os.FileInfo, params string) string {
+	key := ippresize.CacheKey([]byte(fmt.Sprintf("%v\n%v\n%v", name, fi.Size(), fi.ModTime().UnixNano())), params)
+	return `"` + key[:32] + `"`
+}
+
+// etagMatch checks whether If-None-Match header value matches the etag
+func etagMatch(if_none_match string, etag string) bool {
+	for _, tag := range strings.Split(if_none_match, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// resize produces the output image of the format, the processing stops when ctx is done
+func resize(ctx context.Context, data []byte, p *params, format ippresize.ImageFormat) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if format == ippresize.ImageFormatJPEG {
+		_, err := ippresize.ResizeJpegContext(ctx, bytes.NewReader(data), &buf, p.box, &ippresize.JpegOptions{Quality: p.quality}, p.options(3)...)
+		return buf.Bytes(), err
+	}
+
+	options := append(p.options(4), ippresize.WithSize(p.box), ippresize.WithFormat(ippresize.PixelFormatRGBA))
+	r, err := ippresize.ThumbnailContext(ctx, bytes.NewReader(data), options...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.Encode(&buf, format, p.quality)
+	return buf.Bytes(), err
+}
+
+// join returns the context of the shared resize of the key and the function leaving it,
+// the resize is canceled when all the requests leave it or after the timeout
+func (s *server) join(key string) (ctx context.Context, leave func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sh, ok := s.shared[key]
+	if !ok {
+		sh = &sharedResize{}
+		if s.timeout > 0 {
+			sh.ctx, sh.cancel = context.WithTimeout(context.Background(), s.timeout)
+		} else {
+			sh.ctx, sh.cancel = context.WithCancel(context.Background())
+		}
+		if s.shared == nil {
+			s.shared = make(map[string]*sharedResize)
+		}
+		s.shared[key] = sh
+	}
+	sh.waiters++
+
+	return sh.ctx, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if sh.waiters--; sh.waiters == 0 {
+			sh.cancel()
+			delete(s.shared, key)
+		}
+	}
+}
+
+// resizeShared resizes through the cache, the coalesced requests wait for one resize
+// which runs while any of them waits
+func (s *server) resizeShared(ctx context.Context, key string, data []byte, p *params, format ippresize.ImageFormat) ([]byte, error) {
+	shared_ctx, leave := s.join(key)
+	defer leave()
+
+	type result struct {
+		out []byte
+		err error
+	}
+
+	for {
+		ch := make(chan result, 1)
+		go func() {
+			out, _, err := s.cache.Do(key, func() ([]byte, error) {
+				return resize(shared_ctx, data, p, format)
+			})
+			ch <- result{out, err}
+		}()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case res := <-ch:
+			// joined the resize abandoned by the earlier requests, run it again
+			if errors.Is(res.err, context.Canceled) && shared_ctx.Err() == nil && ctx.Err() == nil {
+				continue
+			}
+			return res.out, res.err
+		}
+	}
+}
+
+func (s *server) serve(w http.ResponseWriter, r *http.Request) error {
+	url_path := r.URL.Path
+	if s.signer != nil {
+		var err error
+		if url_path, err = s.signer.VerifyPath(url_path); err != nil {
+			return &httpError{status: http.StatusForbidden, err: err}
+		}
+	}
+
+	params_str, name, found := strings.Cut(strings.TrimPrefix(url_path, "/"), "/")
+	if !found || name == "" {
+		return newHTTPError(http.StatusNotFound, "not found")
+	}
+
+	p, err := parseParams(params_str, s.max_size)
+	if err != nil {
+		return &httpError{status: http.StatusBadRequest, err: err}
+	}
+
+	f, fi, err := s.open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// without webp the negotiated format follows the source format, which is fixed by the source file metadata
+	format_key := p.format.String()
+	if p.format == ippresize.ImageFormatUnknown {
+		format_key = "auto"
+		if negotiateFormat(r.Header.Get("Accept"), ippresize.ImageFormatUnknown) == ippresize.ImageFormatWebP {
+			format_key = "webp"
+		}
+		w.Header().Set("Vary", "Accept")
+	}
+
+	etag := sourceETag(path.Clean("/"+name), fi, p.String()+"\n"+format_key)
+
+	// set only on success, errors must not be cached by the clients
+	cache_headers := func() {
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(s.max_age.Seconds())))
+		w.Header().Set("Last-Modified", fi.ModTime().UTC().Format(http.TimeFormat))
+	}
+
+	if etagMatch(r.Header.Get("If-None-Match"), etag) {
+		cache_headers()
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+
+	size, source_format, err := ippresize.SniffSize(data)
+	if err != nil {
+		return newHTTPError(http.StatusUnprocessableEntity, "unsupported source image: %v", err)
+	}
+	if s.max_pixels > 0 && int64(size.X)*int64(size.Y) > s.max_pixels {
+		return newHTTPError(http.StatusUnprocessableEntity, "source image is too large: %vx%v", size.X, size.Y)
+	}
+
+	format := p.format
+	if format == ippresize.ImageFormatUnknown {
+		format = negotiateFormat(r.Header.Get("Accept"), source_format)
+	}
+
+	key := ippresize.CacheKey(data, p.String()+"\n"+format.String())
+
+	var out []byte
+	if s.cache != nil {
+		out, err = s.resizeShared(r.Context(), key, data, &p, format)
+	} else {
+		out, err = resize(r.Context(), data, &p, format)
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return &httpError{status: http.StatusServiceUnavailable, err: err}
+	}
+	if err != nil {
+		return newHTTPError(http.StatusUnprocessableEntity, "can't process the image: %v", err)
+	}
+
+	cache_headers()
+	w.Header().Set("Content-Type", outputFormats[format])
+	w.Header().Set("Content-Length", strconv.Itoa(len(out)))
+	w.WriteHeader(http.StatusOK)
+
+	if r.Method != http.MethodHead {
+		w.Write(out)
+	}
+
+	return nil
+}
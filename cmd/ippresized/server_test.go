@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/anight/go-ippresize"
+	"github.com/anight/go-ippresize/diskcache"
+	"github.com/anight/go-ippresize/urlsign"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T) (*server, *httptest.Server) {
+	data, err := os.ReadFile("../../test.jpg")
+	if err != nil {
+		t.Fatalf("os.ReadFile() failed: %v", err)
+	}
+
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "photos"), 0777)
+	os.WriteFile(filepath.Join(root, "photos", "test.jpg"), data, 0666)
+	os.WriteFile(filepath.Join(root, "broken.jpg"), []byte("garbage"), 0666)
+
+	im := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	for i := range im.Pix {
+		im.Pix[i] = 200
+	}
+	im.Set(0, 0, color.NRGBA{0, 0, 0, 0})
+	var buf bytes.Buffer
+	png.Encode(&buf, im)
+	os.WriteFile(filepath.Join(root, "alpha.png"), buf.Bytes(), 0666)
+
+	s := &server{root: root, max_bytes: 1 << 20, max_pixels: 1000000, max_size: 1000, max_age: time.Hour}
+	ts := httptest.NewServer(s.handler())
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+func get(t *testing.T, url string, header map[string]string) (*http.Response, []byte) {
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET %v failed: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, body
+}
+
+func TestServer(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	resp, body := get(t, ts.URL+"/w_100,h_100,fit_cover,q_80/photos/test.jpg", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %v: %s", resp.Status, body)
+	}
+	if resp.Header.Get("Content-Type") != "image/jpeg" || resp.Header.Get("Vary") != "Accept" {
+		t.Errorf("unexpected headers: %v", resp.Header)
+	}
+	if resp.Header.Get("Cache-Control") != "public, max-age=3600" || resp.Header.Get("Last-Modified") == "" {
+		t.Errorf("unexpected caching headers: %v", resp.Header)
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(body))
+	if err != nil || format != "jpeg" || config.Width != 100 || config.Height != 100 {
+		t.Errorf("unexpected image: %v %+v %v", format, config, err)
+	}
+
+	// revalidation
+	etag := resp.Header.Get("ETag")
+	resp, _ = get(t, ts.URL+"/w_100,h_100,fit_cover,q_80/photos/test.jpg", map[string]string{"If-None-Match": etag})
+	if resp.StatusCode != http.StatusNotModified || resp.Header.Get("ETag") != etag {
+		t.Errorf("expected 304, got %v, etag %v", resp.Status, resp.Header.Get("ETag"))
+	}
+
+	// the same parameters in another order give the same etag
+	resp, _ = get(t, ts.URL+"/q_80,fit_cover,h_100,w_100/photos/test.jpg", nil)
+	if resp.Header.Get("ETag") != etag {
+		t.Errorf("etag depends on the order of parameters")
+	}
+
+	// negotiated formats
+	resp, body = get(t, ts.URL+"/w_50/photos/test.jpg", map[string]string{"Accept": "image/avif,image/webp,*/*"})
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "image/webp" || ippresize.SniffFormat(body) != ippresize.ImageFormatWebP {
+		t.Errorf("expected webp, got %v %v", resp.Status, resp.Header.Get("Content-Type"))
+	}
+	if resp.Header.Get("ETag") == "" || resp.Header.Get("ETag") == etag {
+		t.Errorf("unexpected etag %v", resp.Header.Get("ETag"))
+	}
+
+	resp, body = get(t, ts.URL+"/w_20/alpha.png", map[string]string{"Accept": "image/webp;q=0, image/*"})
+	if resp.Header.Get("Content-Type") != "image/png" {
+		t.Errorf("expected png, got %v", resp.Header.Get("Content-Type"))
+	}
+	if im, err := png.Decode(bytes.NewReader(body)); err != nil || im.Bounds().Size() != (image.Point{20, 10}) {
+		t.Errorf("unexpected png: %v", err)
+	} else if _, _, _, a := im.At(0, 0).RGBA(); a == 0xffff {
+		t.Errorf("alpha channel is lost")
+	}
+
+	// explicit format
+	resp, _ = get(t, ts.URL+"/w_20,f_png,bg_ff0000/photos/test.jpg", map[string]string{"Accept": "image/webp"})
+	if resp.Header.Get("Content-Type") != "image/png" || resp.Header.Get("Vary") != "" {
+		t.Errorf("unexpected headers: %v", resp.Header)
+	}
+
+	// HEAD
+	req, _ := http.NewRequest(http.MethodHead, ts.URL+"/w_20/photos/test.jpg", nil)
+	hresp, err := http.DefaultClient.Do(req)
+	if err != nil || hresp.StatusCode != http.StatusOK || hresp.ContentLength <= 0 {
+		t.Errorf("unexpected HEAD response: %v %v", hresp, err)
+	}
+
+	for _, tc := range []struct {
+		path   string
+		status int
+	}{
+		{"/w_20/photos/missing.jpg", http.StatusNotFound},
+		{"/w_20/photos", http.StatusNotFound},
+		{"/w_20/", http.StatusNotFound},
+		{"/w_20/../../../etc/passwd", http.StatusNotFound},
+		{"/w_2000/photos/test.jpg", http.StatusBadRequest},
+		{"/x_1/photos/test.jpg", http.StatusBadRequest},
+		{"/fit_cover/photos/test.jpg", http.StatusBadRequest},
+		{"/w_20/broken.jpg", http.StatusUnprocessableEntity},
+	} {
+		if resp, body := get(t, ts.URL+tc.path, nil); resp.StatusCode != tc.status {
+			t.Errorf("%v: expected %v, got %v: %s", tc.path, tc.status, resp.StatusCode, body)
+		}
+	}
+
+	req, _ = http.NewRequest(http.MethodPost, ts.URL+"/w_20/photos/test.jpg", strings.NewReader(""))
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST should not be allowed: %v %v", resp, err)
+	}
+}
+
+func TestServerRevalidation(t *testing.T) {
+	s, ts := newTestServer(t)
+
+	resp, _ := get(t, ts.URL+"/w_50/photos/test.jpg", nil)
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || etag == "" {
+		t.Fatalf("unexpected response %v, etag %v", resp.Status, etag)
+	}
+
+	// the same size and modification time, the source is not read to revalidate
+	file := filepath.Join(s.root, "photos", "test.jpg")
+	fi, _ := os.Stat(file)
+	os.WriteFile(file, bytes.Repeat([]byte{'x'}, int(fi.Size())), 0666)
+	os.Chtimes(file, fi.ModTime(), fi.ModTime())
+
+	resp, _ = get(t, ts.URL+"/w_50/photos/test.jpg", map[string]string{"If-None-Match": etag})
+	if resp.StatusCode != http.StatusNotModified || resp.Header.Get("ETag") != etag {
+		t.Errorf("expected 304, got %v, etag %v", resp.Status, resp.Header.Get("ETag"))
+	}
+	if resp, _ := get(t, ts.URL+"/w_50/photos/test.jpg", nil); resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422, got %v", resp.Status)
+	}
+
+	// modified source
+	data, _ := os.ReadFile("../../test.jpg")
+	os.WriteFile(file, data, 0666)
+	os.Chtimes(file, fi.ModTime().Add(time.Second), fi.ModTime().Add(time.Second))
+	resp, _ = get(t, ts.URL+"/w_50/photos/test.jpg", map[string]string{"If-None-Match": etag})
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == etag {
+		t.Errorf("expected 200 with a new etag, got %v, etag %v", resp.Status, resp.Header.Get("ETag"))
+	}
+}
+
+func TestServerLimits(t *testing.T) {
+	s, ts := newTestServer(t)
+
+	s.max_pixels = 566*850 - 1
+	if resp, _ := get(t, ts.URL+"/w_20/photos/test.jpg", nil); resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("pixel limit: expected 422, got %v", resp.Status)
+	}
+	s.max_pixels = 0
+
+	s.max_bytes = 1000
+	if resp, _ := get(t, ts.URL+"/w_20/photos/test.jpg", nil); resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("size limit: expected 422, got %v", resp.Status)
+	}
+	s.max_bytes = 0
+
+	// the header is valid, the decoding fails
+	data, _ := os.ReadFile(filepath.Join(s.root, "alpha.png"))
+	os.WriteFile(filepath.Join(s.root, "truncated.png"), data[:50], 0666)
+	resp, _ := get(t, ts.URL+"/w_20/truncated.png", nil)
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("truncated image: expected 422, got %v", resp.Status)
+	}
+	if resp.Header.Get("ETag") != "" || resp.Header.Get("Cache-Control") != "" {
+		t.Errorf("errors should not be cacheable: %v", resp.Header)
+	}
+
+	s.timeout = time.Nanosecond
+	ts = httptest.NewServer(s.handler())
+	defer ts.Close()
+	if resp, _ := get(t, ts.URL+"/w_20/photos/test.jpg", nil); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("timeout: expected 503, got %v", resp.Status)
+	}
+}
+
+func TestServerCanceled(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, path := range []string{"/w_20/photos/test.jpg", "/w_20,f_png/photos/test.jpg"} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx))
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("%v: expected 503, got %v", path, w.Code)
+		}
+		if w.Header().Get("ETag") != "" || w.Header().Get("Cache-Control") != "" {
+			t.Errorf("%v: errors should not be cacheable: %v", path, w.Header())
+		}
+	}
+}
+
+func TestServerSigned(t *testing.T) {
+	s, ts := newTestServer(t)
+
+	old_signer, _ := urlsign.New([]byte("old key"))
+	s.signer, _ = urlsign.New([]byte("new key"), []byte("old key"))
+
+	for _, signer := range []*urlsign.Signer{s.signer, old_signer} {
+		resp, body := get(t, signer.URL(ts.URL, "/w_100,h_100/photos/test.jpg"), nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("unexpected status %v: %s", resp.Status, body)
+		}
+	}
+
+	// params and path are signed
+	signature := s.signer.Sign("/w_100,h_100/photos/test.jpg")
+	other, _ := urlsign.New([]byte("other key"))
+
+	for _, path := range []string{
+		"/w_100,h_100/photos/test.jpg",
+		"/" + signature + "/w_100,h_101/photos/test.jpg",
+		"/" + signature + "/w_100,h_100/test.jpg",
+		other.SignPath("/w_100,h_100/photos/test.jpg"),
+		// rejected before the source is looked at
+		"/" + signature + "/w_100,h_100/missing.jpg",
+		other.SignPath("/w_100,h_100/broken.jpg"),
+		other.SignPath("/w_100000,h_100/photos/test.jpg"),
+	} {
+		if resp, body := get(t, ts.URL+path, nil); resp.StatusCode != http.StatusForbidden {
+			t.Errorf("%v: expected 403, got %v: %s", path, resp.Status, body)
+		}
+	}
+
+	// signed URLs are still checked as unsigned ones
+	if resp, _ := get(t, s.signer.URL(ts.URL, "/w_100,h_100/missing.jpg"), nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404, got %v", resp.Status)
+	}
+}
+
+func TestServerCache(t *testing.T) {
+	s, ts := newTestServer(t)
+
+	var err error
+	if s.cache, err = diskcache.Open(t.TempDir(), 1<<20); err != nil {
+		t.Fatalf("diskcache.Open() failed: %v", err)
+	}
+
+	resp, body := get(t, ts.URL+"/w_100,h_100/photos/test.jpg", nil)
+	if resp.StatusCode != http.StatusOK || s.cache.Len() != 1 {
+		t.Fatalf("unexpected status %v, %v cache entries", resp.Status, s.cache.Len())
+	}
+
+	// the same parameters in another order hit the cache
+	resp2, body2 := get(t, ts.URL+"/h_100,w_100/photos/test.jpg", nil)
+	if resp2.StatusCode != http.StatusOK || !bytes.Equal(body, body2) || s.cache.Len() != 1 {
+		t.Errorf("expected a cache hit, got %v, %v cache entries", resp2.Status, s.cache.Len())
+	}
+
+	// other negotiated format is another entry
+	resp, _ = get(t, ts.URL+"/w_100,h_100/photos/test.jpg", map[string]string{"Accept": "image/webp"})
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "image/webp" || s.cache.Len() != 2 {
+		t.Errorf("unexpected response %v %v, %v cache entries", resp.Status, resp.Header.Get("Content-Type"), s.cache.Len())
+	}
+
+	// failures are not cached
+	if resp, _ := get(t, ts.URL+"/w_100/broken.jpg", nil); resp.StatusCode != http.StatusUnprocessableEntity || s.cache.Len() != 2 {
+		t.Errorf("unexpected response %v, %v cache entries", resp.Status, s.cache.Len())
+	}
+
+	// a canceled request doesn't wait for the shared resize
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/w_50/photos/test.jpg", nil).WithContext(ctx))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %v", w.Code)
+	}
+}
+
+func TestServerShared(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	ctx1, leave1 := s.join("key")
+	ctx2, leave2 := s.join("key")
+	if ctx1 != ctx2 {
+		t.Fatalf("the requests of the same key should share the resize")
+	}
+	leave1()
+	if ctx2.Err() != nil {
+		t.Errorf("the resize should run while a request waits: %v", ctx2.Err())
+	}
+	leave2()
+	if ctx2.Err() != context.Canceled || len(s.shared) != 0 {
+		t.Errorf("the resize should be canceled when all the requests leave: %v, %v shared", ctx2.Err(), len(s.shared))
+	}
+
+	// the next request starts a new one bound by the timeout
+	s.timeout = time.Hour
+	ctx3, leave3 := s.join("key")
+	defer leave3()
+	if ctx3.Err() != nil {
+		t.Errorf("unexpected error: %v", ctx3.Err())
+	}
+	if _, ok := ctx3.Deadline(); !ok {
+		t.Errorf("the resize should be bound by the timeout")
+	}
+}
+
+func TestServerMetrics(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	s.metrics = ippresize.NewExpvarMetrics("")
+	ippresize.SetMetrics(s.metrics)
+	defer ippresize.SetMetrics(nil)
+
+	ts := httptest.NewServer(s.handler())
+	defer ts.Close()
+
+	if resp, body := get(t, ts.URL+"/w_100,h_100,f_png/photos/test.jpg", nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %v: %s", resp.Status, body)
+	}
+
+	resp, body := get(t, ts.URL+"/metrics", nil)
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Fatalf("unexpected response %v %v", resp.Status, resp.Header)
+	}
+	for _, line := range []string{
+		`ippresize_decode_total{format="JPEG"} 1`,
+		`ippresize_resize_total{interpolation="Linear"} 1`,
+		`ippresize_encode_pixels_total{format="PNG"} 10000`,
+	} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, body)
+		}
+	}
+}
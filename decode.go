@@ -0,0 +1,128 @@
+package ippresize
+
+//go:generate stringer -type=DCTMethod -trimprefix DCT
+
+import (
+	"github.com/anight/go-libjpeg/jpeg"
+	"image"
+	"image/color"
+	"math"
+)
+
+// DCTMethod selects libjpeg inverse DCT implementation
+type DCTMethod int
+
+const (
+	DCTIFast DCTMethod = iota // fast integer, less accurate, the default
+	DCTISlow                  // accurate integer, matches most other decoders
+	DCTFloat                  // floating point
+)
+
+// DecodeOptions control decoding of jpeg images by JpegTo*() functions, nil means defaults
+type DecodeOptions struct {
+	DCTMethod              DCTMethod
+	DisableFancyUpsampling bool // use pixel replication instead of smooth upsampling of chroma
+	DisableBlockSmoothing  bool // disable block smoothing of early progressive scans
+
+	// The image is prescaled by libjpeg to the smallest of 1/8..8/8 scales keeping it at least
+	// as large as needed for the output. ScaleHeadroom > 1 keeps it at least that many times larger,
+	// leaving the interpolation more source pixels, values below 1 mean 1.
+	ScaleHeadroom float64
+	// MaxPrescale limits libjpeg prescaling to 1/MaxPrescale of the original size, 1 disables prescaling.
+	// Values outside of 1..8 mean 8.
+	MaxPrescale int
+
+	DisableAutoOrient bool // ignore exif orientation
+
+	// ColorManagement converts jpeg images with matrix/TRC RGB ICC profiles and CMYK images to sRGB
+	ColorManagement bool
+
+	Background color.Color // images with alpha channel are composed over it unless decoded to RGBA, white if nil
+
+	// MaxPixels limits width * height of PNG, GIF and BMP images, which are decoded at full size.
+	// 0 means DefaultMaxPixels, negative values disable the limit.
+	MaxPixels int64
+}
+
+// DefaultMaxPixels is the limit of width * height of PNG, GIF and BMP images unless DecodeOptions set another one
+const DefaultMaxPixels = 100000000
+
+func (o *DecodeOptions) dctMethod() jpeg.DCTMethod {
+	if o == nil {
+		return jpeg.DCTIFast
+	}
+	switch o.DCTMethod {
+	case DCTISlow:
+		return jpeg.DCTISlow
+	case DCTFloat:
+		return jpeg.DCTFloat
+	}
+	return jpeg.DCTIFast
+}
+
+// decoderOptions returns libjpeg options for decoding the image prescaled to at least target size
+func (o *DecodeOptions) decoderOptions(colorspace jpeg.OutColorSpace, target image.Point) *jpeg.DecoderOptions {
+	options := &jpeg.DecoderOptions{
+		OutColorSpace: colorspace,
+		ScaleTarget:   image.Rectangle{Max: target},
+		DCTMethod:     o.dctMethod(),
+	}
+	if o != nil {
+		options.DisableFancyUpsampling = o.DisableFancyUpsampling
+		options.DisableBlockSmoothing = o.DisableBlockSmoothing
+	}
+	return options
+}
+
+// scaleTarget applies the scale policy to the target size for the image with orig_size dimensions
+func (o *DecodeOptions) scaleTarget(orig_size image.Point, target image.Point) image.Point {
+	if o == nil {
+		return target
+	}
+
+	if o.ScaleHeadroom > 1 {
+		target.X = int(math.Ceil(float64(target.X) * o.ScaleHeadroom))
+		target.Y = int(math.Ceil(float64(target.Y) * o.ScaleHeadroom))
+	}
+
+	if o.MaxPrescale >= 1 && o.MaxPrescale < 8 {
+		if min := (orig_size.X + o.MaxPrescale - 1) / o.MaxPrescale; target.X < min {
+			target.X = min
+		}
+		if min := (orig_size.Y + o.MaxPrescale - 1) / o.MaxPrescale; target.Y < min {
+			target.Y = min
+		}
+	}
+
+	// libjpeg never scales up
+	if target.X > orig_size.X {
+		target.X = orig_size.X
+	}
+	if target.Y > orig_size.Y {
+		target.Y = orig_size.Y
+	}
+
+	return target
+}
+
+func (o *DecodeOptions) autoOrient() bool {
+	return o == nil || !o.DisableAutoOrient
+}
+
+func (o *DecodeOptions) colorManagement() bool {
+	return o != nil && o.ColorManagement
+}
+
+func (o *DecodeOptions) background() color.Color {
+	if o == nil || o.Background == nil {
+		return color.White
+	}
+	return o.Background
+}
+
+func (o *DecodeOptions) maxPixels() int64 {
+	if o == nil || o.MaxPixels == 0 {
+		return DefaultMaxPixels
+	}
+	return o.MaxPixels
+}
@@ -0,0 +1,77 @@
+package ippresize
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"os"
+	"testing"
+)
+
+func TestDecodeOptionsScaleTarget(t *testing.T) {
+	orig_size := image.Point{800, 600}
+	tests := []struct {
+		opts     *DecodeOptions
+		target   image.Point
+		expected image.Point
+	}{
+		{nil, image.Point{100, 75}, image.Point{100, 75}},
+		{&DecodeOptions{}, image.Point{100, 75}, image.Point{100, 75}},
+		{&DecodeOptions{ScaleHeadroom: 2}, image.Point{100, 75}, image.Point{200, 150}},
+		{&DecodeOptions{ScaleHeadroom: 0.5}, image.Point{100, 75}, image.Point{100, 75}},
+		{&DecodeOptions{ScaleHeadroom: 4}, image.Point{300, 300}, image.Point{800, 600}},
+		{&DecodeOptions{MaxPrescale: 2}, image.Point{100, 75}, image.Point{400, 300}},
+		{&DecodeOptions{MaxPrescale: 1}, image.Point{100, 75}, image.Point{800, 600}},
+		{&DecodeOptions{MaxPrescale: 3, ScaleHeadroom: 2}, image.Point{100, 200}, image.Point{267, 400}},
+	}
+	for _, item := range tests {
+		if target := item.opts.scaleTarget(orig_size, item.target); target != item.expected {
+			t.Errorf("%+v: expected %v, got %v", item.opts, item.expected, target)
+		}
+	}
+}
+
+func TestDecodeOptions(t *testing.T) {
+	data, err := os.ReadFile("./test.jpg")
+	if err != nil {
+		t.Fatalf("os.ReadFile() failed: %v", err)
+	}
+
+	box := image.Point{100, 100}
+
+	var transform Transform
+	_, _, err = JpegToFitGray(bytes.NewReader(data), box, FitContain, nil, InterpolationLinear, &transform)
+	if err != nil {
+		t.Fatalf("JpegToFitGray() failed: %v", err)
+	}
+	decoded_size := transform.DecodedSize
+
+	for _, method := range []DCTMethod{DCTIFast, DCTISlow, DCTFloat} {
+		opts := DecodeOptions{DCTMethod: method, DisableFancyUpsampling: true, ScaleHeadroom: 2}
+		_, _, err = JpegToFitGrayContext(context.Background(), bytes.NewReader(data), box, FitContain, nil, InterpolationLinear, &transform, &opts)
+		if err != nil {
+			t.Fatalf("JpegToFitGrayContext(%v) failed: %v", method, err)
+		}
+		if transform.DecodedSize.Y < 2*box.Y || transform.DecodedSize.Y <= decoded_size.Y {
+			t.Errorf("%v: headroom is not applied, DecodedSize=%v", method, transform.DecodedSize)
+		}
+	}
+
+	_, _, err = JpegToFitGrayContext(context.Background(), bytes.NewReader(data), box, FitContain, nil, InterpolationLinear, &transform, &DecodeOptions{MaxPrescale: 1})
+	if err != nil {
+		t.Fatalf("JpegToFitGrayContext() failed: %v", err)
+	}
+	if transform.DecodedSize != transform.OrigSize {
+		t.Errorf("prescaling is not disabled, DecodedSize=%v", transform.DecodedSize)
+	}
+
+	rotated := withExifOrientation(data, binary.LittleEndian, OrientationRotate270)
+	_, size, err := JpegToGrayContext(context.Background(), bytes.NewReader(rotated), box, InterpolationLinear, &DecodeOptions{DisableAutoOrient: true})
+	if err != nil {
+		t.Fatalf("JpegToGrayContext() failed: %v", err)
+	}
+	if size.X >= size.Y {
+		t.Errorf("exif orientation should be ignored: %v", size)
+	}
+}
@@ -0,0 +1,281 @@
+// Package diskcache is a size-capped cache of byte blobs stored as files in a local directory.
+//
+// Entries are evicted in least recently used order when the total size exceeds the cap, the order
+// survives restarts through file modification times. Concurrent Do calls with the same key are coalesced,
+// so the value is produced once.
+package diskcache
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const tempSuffix = ".tmp"
+
+var errFillPanicked = errors.New("diskcache: fill function panicked")
+
+// Cache stores entries as dir/<first 2 characters of the key>/<key>
+type Cache struct {
+	dir      string
+	max_size int64
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List // of *entry, the most recently used first
+	entries map[string]*list.Element
+	calls   map[string]*call
+}
+
+type entry struct {
+	key  string
+	size int64
+}
+
+// call is a fill in progress, waiters get its outcome
+type call struct {
+	wg   sync.WaitGroup
+	data []byte
+	err  error
+}
+
+// Open opens the cache in the directory creating it if needed, max_size is the cap of the total size of the entries in bytes.
+// Existing entries are loaded in the order of their modification times and evicted down to max_size.
+func Open(dir string, max_size int64) (*Cache, error) {
+	if max_size <= 0 {
+		return nil, fmt.Errorf("diskcache: invalid size cap %v", max_size)
+	}
+
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+
+	c := &Cache{
+		dir:      dir,
+		max_size: max_size,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+		calls:    make(map[string]*call),
+	}
+
+	type file struct {
+		entry
+		mod_time time.Time
+	}
+	var files []file
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if strings.HasSuffix(path, tempSuffix) {
+			// left by an interrupted Put
+			os.Remove(path)
+			return nil
+		}
+		key := d.Name()
+		if !validKey(key) || path != c.path(key) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, file{entry{key, info.Size()}, info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].mod_time.Before(files[j].mod_time) })
+
+	for i := range files {
+		e := files[i].entry
+		c.entries[e.key] = c.lru.PushFront(&e)
+		c.size += e.size
+	}
+	c.evict()
+
+	return c, nil
+}
+
+// validKey allows keys safe to be used as file names
+func validKey(key string) bool {
+	if len(key) < 2 || len(key) > 200 || strings.HasSuffix(key, tempSuffix) {
+		return false
+	}
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return key != ".." && !strings.HasPrefix(key, ".")
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+// remove drops the entry, c.mu must be held
+func (c *Cache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*entry)
+	delete(c.entries, e.key)
+	c.size -= e.size
+	os.Remove(c.path(e.key))
+}
+
+// evict removes the least recently used entries until the size fits the cap, c.mu must be held
+func (c *Cache) evict() {
+	for c.size > c.max_size {
+		c.remove(c.lru.Back())
+	}
+}
+
+// Get returns the data of the entry and marks it as recently used
+func (c *Cache) Get(key string) ([]byte, bool) {
+	if !validKey(key) {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	el, ok := c.entries[key]
+	if ok {
+		c.lru.MoveToFront(el)
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		return nil, false
+	}
+
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		// removed behind our back
+		c.mu.Lock()
+		if c.entries[key] == el {
+			c.remove(el)
+		}
+		c.mu.Unlock()
+		return nil, false
+	}
+
+	now := time.Now()
+	os.Chtimes(c.path(key), now, now)
+
+	return data, true
+}
+
+// Put stores the entry evicting the least recently used ones if needed, data larger than the cap is not stored
+func (c *Cache) Put(key string, data []byte) error {
+	if !validKey(key) {
+		return fmt.Errorf("diskcache: invalid key %q", key)
+	}
+	if int64(len(data)) > c.max_size {
+		return nil
+	}
+
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), key+".*"+tempSuffix)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if close_err := f.Close(); err == nil {
+		err = close_err
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*entry)
+		c.size += int64(len(data)) - e.size
+		e.size = int64(len(data))
+		c.lru.MoveToFront(el)
+	} else {
+		c.entries[key] = c.lru.PushFront(&entry{key, int64(len(data))})
+		c.size += int64(len(data))
+	}
+	c.evict()
+
+	return nil
+}
+
+// Do returns the data of the entry, on a miss it is produced by fill and stored. Concurrent calls with the same key
+// wait for the first one instead of calling fill again. cached reports whether the data was not produced by this call.
+// Errors of fill are returned and not cached, failures to store the data are ignored.
+// The data is shared by the callers and must not be modified.
+func (c *Cache) Do(key string, fill func() ([]byte, error)) (data []byte, cached bool, err error) {
+	if data, ok := c.Get(key); ok {
+		return data, true, nil
+	}
+
+	c.mu.Lock()
+	if cl, ok := c.calls[key]; ok {
+		c.mu.Unlock()
+		cl.wg.Wait()
+		return cl.data, true, cl.err
+	}
+	cl := &call{err: errFillPanicked}
+	cl.wg.Add(1)
+	c.calls[key] = cl
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.calls, key)
+		c.mu.Unlock()
+		cl.wg.Done()
+	}()
+
+	// a call finished after the first lookup could have stored it
+	if data, ok := c.Get(key); ok {
+		cl.data, cl.err = data, nil
+		return data, true, nil
+	}
+
+	cl.data, cl.err = fill()
+	if cl.err == nil {
+		c.Put(key, cl.data)
+	}
+
+	return cl.data, false, cl.err
+}
+
+// Len returns the number of entries
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Size returns the total size of the entries in bytes
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
@@ -0,0 +1,164 @@
+package diskcache
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+
+	c, err := Open(dir, 100)
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+
+	for _, key := range []string{"aa", "bb", "cc"} {
+		if err := c.Put(key, bytes.Repeat([]byte(key[:1]), 30)); err != nil {
+			t.Fatalf("Put() failed: %v", err)
+		}
+	}
+	if c.Len() != 3 || c.Size() != 90 {
+		t.Fatalf("unexpected cache: %v entries, %v bytes", c.Len(), c.Size())
+	}
+
+	// "aa" becomes the most recently used, "bb" is evicted
+	if data, ok := c.Get("aa"); !ok || !bytes.Equal(data, bytes.Repeat([]byte("a"), 30)) {
+		t.Fatalf("unexpected entry: %q %v", data, ok)
+	}
+	c.Put("dd", make([]byte, 30))
+	if _, ok := c.Get("bb"); ok {
+		t.Errorf("least recently used entry should be evicted")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bb", "bb")); !os.IsNotExist(err) {
+		t.Errorf("file of the evicted entry should be removed: %v", err)
+	}
+	for _, key := range []string{"aa", "cc", "dd"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("%v should be cached", key)
+		}
+	}
+
+	// replacing an entry updates the size
+	c.Put("cc", make([]byte, 10))
+	if c.Len() != 3 || c.Size() != 70 {
+		t.Errorf("unexpected cache: %v entries, %v bytes", c.Len(), c.Size())
+	}
+
+	// too large entries are not stored
+	if err := c.Put("ee", make([]byte, 101)); err != nil || c.Len() != 3 {
+		t.Errorf("too large entry should be skipped: %v", err)
+	}
+
+	for _, key := range []string{"", "a", "../x", ".hidden", "a/b", "key.tmp"} {
+		if err := c.Put(key, nil); err == nil {
+			t.Errorf("%q should be rejected", key)
+		}
+	}
+
+	// entries removed from the disk are misses
+	os.Remove(filepath.Join(dir, "dd", "dd"))
+	if _, ok := c.Get("dd"); ok || c.Len() != 2 {
+		t.Errorf("removed entry should be dropped")
+	}
+
+	// reopened cache keeps the entries and their order
+	now := time.Now()
+	os.Chtimes(filepath.Join(dir, "aa", "aa"), now, now.Add(-time.Hour))
+	os.Chtimes(filepath.Join(dir, "cc", "cc"), now, now)
+	os.WriteFile(filepath.Join(dir, "cc", "cc.123.tmp"), []byte("partial"), 0666)
+
+	c, err = Open(dir, 100)
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	if c.Len() != 2 || c.Size() != 40 {
+		t.Fatalf("unexpected reopened cache: %v entries, %v bytes", c.Len(), c.Size())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cc", "cc.123.tmp")); !os.IsNotExist(err) {
+		t.Errorf("temporary file should be removed")
+	}
+	c.Put("ff", make([]byte, 65))
+	if _, ok := c.Get("aa"); ok {
+		t.Errorf("oldest entry should be evicted")
+	}
+	if _, ok := c.Get("cc"); !ok {
+		t.Errorf("newer entry should be kept")
+	}
+
+	// reopened with a smaller cap, "cc" was used last
+	c, err = Open(dir, 70)
+	if _, ok := c.Get("cc"); err != nil || c.Len() != 1 || !ok {
+		t.Errorf("unexpected reopened cache: %v", err)
+	}
+
+	if _, err := Open(dir, 0); err == nil {
+		t.Errorf("zero size cap should fail")
+	}
+}
+
+func TestCacheDo(t *testing.T) {
+	c, err := Open(t.TempDir(), 1000)
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+
+	var calls int32
+	release := make(chan struct{})
+	fill := func() ([]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return []byte("value"), nil
+	}
+
+	var wg sync.WaitGroup
+	var produced int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, cached, err := c.Do("key", fill)
+			if err != nil || string(data) != "value" {
+				t.Errorf("unexpected result: %q %v", data, err)
+			}
+			if !cached {
+				atomic.AddInt32(&produced, 1)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 || produced != 1 {
+		t.Errorf("fill should be called once, got %v calls, %v producers", calls, produced)
+	}
+
+	if data, cached, err := c.Do("key", fill); err != nil || !cached || string(data) != "value" || calls != 1 {
+		t.Errorf("second call should hit the cache: %q %v %v", data, cached, err)
+	}
+
+	// errors are not cached
+	fail := errors.New("failed")
+	if _, _, err := c.Do("other", func() ([]byte, error) { return nil, fail }); err != fail {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if data, cached, err := c.Do("other", func() ([]byte, error) { return []byte("ok"), nil }); err != nil || cached || string(data) != "ok" {
+		t.Errorf("failed fill should not be cached: %q %v %v", data, cached, err)
+	}
+
+	// a panicking fill doesn't block the key
+	func() {
+		defer func() { recover() }()
+		c.Do("panic", func() ([]byte, error) { panic("boom") })
+	}()
+	if data, _, err := c.Do("panic", func() ([]byte, error) { return []byte("ok"), nil }); err != nil || string(data) != "ok" {
+		t.Errorf("unexpected result after panic: %q %v", data, err)
+	}
+}
@@ -0,0 +1,8 @@
+// Package ippresize decodes, resizes and encodes images with Intel IPP.
+//
+// The package links IPP, libjpeg and libwebp found by pkg-config, see ipp_install.sh for IPP.
+// Besides the standard library it depends on github.com/anight/go-libjpeg and on golang.org/x/image
+// for BMP decoding, both have to be installed into GOPATH:
+//
+//	go get github.com/anight/go-libjpeg/jpeg golang.org/x/image/bmp
+package ippresize
@@ -0,0 +1,276 @@
+package ippresize
+
+//go:generate stringer -type=ChromaSubsampling -trimprefix Chroma
+
+import (
+	"bytes"
+	"context"
+	"github.com/anight/go-libjpeg/jpeg"
+	"github.com/anight/go-libjpeg/rgb"
+	"image"
+	"image/color"
+	"io"
+)
+
+// ChromaSubsampling selects chroma subsampling of the encoded jpeg image
+type ChromaSubsampling int
+
+const (
+	ChromaAuto ChromaSubsampling = iota // keep the subsampling of the source jpeg if possible, 4:2:0 otherwise
+	Chroma444
+	Chroma422
+	Chroma420
+	Chroma440
+)
+
+func (c ChromaSubsampling) ratio() image.YCbCrSubsampleRatio {
+	switch c {
+	case Chroma444:
+		return image.YCbCrSubsampleRatio444
+	case Chroma422:
+		return image.YCbCrSubsampleRatio422
+	case Chroma440:
+		return image.YCbCrSubsampleRatio440
+	}
+	return image.YCbCrSubsampleRatio420
+}
+
+// JpegOptions control jpeg encoding, nil means defaults
+type JpegOptions struct {
+	Quality         int // 1..100, 0 means 75
+	Subsampling     ChromaSubsampling
+	Progressive     bool
+	OptimizeHuffman bool
+	Metadata        MetadataPolicy // metadata of the source jpeg image to copy, stripped by default
+}
+
+func (o *JpegOptions) encoderOptions() *jpeg.EncoderOptions {
+	options := &jpeg.EncoderOptions{Quality: 75}
+	if o != nil {
+		if o.Quality != 0 {
+			options.Quality = o.Quality
+		}
+		options.ProgressiveMode = o.Progressive
+		options.OptimizeCoding = o.OptimizeHuffman
+	}
+	return options
+}
+
+func (o *JpegOptions) metadata() MetadataPolicy {
+	if o == nil {
+		return MetadataStrip
+	}
+	return o.Metadata
+}
+
+func (o *JpegOptions) subsampling() ChromaSubsampling {
+	if o == nil {
+		return ChromaAuto
+	}
+	return o.Subsampling
+}
+
+// ResizeJpeg decodes the image, resizes it to the box like Thumbnail() does and writes the result to writer as jpeg.
+// WithFormat() option is ignored, grayscale jpeg images produce grayscale output, the rest is encoded in color.
+// Jpeg images are resized plane by plane in YCbCr without color conversions when the crop and the output size
+// are aligned to the chroma subsampling, there is no padding and the subsampling is kept.
+// Metadata of jpeg images is copied according to the policy of the options.
+// The geometry of the operation is returned.
+func ResizeJpeg(reader io.Reader, writer io.Writer, box image.Point, opts *JpegOptions, options ...Option) (transform Transform, err error) {
+	return ResizeJpegContext(context.Background(), reader, writer, box, opts, options...)
+}
+
+// ResizeJpegContext works like ResizeJpeg(), it stops with the error of the context when it is done.
+// Nothing is written to the writer after the context is done.
+func ResizeJpegContext(ctx context.Context, reader io.Reader, writer io.Writer, box image.Point, opts *JpegOptions, options ...Option) (transform Transform, err error) {
+	if quality := opts.encoderOptions().Quality; quality < 1 || quality > 100 {
+		err = NewError(0, "invalid jpeg quality: %v", quality)
+		return
+	}
+
+	o := newThumbnailOptions(append(options, WithSize(box)))
+	scale_target, layout_func := o.layoutFuncs()
+
+	var data []byte
+	data, err = io.ReadAll(reader)
+	if err != nil {
+		return
+	}
+
+	var im image.Image
+	var orig_size image.Point
+	var orientation Orientation
+	var format ImageFormat
+	im, orig_size, orientation, format, err = decodeImage(ctx, data, jpeg.OutColorSpaceSame, scale_target, o.decode_opts)
+	if err != nil {
+		return
+	}
+
+	in_size := im.Bounds().Size()
+	decoded_size := orientation.Size(in_size)
+	var layout Layout
+	layout, err = smartLayoutImage(layout_func(orig_size, decoded_size), &o.fit_opts, im, orientation)
+	if err != nil {
+		return
+	}
+
+	var out image.Image
+
+	if ycbcr, ok := im.(*image.YCbCr); ok {
+		out, err = resizeYCbCrLayout(ctx, ycbcr, layout, orientation, opts.subsampling(), o.interpolation)
+		if err != nil {
+			return
+		}
+	}
+
+	if out == nil {
+		if gray, ok := im.(*image.Gray); ok {
+			var pix []uint8
+			pix, err = resizeLayout(ctx, nil, gray.Pix, gray.Stride, in_size, 1, layout, grayPadColor(o.fit_opts.PadColor), orientation, o.interpolation)
+			if err != nil {
+				return
+			}
+			out = &image.Gray{Pix: pix, Stride: layout.Size.X, Rect: image.Rectangle{Max: layout.Size}}
+		} else {
+			src := toRGB(im, o.decode_opts.background())
+			var pix []uint8
+			pix, err = resizeLayout(ctx, nil, src.Pix, src.Stride, in_size, 3, layout, o.fit_opts.PadColor, orientation, o.interpolation)
+			if err != nil {
+				return
+			}
+			ratio := opts.subsampling().ratio()
+			out = rgbToYCbCr(pix, 3*layout.Size.X, layout.Size, ratio)
+		}
+	}
+
+	policy := opts.metadata()
+	if format != ImageFormatJPEG {
+		policy = MetadataStrip
+	}
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	_, span := startSpan(ctx, "encode")
+	span.SetAttribute("format", ImageFormatJPEG.String())
+	setSizeAttributes(span, "target", layout.Size)
+	s := startStage()
+
+	if policy == MetadataStrip {
+		err = jpeg.Encode(writer, out, opts.encoderOptions())
+	} else {
+		var buf bytes.Buffer
+		err = jpeg.Encode(&buf, out, opts.encoderOptions())
+		if err == nil {
+			var encoded []byte
+			converted := o.decode_opts.colorManagement() && convertsColors(data)
+			encoded, err = copyMetadata(buf.Bytes(), data, policy, layout.Size, orientation != OrientationNormal, converted)
+			if err == nil {
+				_, err = writer.Write(encoded)
+			}
+		}
+	}
+	s.encoded(ImageFormatJPEG, layout.Size, err)
+	span.End(err)
+	if err != nil {
+		return
+	}
+
+	transform = newTransform(decoded_size, layout.Src, layout.Dst, layout.Size)
+	transform.Orientation = orientation
+	transform.rebase(orig_size)
+	return
+}
+
+// resizeYCbCrLayout resizes the planes of the image according to the layout, see resizeLayout().
+// It returns nil without error if the layout doesn't allow that.
+func resizeYCbCrLayout(ctx context.Context, ycbcr *image.YCbCr, layout Layout, orientation Orientation, subsampling ChromaSubsampling, interpolation Interpolation) (image.Image, error) {
+	if layout.Padded() {
+		return nil, nil
+	}
+
+	ratio, ok := orientRatio(ycbcr.SubsampleRatio, orientation)
+	if !ok || (subsampling != ChromaAuto && subsampling.ratio() != ratio) {
+		return nil, nil
+	}
+
+	in_size := ycbcr.Rect.Size()
+	src := orientation.Inverse().Rect(layout.Src, orientation.Size(in_size))
+	size := orientation.Inverse().Size(layout.Dst.Size())
+
+	fw, fh := subsampleFactors(ycbcr.SubsampleRatio)
+	if src.Min.X%fw != 0 || src.Max.X%fw != 0 || size.X%fw != 0 ||
+		src.Min.Y%fh != 0 || src.Max.Y%fh != 0 || size.Y%fh != 0 {
+		return nil, nil
+	}
+
+	sub := ycbcr.SubImage(src.Add(ycbcr.Rect.Min)).(*image.YCbCr)
+	resized, err := resizeLimitedYCbCr(ctx, sub, size, interpolation)
+	if err != nil {
+		return nil, err
+	}
+
+	return OrientImage(resized, orientation)
+}
+
+// grayPadColor converts the pad color to gray
+func grayPadColor(c []uint8) []uint8 {
+	if len(c) >= 3 {
+		y, _, _ := color.RGBToYCbCr(c[0], c[1], c[2])
+		return []uint8{y}
+	}
+	return c
+}
+
+// toRGB converts the decoded image to rgb, composing it over the background if it has alpha channel
+func toRGB(im image.Image, background color.Color) *rgb.Image {
+	switch i := im.(type) {
+	case *rgb.Image:
+		return i
+	case *image.YCbCr:
+		size := i.Rect.Size()
+		out := &rgb.Image{Pix: make([]uint8, 3*size.X*size.Y), Stride: 3 * size.X, Rect: image.Rectangle{Max: size}}
+		for y := 0; y < size.Y; y++ {
+			row := out.Pix[y*out.Stride:]
+			for x := 0; x < size.X; x++ {
+				yi := i.YOffset(i.Rect.Min.X+x, i.Rect.Min.Y+y)
+				ci := i.COffset(i.Rect.Min.X+x, i.Rect.Min.Y+y)
+				row[3*x], row[3*x+1], row[3*x+2] = color.YCbCrToRGB(i.Y[yi], i.Cb[ci], i.Cr[ci])
+			}
+		}
+		return out
+	}
+	return normalizeImage(im, jpeg.OutColorSpaceRGB, background).(*rgb.Image)
+}
+
+// rgbToYCbCr converts rgb pixels to YCbCr image, chroma is averaged over the pixels sharing it
+func rgbToYCbCr(pix []uint8, stride int, size image.Point, ratio image.YCbCrSubsampleRatio) *image.YCbCr {
+	out := image.NewYCbCr(image.Rectangle{Max: size}, ratio)
+	fw, fh := subsampleFactors(ratio)
+
+	cb_sum := make([]int, len(out.Cb))
+	cr_sum := make([]int, len(out.Cr))
+	count := make([]int, len(out.Cb))
+
+	for y := 0; y < size.Y; y++ {
+		row := pix[y*stride:]
+		for x := 0; x < size.X; x++ {
+			yy, cb, cr := color.RGBToYCbCr(row[3*x], row[3*x+1], row[3*x+2])
+			out.Y[y*out.YStride+x] = yy
+			ci := (y/fh)*out.CStride + x/fw
+			cb_sum[ci] += int(cb)
+			cr_sum[ci] += int(cr)
+			count[ci]++
+		}
+	}
+
+	for i, n := range count {
+		if n > 0 {
+			out.Cb[i] = uint8((cb_sum[i] + n/2) / n)
+			out.Cr[i] = uint8((cr_sum[i] + n/2) / n)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,118 @@
+package ippresize
+
+import (
+	"bytes"
+	"context"
+	"image"
+	stdjpeg "image/jpeg"
+	"os"
+	"testing"
+)
+
+func TestResizeJpeg(t *testing.T) {
+	data, err := os.ReadFile("./test.jpg")
+	if err != nil {
+		t.Fatalf("os.ReadFile() failed: %v", err)
+	}
+
+	for _, opts := range []*JpegOptions{
+		nil,
+		{Quality: 90, Subsampling: Chroma444, Progressive: true, OptimizeHuffman: true},
+		{Subsampling: Chroma422},
+	} {
+		var buf bytes.Buffer
+		transform, err := ResizeJpeg(bytes.NewReader(data), &buf, image.Point{100, 100}, opts, WithFit(FitCover), WithInterpolation(InterpolationSuper))
+		if err != nil {
+			t.Fatalf("ResizeJpeg(%+v) failed: %v", opts, err)
+		}
+		if transform.OutSize != (image.Point{100, 100}) || transform.OrigSize != (image.Point{566, 850}) {
+			t.Errorf("unexpected transform: %+v", transform)
+		}
+		config, err := stdjpeg.DecodeConfig(&buf)
+		if err != nil {
+			t.Fatalf("jpeg.DecodeConfig() failed: %v", err)
+		}
+		if config.Width != 100 || config.Height != 100 {
+			t.Errorf("unexpected output size: %vx%v", config.Width, config.Height)
+		}
+	}
+
+	// padding is done in rgb
+	var buf bytes.Buffer
+	_, err = ResizeJpeg(bytes.NewReader(data), &buf, image.Point{100, 100}, nil, WithPadding([]uint8{255, 0, 0}))
+	if err != nil {
+		t.Fatalf("ResizeJpeg() failed: %v", err)
+	}
+
+	_, err = ResizeJpeg(bytes.NewReader(data), &buf, image.Point{100, 100}, &JpegOptions{Quality: 101})
+	if err == nil {
+		t.Errorf("invalid quality should fail")
+	}
+
+	// grayscale stays grayscale
+	gray := image.NewGray(image.Rect(0, 0, 64, 64))
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i)
+	}
+	var gray_data bytes.Buffer
+	if err := stdjpeg.Encode(&gray_data, gray, nil); err != nil {
+		t.Fatalf("jpeg.Encode() failed: %v", err)
+	}
+	buf.Reset()
+	_, err = ResizeJpeg(&gray_data, &buf, image.Point{32, 0}, nil)
+	if err != nil {
+		t.Fatalf("ResizeJpeg() failed: %v", err)
+	}
+	im, err := stdjpeg.Decode(&buf)
+	if err != nil {
+		t.Fatalf("jpeg.Decode() failed: %v", err)
+	}
+	if _, ok := im.(*image.Gray); !ok || im.Bounds() != image.Rect(0, 0, 32, 32) {
+		t.Errorf("unexpected output: %T %v", im, im.Bounds())
+	}
+}
+
+func TestResizeYCbCrLayout(t *testing.T) {
+	ycbcr := image.NewYCbCr(image.Rect(0, 0, 64, 48), image.YCbCrSubsampleRatio420)
+	full := image.Rect(0, 0, 64, 48)
+
+	tests := []struct {
+		layout      Layout
+		orientation Orientation
+		subsampling ChromaSubsampling
+		ok          bool
+	}{
+		{Layout{image.Point{32, 24}, full, image.Rect(0, 0, 32, 24)}, OrientationNormal, ChromaAuto, true},
+		{Layout{image.Point{24, 32}, image.Rect(0, 0, 48, 64), image.Rect(0, 0, 24, 32)}, OrientationRotate90, Chroma420, true},
+		{Layout{image.Point{32, 24}, full, image.Rect(0, 0, 32, 24)}, OrientationNormal, Chroma444, false},
+		{Layout{image.Point{31, 24}, full, image.Rect(0, 0, 31, 24)}, OrientationNormal, ChromaAuto, false},
+		{Layout{image.Point{32, 32}, image.Rect(1, 0, 49, 48), image.Rect(0, 0, 32, 32)}, OrientationNormal, ChromaAuto, false},
+		{Layout{image.Point{32, 32}, full, image.Rect(0, 4, 32, 28)}, OrientationNormal, ChromaAuto, false},
+	}
+	for _, item := range tests {
+		out, err := resizeYCbCrLayout(context.Background(), ycbcr, item.layout, item.orientation, item.subsampling, InterpolationLinear)
+		if err != nil {
+			t.Fatalf("resizeYCbCrLayout(%+v) failed: %v", item.layout, err)
+		}
+		if (out != nil) != item.ok {
+			t.Errorf("resizeYCbCrLayout(%+v, %v, %v): expected %v", item.layout, item.orientation, item.subsampling, item.ok)
+		}
+		if out != nil && out.Bounds().Size() != item.layout.Size {
+			t.Errorf("unexpected size: %v", out.Bounds())
+		}
+	}
+}
+
+func TestRGBToYCbCr(t *testing.T) {
+	size := image.Point{3, 3}
+	pix := bytes.Repeat([]uint8{200, 100, 50}, size.X*size.Y)
+	for _, ratio := range []image.YCbCrSubsampleRatio{image.YCbCrSubsampleRatio444, image.YCbCrSubsampleRatio422, image.YCbCrSubsampleRatio420} {
+		ycbcr := rgbToYCbCr(pix, 3*size.X, size, ratio)
+		back := toRGB(ycbcr, nil)
+		for i, v := range back.Pix {
+			if d := int(v) - int(pix[i]); d < -2 || d > 2 {
+				t.Fatalf("%v: round trip mismatch at %v: %v vs %v", ratio, i, v, pix[i])
+			}
+		}
+	}
+}
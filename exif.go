@@ -0,0 +1,285 @@
+package ippresize
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// jpeg markers
+const (
+	markerSOI   = 0xd8
+	markerEOI   = 0xd9
+	markerSOS   = 0xda
+	markerAPP0  = 0xe0
+	markerAPP1  = 0xe1
+	markerAPP2  = 0xe2
+	markerAPP13 = 0xed
+	markerCOM   = 0xfe
+)
+
+// exif tags
+const (
+	tagImageWidth      = 0x0100
+	tagImageLength     = 0x0101
+	tagOrientation     = 0x0112
+	tagExifIFD         = 0x8769
+	tagGPSIFD          = 0x8825
+	tagPixelXDimension = 0xa002
+	tagPixelYDimension = 0xa003
+)
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// jpegSegment is a marker segment of a jpeg stream
+type jpegSegment struct {
+	marker byte
+	offset int    // offset of the marker in the stream
+	data   []byte // payload following the length field
+}
+
+// jpegSegments returns marker segments of the jpeg stream preceding the image data (SOS marker)
+func jpegSegments(data []byte) ([]jpegSegment, error) {
+	if len(data) < 2 || data[0] != 0xff || data[1] != markerSOI {
+		return nil, NewError(0, "not a jpeg stream")
+	}
+
+	var segments []jpegSegment
+
+	for pos := 2; ; {
+		// markers may be preceded by any number of fill bytes
+		for pos < len(data) && data[pos] == 0xff {
+			pos++
+		}
+		if pos >= len(data) || data[pos-1] != 0xff {
+			return segments, NewError(0, "invalid jpeg marker at offset %v", pos)
+		}
+
+		marker := data[pos]
+		offset := pos - 1
+		pos++
+
+		if marker == markerSOS || marker == markerEOI {
+			return segments, nil
+		}
+
+		// standalone markers
+		if marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7) {
+			continue
+		}
+
+		if pos+2 > len(data) {
+			return segments, NewError(0, "truncated jpeg segment at offset %v", offset)
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos:]))
+		if length < 2 || pos+length > len(data) {
+			return segments, NewError(0, "truncated jpeg segment at offset %v", offset)
+		}
+
+		segments = append(segments, jpegSegment{marker: marker, offset: offset, data: data[pos+2 : pos+length]})
+		pos += length
+	}
+}
+
+// exifTIFF returns tiff data of the first exif segment, nil if there is none
+func exifTIFF(segments []jpegSegment) []byte {
+	for _, s := range segments {
+		if s.marker == markerAPP1 && bytes.HasPrefix(s.data, exifHeader) {
+			return s.data[len(exifHeader):]
+		}
+	}
+	return nil
+}
+
+// tiffEntry is an IFD entry of tiff data
+type tiffEntry struct {
+	tag    uint16
+	typ    uint16
+	count  uint32
+	offset int // offset of the 4 byte value (or value offset) field in tiff data
+}
+
+// tiffReader reads IFDs of the tiff structure embedded into exif segment
+type tiffReader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+func newTIFFReader(data []byte) (*tiffReader, error) {
+	if len(data) < 8 {
+		return nil, NewError(0, "truncated tiff header")
+	}
+
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, NewError(0, "invalid tiff byte order: %q", data[:2])
+	}
+
+	if order.Uint16(data[2:]) != 42 {
+		return nil, NewError(0, "invalid tiff magic number")
+	}
+
+	return &tiffReader{data: data, order: order}, nil
+}
+
+// firstIFD returns the offset of IFD0
+func (t *tiffReader) firstIFD() uint32 {
+	return t.order.Uint32(t.data[4:])
+}
+
+// readIFD returns entries of the IFD at the given offset and the offset of the next IFD
+func (t *tiffReader) readIFD(offset uint32) ([]tiffEntry, uint32, error) {
+	pos := int(offset)
+	if offset == 0 || pos < 8 || pos+2 > len(t.data) {
+		return nil, 0, NewError(0, "invalid IFD offset: %v", offset)
+	}
+
+	n := int(t.order.Uint16(t.data[pos:]))
+	pos += 2
+	if pos+12*n+4 > len(t.data) {
+		return nil, 0, NewError(0, "truncated IFD at offset %v", offset)
+	}
+
+	entries := make([]tiffEntry, n)
+	for i := range entries {
+		e := t.data[pos+12*i:]
+		entries[i] = tiffEntry{
+			tag:    t.order.Uint16(e),
+			typ:    t.order.Uint16(e[2:]),
+			count:  t.order.Uint32(e[4:]),
+			offset: pos + 12*i + 8,
+		}
+	}
+
+	return entries, t.order.Uint32(t.data[pos+12*n:]), nil
+}
+
+// uint returns the value of SHORT or LONG entry with a single value
+func (t *tiffReader) uint(e tiffEntry) (uint32, bool) {
+	if e.count != 1 {
+		return 0, false
+	}
+	switch e.typ {
+	case 3: // SHORT
+		return uint32(t.order.Uint16(t.data[e.offset:])), true
+	case 4: // LONG
+		return t.order.Uint32(t.data[e.offset:]), true
+	}
+	return 0, false
+}
+
+// setUint sets the value of SHORT or LONG entry with a single value, SHORT values are saturated
+func (t *tiffReader) setUint(e tiffEntry, v uint32) bool {
+	if e.count != 1 {
+		return false
+	}
+	switch e.typ {
+	case 3: // SHORT
+		if v > 0xffff {
+			v = 0xffff
+		}
+		t.order.PutUint16(t.data[e.offset:], uint16(v))
+		return true
+	case 4: // LONG
+		t.order.PutUint32(t.data[e.offset:], v)
+		return true
+	}
+	return false
+}
+
+// valueSize returns the size of the entry value in bytes, values up to 4 bytes are stored in the entry itself
+func (e tiffEntry) valueSize() int {
+	switch e.typ {
+	case 1, 2, 6, 7: // BYTE, ASCII, SBYTE, UNDEFINED
+		return int(e.count)
+	case 3, 8: // SHORT, SSHORT
+		return 2 * int(e.count)
+	case 4, 9, 11: // LONG, SLONG, FLOAT
+		return 4 * int(e.count)
+	case 5, 10, 12: // RATIONAL, SRATIONAL, DOUBLE
+		return 8 * int(e.count)
+	}
+	return 0
+}
+
+// setNextIFD sets the offset of the IFD following the IFD at the given offset
+func (t *tiffReader) setNextIFD(offset uint32, next uint32) {
+	n := int(t.order.Uint16(t.data[offset:]))
+	t.order.PutUint32(t.data[int(offset)+2+12*n:], next)
+}
+
+// removeEntry removes the entry with the given index from the IFD at the given offset
+func (t *tiffReader) removeEntry(offset uint32, index int) {
+	pos := int(offset)
+	n := int(t.order.Uint16(t.data[pos:]))
+	next := t.order.Uint32(t.data[pos+2+12*n:])
+	copy(t.data[pos+2+12*index:], t.data[pos+2+12*(index+1):pos+2+12*n])
+	t.order.PutUint16(t.data[pos:], uint16(n-1))
+	t.order.PutUint32(t.data[pos+2+12*(n-1):], next)
+	// clear the former next IFD offset
+	copy(t.data[pos+2+12*(n-1)+4:pos+2+12*n+4], make([]byte, 12))
+}
+
+// clearIFD zeroes the IFD at the given offset with the values stored outside of it
+func (t *tiffReader) clearIFD(offset uint32) {
+	entries, _, err := t.readIFD(offset)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if size := e.valueSize(); size > 4 {
+			if pos := int(t.order.Uint32(t.data[e.offset:])); pos >= 8 && pos+size <= len(t.data) {
+				copy(t.data[pos:pos+size], make([]byte, size))
+			}
+		}
+	}
+	pos := int(offset)
+	copy(t.data[pos:pos+2+12*len(entries)+4], make([]byte, 2+12*len(entries)+4))
+}
+
+// exifOrientation returns the orientation stored in exif segment of the jpeg stream,
+// OrientationNormal if there is none or it is invalid
+func exifOrientation(data []byte) Orientation {
+	segments, _ := jpegSegments(data)
+
+	tiff := exifTIFF(segments)
+	if tiff == nil {
+		return OrientationNormal
+	}
+
+	t, err := newTIFFReader(tiff)
+	if err != nil {
+		return OrientationNormal
+	}
+
+	entries, _, err := t.readIFD(t.firstIFD())
+	if err != nil {
+		return OrientationNormal
+	}
+
+	for _, e := range entries {
+		if e.tag == tagOrientation {
+			if v, ok := t.uint(e); ok && Orientation(v).valid() {
+				return Orientation(v)
+			}
+			break
+		}
+	}
+
+	return OrientationNormal
+}
+
+// ReadOrientation returns the exif orientation of the jpeg image, OrientationNormal if there is none
+func ReadOrientation(reader io.Reader) (Orientation, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return OrientationNormal, err
+	}
+	return exifOrientation(data), nil
+}
@@ -0,0 +1,139 @@
+package ippresize
+
+import (
+	"bytes"
+	"expvar"
+	"fmt"
+	"image"
+	"io"
+	"strings"
+	"time"
+)
+
+// expvarCounter is a counter with labels, the values are kept in the map by label values joined with commas
+type expvarCounter struct {
+	name   string
+	help   string
+	labels []string
+	values *expvar.Map
+}
+
+func (c *expvarCounter) add(delta float64, label_values ...string) {
+	c.values.AddFloat(strings.Join(label_values, ","), delta)
+}
+
+// ExpvarMetrics is Metrics counting the number, the time, the pixels and the errors of the stages in expvar variables.
+// The counters are labeled by image format for decoding and encoding, by interpolation for resizing,
+// the errors are labeled by IppStatus as well, "other" for the errors not coming from IPP.
+type ExpvarMetrics struct {
+	vars     *expvar.Map
+	counters []*expvarCounter
+
+	decodes, decode_seconds, decode_pixels, decode_errors                       *expvarCounter
+	resizes, resize_seconds, resize_in_pixels, resize_out_pixels, resize_errors *expvarCounter
+	encodes, encode_seconds, encode_pixels, encode_errors                       *expvarCounter
+}
+
+// NewExpvarMetrics returns the metrics published as the expvar variable with the name, not published if the name is empty.
+// Like expvar.Publish() it panics if the name is already taken.
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	m := &ExpvarMetrics{vars: new(expvar.Map).Init()}
+
+	counter := func(name string, help string, labels ...string) *expvarCounter {
+		c := &expvarCounter{name: name, help: help, labels: labels, values: new(expvar.Map).Init()}
+		m.vars.Set(name, c.values)
+		m.counters = append(m.counters, c)
+		return c
+	}
+
+	m.decodes = counter("decode_total", "Number of decoded images", "format")
+	m.decode_seconds = counter("decode_seconds_total", "Time spent decoding images", "format")
+	m.decode_pixels = counter("decode_pixels_total", "Pixels of decoded images", "format")
+	m.decode_errors = counter("decode_errors_total", "Number of failed decodes", "format", "status")
+	m.resizes = counter("resize_total", "Number of IPP resizes", "interpolation")
+	m.resize_seconds = counter("resize_seconds_total", "Time spent in IPP resizes", "interpolation")
+	m.resize_in_pixels = counter("resize_input_pixels_total", "Pixels of resized images", "interpolation")
+	m.resize_out_pixels = counter("resize_output_pixels_total", "Pixels of resize outputs", "interpolation")
+	m.resize_errors = counter("resize_errors_total", "Number of failed IPP resizes", "interpolation", "status")
+	m.encodes = counter("encode_total", "Number of encoded images", "format")
+	m.encode_seconds = counter("encode_seconds_total", "Time spent encoding images", "format")
+	m.encode_pixels = counter("encode_pixels_total", "Pixels of encoded images", "format")
+	m.encode_errors = counter("encode_errors_total", "Number of failed encodes", "format", "status")
+
+	if name != "" {
+		expvar.Publish(name, m.vars)
+	}
+
+	return m
+}
+
+func pixels(size image.Point) float64 {
+	return float64(size.X) * float64(size.Y)
+}
+
+func errorStatusLabel(err error) string {
+	if status := ErrorStatus(err); status != 0 {
+		return status.String()
+	}
+	return "other"
+}
+
+func (m *ExpvarMetrics) ObserveDecode(format ImageFormat, duration time.Duration, size image.Point, err error) {
+	label := format.String()
+	m.decodes.add(1, label)
+	m.decode_seconds.add(duration.Seconds(), label)
+	if err != nil {
+		m.decode_errors.add(1, label, errorStatusLabel(err))
+		return
+	}
+	m.decode_pixels.add(pixels(size), label)
+}
+
+func (m *ExpvarMetrics) ObserveResize(interpolation Interpolation, duration time.Duration, in_size image.Point, out_size image.Point, err error) {
+	label := interpolation.String()
+	m.resizes.add(1, label)
+	m.resize_seconds.add(duration.Seconds(), label)
+	if err != nil {
+		m.resize_errors.add(1, label, errorStatusLabel(err))
+		return
+	}
+	m.resize_in_pixels.add(pixels(in_size), label)
+	m.resize_out_pixels.add(pixels(out_size), label)
+}
+
+func (m *ExpvarMetrics) ObserveEncode(format ImageFormat, duration time.Duration, size image.Point, err error) {
+	label := format.String()
+	m.encodes.add(1, label)
+	m.encode_seconds.add(duration.Seconds(), label)
+	if err != nil {
+		m.encode_errors.add(1, label, errorStatusLabel(err))
+		return
+	}
+	m.encode_pixels.add(pixels(size), label)
+}
+
+// Vars returns the expvar variable of the metrics, a map of the counters
+func (m *ExpvarMetrics) Vars() *expvar.Map {
+	return m.vars
+}
+
+// WritePrometheus writes the counters in Prometheus text exposition format, the names are prefixed with "ippresize_"
+func (m *ExpvarMetrics) WritePrometheus(writer io.Writer) error {
+	var buf bytes.Buffer
+
+	for _, c := range m.counters {
+		name := "ippresize_" + c.name
+		fmt.Fprintf(&buf, "# HELP %v %v\n# TYPE %v counter\n", name, c.help, name)
+		c.values.Do(func(kv expvar.KeyValue) {
+			label_values := strings.Split(kv.Key, ",")
+			labels := make([]string, len(c.labels))
+			for i, label := range c.labels {
+				labels[i] = fmt.Sprintf("%v=%q", label, label_values[i])
+			}
+			fmt.Fprintf(&buf, "%v{%v} %v\n", name, strings.Join(labels, ","), kv.Value)
+		})
+	}
+
+	_, err := writer.Write(buf.Bytes())
+	return err
+}
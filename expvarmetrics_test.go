@@ -0,0 +1,66 @@
+package ippresize
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"image"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpvarMetrics(t *testing.T) {
+	m := NewExpvarMetrics("ippresize_test")
+	if expvar.Get("ippresize_test") != m.Vars() {
+		t.Fatalf("metrics are not published")
+	}
+
+	m.ObserveDecode(ImageFormatJPEG, time.Second, image.Point{10, 20}, nil)
+	m.ObserveDecode(ImageFormatJPEG, time.Second, image.Point{}, errors.New("broken"))
+	m.ObserveResize(InterpolationLanczos, time.Millisecond, image.Point{10, 20}, image.Point{5, 10}, nil)
+	m.ObserveResize(InterpolationLinear, time.Millisecond, image.Point{1, 1}, image.Point{5, 10}, NewError(int(IppStsSizeErr), "too small"))
+	m.ObserveEncode(ImageFormatWebP, time.Second/2, image.Point{5, 10}, nil)
+
+	var buf bytes.Buffer
+	if err := m.WritePrometheus(&buf); err != nil {
+		t.Fatalf("WritePrometheus() failed: %v", err)
+	}
+	text := buf.String()
+
+	for _, line := range []string{
+		"# TYPE ippresize_decode_total counter",
+		`ippresize_decode_total{format="JPEG"} 2`,
+		`ippresize_decode_seconds_total{format="JPEG"} 2`,
+		`ippresize_decode_pixels_total{format="JPEG"} 200`,
+		`ippresize_decode_errors_total{format="JPEG",status="other"} 1`,
+		`ippresize_resize_total{interpolation="Lanczos"} 1`,
+		`ippresize_resize_total{interpolation="Linear"} 1`,
+		`ippresize_resize_input_pixels_total{interpolation="Lanczos"} 200`,
+		`ippresize_resize_output_pixels_total{interpolation="Lanczos"} 50`,
+		`ippresize_resize_errors_total{interpolation="Linear",status="IppStsSizeErr"} 1`,
+		`ippresize_encode_seconds_total{format="WebP"} 0.5`,
+		`ippresize_encode_pixels_total{format="WebP"} 50`,
+		"# HELP ippresize_encode_errors_total Number of failed encodes",
+	} {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("missing %q in:\n%v", line, text)
+		}
+	}
+	if strings.Contains(text, `ippresize_resize_input_pixels_total{interpolation="Linear"}`) {
+		t.Errorf("failed resizes should not count pixels")
+	}
+
+	var vars map[string]map[string]float64
+	if err := json.Unmarshal([]byte(m.Vars().String()), &vars); err != nil {
+		t.Fatalf("invalid expvar json: %v", err)
+	}
+	if vars["resize_errors_total"]["Linear,IppStsSizeErr"] != 1 || vars["encode_total"]["WebP"] != 1 {
+		t.Errorf("unexpected expvar values: %v", vars)
+	}
+
+	if NewExpvarMetrics("").Vars() == nil {
+		t.Errorf("unpublished metrics should have vars")
+	}
+}
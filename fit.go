@@ -0,0 +1,132 @@
+package ippresize
+
+//go:generate stringer -type=Fit -trimprefix Fit
+
+import (
+	"image"
+	"math"
+)
+
+// Fit defines how an image is sized to a box
+type Fit int
+
+const (
+	FitContain Fit = iota // preserve aspect ratio, fit into the box and pad the rest of the box
+	FitCover              // preserve aspect ratio, cover the box and crop the overflow
+	FitFill               // stretch to the box, ignoring aspect ratio
+	FitInside             // preserve aspect ratio, fit into the box, never enlarge
+	FitOutside            // preserve aspect ratio, cover the box, no cropping
+)
+
+// ParseFit returns the fit by its name, e.g. "cover"
+func ParseFit(name string) (Fit, error) {
+	for f := FitContain; f <= FitOutside; f++ {
+		if matchName(name, f) {
+			return f, nil
+		}
+	}
+	return 0, NewError(0, "unknown fit: %q", name)
+}
+
+type FitOptions struct {
+	Gravity            Gravity      // placement of the image for FitContain and FitCover
+	CropStrategy       CropStrategy // scoring of the crop windows for GravitySmart
+	PadColor           []uint8      // padding color for FitContain, one value per channel, gray if empty
+	WithoutEnlargement bool         // never make the image larger than the source, whatever the fit
+}
+
+// Layout describes a resize with a fit mode: Src rectangle of the input image is resized
+// to Dst rectangle of the output image with Size dimensions, the rest of the output image is padding
+type Layout struct {
+	Size image.Point
+	Src  image.Rectangle
+	Dst  image.Rectangle
+}
+
+// Padded reports whether some of the output image is padding
+func (l Layout) Padded() bool {
+	return l.Dst != image.Rectangle{Max: l.Size}
+}
+
+// scaleTarget returns the smallest size the whole input image may be decoded at
+// without losing resolution needed for the layout
+func (l Layout) scaleTarget(in_size image.Point) image.Point {
+	return image.Point{
+		X: int(math.Ceil(float64(in_size.X) * float64(l.Dst.Dx()) / float64(l.Src.Dx()))),
+		Y: int(math.Ceil(float64(in_size.Y) * float64(l.Dst.Dy()) / float64(l.Src.Dy()))),
+	}
+}
+
+// ResolveBox replaces zero (or negative) box dimensions with the ones following the aspect ratio of the image.
+// If both dimensions are zero the box is the size of the image.
+func ResolveBox(in_size image.Point, box image.Point) image.Point {
+	switch {
+	case box.X <= 0 && box.Y <= 0:
+		return in_size
+	case box.X <= 0:
+		box.X = int(math.Round(float64(in_size.X) * float64(box.Y) / float64(in_size.Y)))
+		if box.X == 0 {
+			box.X = 1
+		}
+	case box.Y <= 0:
+		box.Y = int(math.Round(float64(in_size.Y) * float64(box.X) / float64(in_size.X)))
+		if box.Y == 0 {
+			box.Y = 1
+		}
+	}
+	return box
+}
+
+// ComputeLayout computes how the image with in_size dimensions is resized to the box with the given fit.
+// The crop of GravitySmart depends on the pixels, it is centered here and moved when the image is resized.
+func ComputeLayout(in_size image.Point, box image.Point, fit Fit, opts *FitOptions) Layout {
+	if opts == nil {
+		opts = &FitOptions{}
+	}
+
+	box = ResolveBox(in_size, box)
+	full := image.Rectangle{Max: in_size}
+
+	// shrink the size proportionally if it is larger than the image in any dimension
+	noEnlarge := func(size image.Point) image.Point {
+		if size.X > in_size.X || size.Y > in_size.Y {
+			return GetProportionalLargestInnerSize(size, in_size)
+		}
+		return size
+	}
+
+	switch fit {
+	case FitCover:
+		if opts.WithoutEnlargement {
+			box = noEnlarge(box)
+		}
+		return Layout{Size: box, Src: GetCropRect(in_size, box, opts.Gravity), Dst: image.Rectangle{Max: box}}
+	case FitFill:
+		if opts.WithoutEnlargement {
+			box.X = clampInt(box.X, 1, in_size.X)
+			box.Y = clampInt(box.Y, 1, in_size.Y)
+		}
+		return Layout{Size: box, Src: full, Dst: image.Rectangle{Max: box}}
+	case FitInside:
+		size := noEnlarge(GetProportionalLargestInnerSize(in_size, box))
+		return Layout{Size: size, Src: full, Dst: image.Rectangle{Max: size}}
+	case FitOutside:
+		size := GetProportionalSmallestOuterSize(in_size, box)
+		if opts.WithoutEnlargement {
+			size = noEnlarge(size)
+		}
+		return Layout{Size: size, Src: full, Dst: image.Rectangle{Max: size}}
+	default:
+		size := GetProportionalLargestInnerSize(in_size, box)
+		if opts.WithoutEnlargement {
+			size = noEnlarge(size)
+		}
+		pos := opts.Gravity.offset(box, size)
+		return Layout{Size: box, Src: full, Dst: image.Rectangle{pos, pos.Add(size)}}
+	}
+}
+
+// ComputeSize returns the size of the output image for the given fit
+func ComputeSize(in_size image.Point, box image.Point, fit Fit, opts *FitOptions) image.Point {
+	return ComputeLayout(in_size, box, fit, opts).Size
+}
@@ -0,0 +1,104 @@
+package ippresize
+
+import (
+	"image"
+	"testing"
+)
+
+func TestComputeLayout(t *testing.T) {
+	in := image.Point{640, 480}
+	full := image.Rect(0, 0, 640, 480)
+	tests := []struct {
+		box    image.Point
+		fit    Fit
+		opts   *FitOptions
+		layout Layout
+	}{
+		{image.Point{160, 160}, FitContain, nil, Layout{image.Point{160, 160}, full, image.Rect(0, 20, 160, 140)}},
+		{image.Point{160, 160}, FitContain, &FitOptions{Gravity: GravityBottom}, Layout{image.Point{160, 160}, full, image.Rect(0, 40, 160, 160)}},
+		{image.Point{160, 160}, FitCover, nil, Layout{image.Point{160, 160}, image.Rect(80, 0, 560, 480), image.Rect(0, 0, 160, 160)}},
+		{image.Point{160, 160}, FitCover, &FitOptions{Gravity: GravityLeft}, Layout{image.Point{160, 160}, image.Rect(0, 0, 480, 480), image.Rect(0, 0, 160, 160)}},
+		{image.Point{160, 160}, FitFill, nil, Layout{image.Point{160, 160}, full, image.Rect(0, 0, 160, 160)}},
+		{image.Point{160, 160}, FitInside, nil, Layout{image.Point{160, 120}, full, image.Rect(0, 0, 160, 120)}},
+		{image.Point{160, 160}, FitOutside, nil, Layout{image.Point{213, 160}, full, image.Rect(0, 0, 213, 160)}},
+		{image.Point{1280, 1280}, FitInside, nil, Layout{image.Point{640, 480}, full, full}},
+		{image.Point{1280, 1280}, FitContain, &FitOptions{WithoutEnlargement: true}, Layout{image.Point{1280, 1280}, full, image.Rect(320, 400, 960, 880)}},
+		{image.Point{1280, 1280}, FitCover, &FitOptions{WithoutEnlargement: true}, Layout{image.Point{480, 480}, image.Rect(80, 0, 560, 480), image.Rect(0, 0, 480, 480)}},
+		{image.Point{1280, 1280}, FitFill, &FitOptions{WithoutEnlargement: true}, Layout{image.Point{640, 480}, full, full}},
+		{image.Point{320, 0}, FitFill, nil, Layout{image.Point{320, 240}, full, image.Rect(0, 0, 320, 240)}},
+		{image.Point{0, 120}, FitCover, nil, Layout{image.Point{160, 120}, full, image.Rect(0, 0, 160, 120)}},
+		{image.Point{0, 0}, FitContain, nil, Layout{in, full, full}},
+	}
+	for _, item := range tests {
+		layout := ComputeLayout(in, item.box, item.fit, item.opts)
+		if layout != item.layout {
+			t.Errorf("%v %v %+v: expected %+v, got %+v", item.fit, item.box, item.opts, item.layout, layout)
+		}
+		if size := ComputeSize(in, item.box, item.fit, item.opts); size != item.layout.Size {
+			t.Errorf("%v %v: ComputeSize() returned %v, expected %v", item.fit, item.box, size, item.layout.Size)
+		}
+	}
+}
+
+func TestResizeFit(t *testing.T) {
+	in := make([]uint8, 3*640*480)
+	for _, fit := range [...]Fit{FitContain, FitCover, FitFill, FitInside, FitOutside} {
+		var transform Transform
+		out, size, err := ResizeFit(in, 3*640, image.Point{640, 480}, 3, image.Point{100, 0}, fit, nil, InterpolationLinear, &transform)
+		if err != nil {
+			t.Fatalf("%v: ResizeFit() failed: %v", fit, err)
+		}
+		if len(out) != 3*size.X*size.Y || size != transform.OutSize {
+			t.Errorf("%v: unexpected result size %v, len=%v", fit, size, len(out))
+		}
+	}
+
+	if _, _, err := ResizeFit(in, 3*640, image.Point{640, 480}, 3, image.Point{100, 100}, FitContain, &FitOptions{PadColor: []uint8{0}}, InterpolationLinear, nil); err == nil {
+		t.Errorf("expected error for pad color with wrong number of channels")
+	}
+}
+
+func TestParseNames(t *testing.T) {
+	if f, err := ParseFit("Cover"); err != nil || f != FitCover {
+		t.Errorf("ParseFit() returned %v, %v", f, err)
+	}
+	if g, err := ParseGravity("top-left"); err != nil || g != GravityTopLeft {
+		t.Errorf("ParseGravity() returned %v, %v", g, err)
+	}
+	if g, err := ParseGravity("smart"); err != nil || g != GravitySmart {
+		t.Errorf("ParseGravity() returned %v, %v", g, err)
+	}
+	if c, err := ParseCropStrategy("Entropy"); err != nil || c != CropEntropy {
+		t.Errorf("ParseCropStrategy() returned %v, %v", c, err)
+	}
+	if i, err := ParseInterpolation("antialiasing_lanczos"); err != nil || i != InterpolationAntialiasingLanczos {
+		t.Errorf("ParseInterpolation() returned %v, %v", i, err)
+	}
+	if i, err := ParseInterpolation("nearestneighbour"); err != nil || i != InterpolationNearestNeighbour {
+		t.Errorf("ParseInterpolation() returned %v, %v", i, err)
+	}
+	for _, name := range []string{"jpg", ".JPEG", "jpeg"} {
+		if f, err := ParseImageFormat(name); err != nil || f != ImageFormatJPEG {
+			t.Errorf("ParseImageFormat(%q) returned %v, %v", name, f, err)
+		}
+	}
+	if f, err := ParseImageFormat("webp"); err != nil || f != ImageFormatWebP {
+		t.Errorf("ParseImageFormat() returned %v, %v", f, err)
+	}
+
+	if _, err := ParseFit("stretch"); err == nil {
+		t.Errorf("unknown fit should fail")
+	}
+	if _, err := ParseGravity(""); err == nil {
+		t.Errorf("unknown gravity should fail")
+	}
+	if _, err := ParseCropStrategy("saliency"); err == nil {
+		t.Errorf("unknown crop strategy should fail")
+	}
+	if _, err := ParseInterpolation("bicubic"); err == nil {
+		t.Errorf("unknown interpolation should fail")
+	}
+	if _, err := ParseImageFormat("unknown"); err == nil {
+		t.Errorf("unknown format should fail")
+	}
+}
@@ -0,0 +1,679 @@
+package ippresize
+
+/*
+#include "image.h"
+*/
+import "C"
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/anight/go-libjpeg/jpeg"
+	"github.com/anight/go-libjpeg/rgb"
+	"image"
+	"image/color"
+	stdjpeg "image/jpeg"
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+	"unsafe"
+)
+
+const (
+	markerAPP14 = 0xee
+)
+
+var adobeHeader = []byte("Adobe")
+
+// D50 to sRGB linear matrix with Bradford chromatic adaptation, ICC profiles connect through D50 PCS
+var srgbFromXYZ = [3][3]float64{
+	{3.1338561, -1.6168667, -0.4906146},
+	{-0.9787684, 1.9161415, 0.0334540},
+	{0.0719453, -0.2289914, 1.4052427},
+}
+
+// PCS XYZ of D50 white point
+var whiteD50 = [3]float64{0.9642, 1.0, 0.8249}
+
+// iccCurve is a tone reproduction curve of ICC profile mapping 0..1 to 0..1
+type iccCurve struct {
+	table  []float64 // sampled curve, nil for parametric curves
+	kind   int       // parametric curve function type, 0 is plain gamma
+	params []float64 // parametric curve function parameters
+}
+
+func (c *iccCurve) eval(x float64) float64 {
+	if c.table != nil {
+		return interpolateTable(c.table, x)
+	}
+
+	p := c.params
+	var y float64
+	switch c.kind {
+	case 0:
+		y = math.Pow(x, p[0])
+	case 1:
+		if x >= -p[2]/p[1] {
+			y = math.Pow(p[1]*x+p[2], p[0])
+		}
+	case 2:
+		y = p[3]
+		if x >= -p[2]/p[1] {
+			y += math.Pow(p[1]*x+p[2], p[0])
+		}
+	case 3:
+		if x >= p[4] {
+			y = math.Pow(p[1]*x+p[2], p[0])
+		} else {
+			y = p[3] * x
+		}
+	case 4:
+		if x >= p[4] {
+			y = math.Pow(p[1]*x+p[2], p[0]) + p[5]
+		} else {
+			y = p[3]*x + p[6]
+		}
+	}
+	return clamp01(y)
+}
+
+// iccLut is lut8Type or lut16Type transform: input curves, multidimensional table and output curves
+type iccLut struct {
+	inputs, outputs int
+	grid            int
+	input           [][]float64 // per input channel
+	clut            []float64   // grid^inputs points of outputs values, the last input varies fastest
+	output          [][]float64 // per output channel
+	bits            int         // 8 or 16, defines PCS encoding
+}
+
+// eval transforms device values to PCS values in 0..1 encoding of the table
+func (l *iccLut) eval(in []float64, out []float64) {
+	var index [8]int
+	var frac [8]float64
+	for i := 0; i < l.inputs; i++ {
+		v := interpolateTable(l.input[i], in[i]) * float64(l.grid-1)
+		index[i] = int(v)
+		if index[i] >= l.grid-1 {
+			index[i] = l.grid - 2
+		}
+		frac[i] = v - float64(index[i])
+	}
+
+	for o := 0; o < l.outputs; o++ {
+		out[o] = 0
+	}
+
+	// multilinear interpolation over the corners of the grid cell
+	for corner := 0; corner < 1<<uint(l.inputs); corner++ {
+		weight := 1.0
+		offset := 0
+		for i := 0; i < l.inputs; i++ {
+			idx := index[i]
+			if corner&(1<<uint(l.inputs-1-i)) != 0 {
+				idx++
+				weight *= frac[i]
+			} else {
+				weight *= 1 - frac[i]
+			}
+			offset = offset*l.grid + idx
+		}
+		if weight == 0 {
+			continue
+		}
+		for o := 0; o < l.outputs; o++ {
+			out[o] += weight * l.clut[offset*l.outputs+o]
+		}
+	}
+
+	for o := 0; o < l.outputs; o++ {
+		out[o] = interpolateTable(l.output[o], out[o])
+	}
+}
+
+// iccProfile is the subset of ICC profile needed to convert matrix/TRC RGB and lut based CMYK images to sRGB
+type iccProfile struct {
+	colorspace string // data colour space signature: "RGB ", "CMYK", "GRAY", ...
+	pcs        string // "XYZ " or "Lab "
+	matrix     *[3][3]float64
+	trc        [3]*iccCurve
+	a2b        *iccLut
+}
+
+// matrixTRC reports whether the profile is matrix/TRC RGB profile
+func (p *iccProfile) matrixTRC() bool {
+	return p.colorspace == "RGB " && p.matrix != nil && p.trc[0] != nil && p.trc[1] != nil && p.trc[2] != nil
+}
+
+// parseICC parses ICC profile, tags other than needed for conversion to sRGB are ignored
+func parseICC(data []byte) (*iccProfile, error) {
+	if len(data) < 132 || string(data[36:40]) != "acsp" {
+		return nil, NewError(0, "invalid ICC profile header")
+	}
+
+	p := &iccProfile{colorspace: string(data[16:20]), pcs: string(data[20:24])}
+
+	tags := make(map[string][]byte)
+	count := int(binary.BigEndian.Uint32(data[128:]))
+	if 132+12*count > len(data) {
+		return nil, NewError(0, "truncated ICC tag table")
+	}
+	for i := 0; i < count; i++ {
+		entry := data[132+12*i:]
+		offset := int(binary.BigEndian.Uint32(entry[4:]))
+		size := int(binary.BigEndian.Uint32(entry[8:]))
+		if offset < 0 || size < 8 || offset+size > len(data) {
+			return nil, NewError(0, "invalid ICC tag %q: offset=%v, size=%v", entry[:4], offset, size)
+		}
+		tags[string(entry[:4])] = data[offset : offset+size]
+	}
+
+	if p.colorspace == "RGB " && tags["rXYZ"] != nil && tags["gXYZ"] != nil && tags["bXYZ"] != nil {
+		p.matrix = new([3][3]float64)
+		for c, sig := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+			xyz, err := parseXYZ(tags[sig])
+			if err != nil {
+				return nil, err
+			}
+			for r := 0; r < 3; r++ {
+				p.matrix[r][c] = xyz[r]
+			}
+		}
+		for c, sig := range []string{"rTRC", "gTRC", "bTRC"} {
+			if tags[sig] == nil {
+				continue
+			}
+			curve, err := parseCurve(tags[sig])
+			if err != nil {
+				return nil, err
+			}
+			p.trc[c] = curve
+		}
+	}
+
+	if a2b := tags["A2B0"]; p.colorspace == "CMYK" && a2b != nil {
+		lut, err := parseLut(a2b)
+		if err != nil {
+			return nil, err
+		}
+		p.a2b = lut
+	}
+
+	return p, nil
+}
+
+func s15Fixed16(data []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(data))) / 65536
+}
+
+func parseXYZ(data []byte) (xyz [3]float64, err error) {
+	if len(data) < 20 || string(data[:4]) != "XYZ " {
+		err = NewError(0, "invalid ICC XYZ tag")
+		return
+	}
+	for i := range xyz {
+		xyz[i] = s15Fixed16(data[8+4*i:])
+	}
+	return
+}
+
+// parseCurve parses curveType or parametricCurveType tag
+func parseCurve(data []byte) (*iccCurve, error) {
+	switch string(data[:4]) {
+	case "curv":
+		if len(data) < 12 {
+			break
+		}
+		n := int(binary.BigEndian.Uint32(data[8:]))
+		if 12+2*n > len(data) {
+			break
+		}
+		switch n {
+		case 0:
+			return &iccCurve{params: []float64{1}}, nil
+		case 1:
+			return &iccCurve{params: []float64{float64(binary.BigEndian.Uint16(data[12:])) / 256}}, nil
+		}
+		return &iccCurve{table: readTable16(data[12:], n)}, nil
+	case "para":
+		if len(data) < 12 {
+			break
+		}
+		kind := int(binary.BigEndian.Uint16(data[8:]))
+		if kind > 4 {
+			return nil, NewError(0, "unsupported ICC parametric curve type: %v", kind)
+		}
+		n := []int{1, 3, 4, 5, 7}[kind]
+		if 12+4*n > len(data) {
+			break
+		}
+		params := make([]float64, n)
+		for i := range params {
+			params[i] = s15Fixed16(data[12+4*i:])
+		}
+		if kind > 0 && params[1] == 0 {
+			return nil, NewError(0, "invalid ICC parametric curve")
+		}
+		return &iccCurve{kind: kind, params: params}, nil
+	}
+	return nil, NewError(0, "invalid ICC curve tag")
+}
+
+// parseLut parses lut8Type (mft1) and lut16Type (mft2) tags
+func parseLut(data []byte) (*iccLut, error) {
+	if len(data) < 48 {
+		return nil, NewError(0, "truncated ICC lut tag")
+	}
+
+	l := &iccLut{inputs: int(data[8]), outputs: int(data[9]), grid: int(data[10])}
+	if l.inputs < 1 || l.inputs > 8 || l.outputs != 3 || l.grid < 2 {
+		return nil, NewError(0, "unsupported ICC lut: inputs=%v, outputs=%v, grid=%v", l.inputs, l.outputs, l.grid)
+	}
+
+	points := 1
+	for i := 0; i < l.inputs; i++ {
+		points *= l.grid
+	}
+
+	var in_entries, out_entries, size int
+	read := readTable8
+	pos := 48
+
+	switch string(data[:4]) {
+	case "mft1":
+		l.bits = 8
+		in_entries, out_entries, size = 256, 256, 1
+	case "mft2":
+		if len(data) < 52 {
+			return nil, NewError(0, "truncated ICC lut tag")
+		}
+		l.bits = 16
+		in_entries = int(binary.BigEndian.Uint16(data[48:]))
+		out_entries = int(binary.BigEndian.Uint16(data[50:]))
+		size = 2
+		read = readTable16
+		pos = 52
+		if in_entries < 2 || out_entries < 2 {
+			return nil, NewError(0, "invalid ICC lut table size")
+		}
+	default:
+		return nil, NewError(0, "unsupported ICC lut tag type: %q", data[:4])
+	}
+
+	if pos+size*(l.inputs*in_entries+points*l.outputs+l.outputs*out_entries) > len(data) {
+		return nil, NewError(0, "truncated ICC lut tag")
+	}
+
+	for i := 0; i < l.inputs; i++ {
+		l.input = append(l.input, read(data[pos:], in_entries))
+		pos += size * in_entries
+	}
+	l.clut = read(data[pos:], points*l.outputs)
+	pos += size * points * l.outputs
+	for i := 0; i < l.outputs; i++ {
+		l.output = append(l.output, read(data[pos:], out_entries))
+		pos += size * out_entries
+	}
+
+	return l, nil
+}
+
+func readTable8(data []byte, n int) []float64 {
+	table := make([]float64, n)
+	for i := range table {
+		table[i] = float64(data[i]) / 255
+	}
+	return table
+}
+
+func readTable16(data []byte, n int) []float64 {
+	table := make([]float64, n)
+	for i := range table {
+		table[i] = float64(binary.BigEndian.Uint16(data[2*i:])) / 65535
+	}
+	return table
+}
+
+func interpolateTable(table []float64, x float64) float64 {
+	x = clamp01(x) * float64(len(table)-1)
+	i := int(x)
+	if i >= len(table)-1 {
+		return table[len(table)-1]
+	}
+	f := x - float64(i)
+	return table[i]*(1-f) + table[i+1]*f
+}
+
+func clamp01(x float64) float64 {
+	if x < 0 {
+		return 0
+	}
+	if x > 1 {
+		return 1
+	}
+	return x
+}
+
+// pcsToXYZ converts PCS values in 0..1 encoding of the lut to XYZ
+func (l *iccLut) pcsToXYZ(pcs string, v []float64) (xyz [3]float64) {
+	if pcs == "XYZ " {
+		// 1.0 is encoded as 0x8000 of 0xffff
+		for i := range xyz {
+			xyz[i] = v[i] * 65535 / 32768
+		}
+		return
+	}
+
+	var lab [3]float64
+	if l.bits == 8 {
+		lab = [3]float64{v[0] * 100, v[1]*255 - 128, v[2]*255 - 128}
+	} else {
+		// legacy 16 bit Lab encoding, 0xff00 is L=100
+		s := 65535.0 / 65280
+		lab = [3]float64{v[0] * s * 100, v[1]*s*255 - 128, v[2]*s*255 - 128}
+	}
+
+	f := func(t float64) float64 {
+		if t > 6.0/29 {
+			return t * t * t
+		}
+		return 3 * (6.0 / 29) * (6.0 / 29) * (t - 4.0/29)
+	}
+	fy := (lab[0] + 16) / 116
+	xyz[0] = whiteD50[0] * f(fy+lab[1]/500)
+	xyz[1] = whiteD50[1] * f(fy)
+	xyz[2] = whiteD50[2] * f(fy-lab[2]/200)
+	return
+}
+
+var srgbEncode struct {
+	once sync.Once
+	lut  [65536]uint8
+}
+
+// srgbEncodeLUT maps linear 0..65535 to sRGB gamma encoded 0..255
+func srgbEncodeLUT() *[65536]uint8 {
+	srgbEncode.once.Do(func() {
+		for i := range srgbEncode.lut {
+			v := float64(i) / 65535
+			if v <= 0.0031308 {
+				v *= 12.92
+			} else {
+				v = 1.055*math.Pow(v, 1/2.4) - 0.055
+			}
+			srgbEncode.lut[i] = uint8(math.Round(255 * v))
+		}
+	})
+	return &srgbEncode.lut
+}
+
+// colorTwist applies the matrix with the scale to 16 bit pixels in place and converts the result to sRGB
+func colorTwist(pix []uint16, size image.Point, matrix [3][3]float64, scale float64) (*rgb.Image, error) {
+	var twist [3][4]C.float
+	for r := 0; r < 3; r++ {
+		for c := 0; c < 3; c++ {
+			twist[r][c] = C.float(matrix[r][c] * scale)
+		}
+	}
+
+	out := &rgb.Image{Pix: make([]uint8, 3*size.X*size.Y), Stride: 3 * size.X, Rect: image.Rectangle{Max: size}}
+
+	var img_in C.struct_image_s
+	img_in.w = C.uint(size.X)
+	img_in.h = C.uint(size.Y)
+	img_in.channels = 3
+	img_in.rowstep = C.size_t(6 * size.X)
+	img_in_data := (*C.ushort)(unsafe.Pointer(&pix[0]))
+
+	var img_out C.struct_image_s
+	img_out.w = C.uint(size.X)
+	img_out.h = C.uint(size.Y)
+	img_out.channels = 3
+	img_out.rowstep = C.size_t(out.Stride)
+	img_out_data := (*C.uchar)(unsafe.Pointer(&out.Pix[0]))
+
+	lut := srgbEncodeLUT()
+	lut_data := (*C.uchar)(unsafe.Pointer(&lut[0]))
+
+	const err_size = 1024
+	var cerr [err_size]C.char
+
+	ret := C.image_ipp_color_twist(&img_in, img_in_data, &twist[0], lut_data, &img_out, img_out_data, &cerr[0], err_size)
+
+	/* make 100% sure garbage collector wont kill these objects in the middle of execution of c function */
+	runtime.KeepAlive(img_in)
+	runtime.KeepAlive(img_in_data)
+	runtime.KeepAlive(twist)
+	runtime.KeepAlive(lut_data)
+	runtime.KeepAlive(img_out)
+	runtime.KeepAlive(img_out_data)
+
+	if ret != 0 {
+		return nil, NewError(int(ret), "C.image_ipp_color_twist() failed: %v", C.GoString(&cerr[0]))
+	}
+
+	return out, nil
+}
+
+func mulMatrix(a, b [3][3]float64) (m [3][3]float64) {
+	for r := 0; r < 3; r++ {
+		for c := 0; c < 3; c++ {
+			for k := 0; k < 3; k++ {
+				m[r][c] += a[r][k] * b[k][c]
+			}
+		}
+	}
+	return
+}
+
+// rgbToSRGB converts the image from the matrix/TRC RGB profile colors to sRGB
+func (p *iccProfile) rgbToSRGB(im *rgb.Image) (*rgb.Image, error) {
+	size := im.Rect.Size()
+	if size.X <= 0 || size.Y <= 0 {
+		return nil, NewError(0, "one of the input image dimensions is invalid: {width: %v, height: %v}", size.X, size.Y)
+	}
+
+	var linear [3][256]uint16
+	for c := range linear {
+		for i := range linear[c] {
+			linear[c][i] = uint16(math.Round(65535 * p.trc[c].eval(float64(i)/255)))
+		}
+	}
+
+	pix := make([]uint16, 3*size.X*size.Y)
+	for y := 0; y < size.Y; y++ {
+		row := im.Pix[y*im.Stride:]
+		out := pix[3*size.X*y:]
+		for x := 0; x < 3*size.X; x += 3 {
+			out[x] = linear[0][row[x]]
+			out[x+1] = linear[1][row[x+1]]
+			out[x+2] = linear[2][row[x+2]]
+		}
+	}
+
+	return colorTwist(pix, size, mulMatrix(srgbFromXYZ, *p.matrix), 1)
+}
+
+// cmykToSRGB converts the image to sRGB with A2B0 transform of the profile, naively if there is no profile
+func cmykToSRGB(im *image.CMYK, p *iccProfile) (*rgb.Image, error) {
+	size := im.Rect.Size()
+	if size.X <= 0 || size.Y <= 0 {
+		return nil, NewError(0, "one of the input image dimensions is invalid: {width: %v, height: %v}", size.X, size.Y)
+	}
+
+	if p == nil || p.colorspace != "CMYK" || p.a2b == nil || p.a2b.inputs != 4 {
+		out := &rgb.Image{Pix: make([]uint8, 3*size.X*size.Y), Stride: 3 * size.X, Rect: image.Rectangle{Max: size}}
+		for y := 0; y < size.Y; y++ {
+			row := im.Pix[y*im.Stride:]
+			dst := out.Pix[y*out.Stride:]
+			for x := 0; x < size.X; x++ {
+				dst[3*x], dst[3*x+1], dst[3*x+2] = color.CMYKToRGB(row[4*x], row[4*x+1], row[4*x+2], row[4*x+3])
+			}
+		}
+		return out, nil
+	}
+
+	// the same colors are common, evaluation of the table is not cheap
+	cache := make(map[uint32][3]uint16)
+
+	in := make([]float64, 4)
+	pcs := make([]float64, 3)
+	pix := make([]uint16, 3*size.X*size.Y)
+	for y := 0; y < size.Y; y++ {
+		row := im.Pix[y*im.Stride:]
+		dst := pix[3*size.X*y:]
+		for x := 0; x < size.X; x++ {
+			key := binary.BigEndian.Uint32(row[4*x:])
+			v, ok := cache[key]
+			if !ok {
+				for i := range in {
+					in[i] = float64(row[4*x+i]) / 255
+				}
+				p.a2b.eval(in, pcs)
+				xyz := p.a2b.pcsToXYZ(p.pcs, pcs)
+				for i := range v {
+					// 1.0 is 32768, leaving room for values above the white point
+					v[i] = uint16(math.Round(32768 * math.Min(math.Max(xyz[i], 0), 65535.0/32768)))
+				}
+				if len(cache) < 1<<16 {
+					cache[key] = v
+				}
+			}
+			copy(dst[3*x:3*x+3], v[:])
+		}
+	}
+
+	return colorTwist(pix, size, srgbFromXYZ, 65535.0/32768)
+}
+
+// iccProfileData concatenates chunks of ICC profile stored in APP2 segments, nil if there are none
+func iccProfileData(segments []jpegSegment) []byte {
+	type chunk struct {
+		seq  int
+		data []byte
+	}
+
+	var chunks []chunk
+	for _, s := range segments {
+		if s.marker == markerAPP2 && bytes.HasPrefix(s.data, iccHeader) && len(s.data) >= len(iccHeader)+2 {
+			chunks = append(chunks, chunk{int(s.data[len(iccHeader)]), s.data[len(iccHeader)+2:]})
+		}
+	}
+
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(chunks, func(i, j int) bool { return chunks[i].seq < chunks[j].seq })
+
+	var data []byte
+	for _, c := range chunks {
+		data = append(data, c.data...)
+	}
+	return data
+}
+
+// jpegComponents returns the number of color components from the frame header, 0 if there is none
+func jpegComponents(segments []jpegSegment) int {
+	for _, s := range segments {
+		// SOF0..SOF15 except DHT, JPG and DAC
+		if s.marker >= 0xc0 && s.marker <= 0xcf && s.marker != 0xc4 && s.marker != 0xc8 && s.marker != 0xcc && len(s.data) >= 6 {
+			return int(s.data[5])
+		}
+	}
+	return 0
+}
+
+// decodeCMYK decodes 4 component jpeg image. Adobe applications store CMYK inverted marking the stream
+// with APP14 segment, the decoder expects it, so streams without one are decoded with a fake one and inverted back.
+func decodeCMYK(data []byte, segments []jpegSegment) (*image.CMYK, error) {
+	adobe := false
+	for _, s := range segments {
+		if s.marker == markerAPP14 && bytes.HasPrefix(s.data, adobeHeader) {
+			adobe = true
+		}
+	}
+
+	if !adobe {
+		// version 100, no flags, no transform
+		app14 := append([]byte{0xff, markerAPP14, 0, 14}, adobeHeader...)
+		app14 = append(app14, 0, 100, 0, 0, 0, 0, 0)
+		data = append(append(append([]byte{}, data[:2]...), app14...), data[2:]...)
+	}
+
+	im, err := stdjpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	cmyk, ok := im.(*image.CMYK)
+	if !ok {
+		return nil, NewError(0, "unexpected color model of 4 component jpeg image: %T", im)
+	}
+
+	if !adobe {
+		for i, v := range cmyk.Pix {
+			cmyk.Pix[i] = 255 - v
+		}
+	}
+
+	return cmyk, nil
+}
+
+// decodeManaged decodes the jpeg image converting it to sRGB according to its embedded ICC profile.
+// CMYK images are decoded at full size and converted even if they have no profile, images without
+// supported profile are decoded as usual.
+func decodeManaged(data []byte, colorspace jpeg.OutColorSpace, bbox image.Point, opts *DecodeOptions) (image.Image, error) {
+	segments, err := jpegSegments(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// broken and unsupported profiles are ignored the same way as by color unaware decoders
+	profile, _ := parseICC(iccProfileData(segments))
+
+	var out *rgb.Image
+
+	switch {
+	case jpegComponents(segments) == 4:
+		cmyk, err := decodeCMYK(data, segments)
+		if err != nil {
+			return nil, err
+		}
+		out, err = cmykToSRGB(cmyk, profile)
+		if err != nil {
+			return nil, err
+		}
+	case profile != nil && profile.matrixTRC():
+		im, err := jpeg.Decode(bytes.NewReader(data), opts.decoderOptions(jpeg.OutColorSpaceRGB, bbox))
+		if err != nil {
+			return nil, err
+		}
+		src, ok := im.(*rgb.Image)
+		if !ok {
+			return im, nil
+		}
+		out, err = profile.rgbToSRGB(src)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return jpeg.Decode(bytes.NewReader(data), opts.decoderOptions(colorspace, bbox))
+	}
+
+	if colorspace == jpeg.OutColorSpaceSame || colorspace == jpeg.OutColorSpaceRGB {
+		return out, nil
+	}
+	return normalizeImage(out, colorspace, opts.background()), nil
+}
+
+// convertsColors reports whether decodeManaged() converts colors of the jpeg image
+func convertsColors(data []byte) bool {
+	segments, _ := jpegSegments(data)
+	if jpegComponents(segments) == 4 {
+		return true
+	}
+	profile, err := parseICC(iccProfileData(segments))
+	return err == nil && profile.matrixTRC()
+}
@@ -0,0 +1,279 @@
+package ippresize
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/anight/go-libjpeg/jpeg"
+	"github.com/anight/go-libjpeg/rgb"
+	"image"
+	"os"
+	"testing"
+)
+
+type iccTag struct {
+	sig  string
+	data []byte
+}
+
+func buildICC(colorspace, pcs string, tags ...iccTag) []byte {
+	header := make([]byte, 128)
+	copy(header[16:], colorspace)
+	copy(header[20:], pcs)
+	copy(header[36:], "acsp")
+
+	var table, data bytes.Buffer
+	binary.Write(&table, binary.BigEndian, uint32(len(tags)))
+	offset := 128 + 4 + 12*len(tags)
+	for _, t := range tags {
+		table.WriteString(t.sig)
+		binary.Write(&table, binary.BigEndian, []uint32{uint32(offset + data.Len()), uint32(len(t.data))})
+		data.Write(t.data)
+		for data.Len()%4 != 0 {
+			data.WriteByte(0)
+		}
+	}
+
+	profile := append(header, table.Bytes()...)
+	profile = append(profile, data.Bytes()...)
+	binary.BigEndian.PutUint32(profile, uint32(len(profile)))
+	return profile
+}
+
+func fixed(v float64) uint32 {
+	return uint32(int32(v * 65536))
+}
+
+func xyzTag(x, y, z float64) []byte {
+	var b bytes.Buffer
+	b.WriteString("XYZ \x00\x00\x00\x00")
+	binary.Write(&b, binary.BigEndian, []uint32{fixed(x), fixed(y), fixed(z)})
+	return b.Bytes()
+}
+
+func paraTag(kind uint16, params ...float64) []byte {
+	var b bytes.Buffer
+	b.WriteString("para\x00\x00\x00\x00")
+	binary.Write(&b, binary.BigEndian, []uint16{kind, 0})
+	for _, p := range params {
+		binary.Write(&b, binary.BigEndian, fixed(p))
+	}
+	return b.Bytes()
+}
+
+// rgbProfile returns matrix/TRC profile with sRGB primaries and the given curve
+func rgbProfile(trc []byte) []byte {
+	return buildICC("RGB ", "XYZ ",
+		iccTag{"rXYZ", xyzTag(0.4361, 0.2225, 0.0139)},
+		iccTag{"gXYZ", xyzTag(0.3851, 0.7169, 0.0971)},
+		iccTag{"bXYZ", xyzTag(0.1431, 0.0606, 0.7141)},
+		iccTag{"rTRC", trc}, iccTag{"gTRC", trc}, iccTag{"bTRC", trc})
+}
+
+var srgbTRC = paraTag(3, 2.4, 1/1.055, 0.055/1.055, 1/12.92, 0.04045)
+
+// cmykProfile returns lut16 Lab profile where only black ink matters
+func cmykProfile() []byte {
+	var b bytes.Buffer
+	b.WriteString("mft2\x00\x00\x00\x00")
+	b.Write([]byte{4, 3, 2, 0})
+	for _, v := range []float64{1, 0, 0, 0, 1, 0, 0, 0, 1} {
+		binary.Write(&b, binary.BigEndian, fixed(v))
+	}
+	binary.Write(&b, binary.BigEndian, []uint16{2, 2})
+	for i := 0; i < 4; i++ {
+		binary.Write(&b, binary.BigEndian, []uint16{0, 0xffff})
+	}
+	for c := 0; c < 16; c++ {
+		l := uint16(0xff00)
+		if c&1 != 0 {
+			l = 0
+		}
+		binary.Write(&b, binary.BigEndian, []uint16{l, 0x8000, 0x8000})
+	}
+	for i := 0; i < 3; i++ {
+		binary.Write(&b, binary.BigEndian, []uint16{0, 0xffff})
+	}
+	return buildICC("CMYK", "Lab ", iccTag{"A2B0", b.Bytes()})
+}
+
+// withICC inserts the profile into the jpeg stream split into APP2 chunks of the given size
+func withICC(data []byte, profile []byte, chunk int) []byte {
+	var out bytes.Buffer
+	out.Write(data[:2])
+	count := (len(profile) + chunk - 1) / chunk
+	for i := 0; i < count; i++ {
+		end := (i + 1) * chunk
+		if end > len(profile) {
+			end = len(profile)
+		}
+		payload := append(append([]byte{}, iccHeader...), byte(i+1), byte(count))
+		payload = append(payload, profile[i*chunk:end]...)
+		out.Write([]byte{0xff, markerAPP2})
+		binary.Write(&out, binary.BigEndian, uint16(len(payload)+2))
+		out.Write(payload)
+	}
+	out.Write(data[2:])
+	return out.Bytes()
+}
+
+func TestParseICC(t *testing.T) {
+	p, err := parseICC(rgbProfile(srgbTRC))
+	if err != nil {
+		t.Fatalf("parseICC() failed: %v", err)
+	}
+	if !p.matrixTRC() {
+		t.Fatalf("expected matrix/TRC profile: %+v", p)
+	}
+	if v := p.trc[0].eval(0.5); v < 0.213 || v > 0.215 {
+		t.Errorf("unexpected sRGB curve value: %v", v)
+	}
+
+	p, err = parseICC(cmykProfile())
+	if err != nil {
+		t.Fatalf("parseICC() failed: %v", err)
+	}
+	if p.colorspace != "CMYK" || p.a2b == nil || p.a2b.inputs != 4 || p.a2b.bits != 16 {
+		t.Errorf("unexpected CMYK profile: %+v", p)
+	}
+
+	for _, data := range [][]byte{nil, make([]byte, 200), rgbProfile([]byte("curv\x00\x00\x00\x00\x00\x00\x00\x10"))} {
+		if _, err := parseICC(data); err == nil {
+			t.Errorf("parseICC(%q) should fail", data)
+		}
+	}
+}
+
+func TestICCProfileData(t *testing.T) {
+	data, err := os.ReadFile("./test.jpg")
+	if err != nil {
+		t.Fatalf("os.ReadFile() failed: %v", err)
+	}
+
+	profile := rgbProfile(srgbTRC)
+	segments, err := jpegSegments(withICC(data, profile, 100))
+	if err != nil {
+		t.Fatalf("jpegSegments() failed: %v", err)
+	}
+
+	// chunks are ordered by their sequence numbers
+	segments[0], segments[1] = segments[1], segments[0]
+	if !bytes.Equal(iccProfileData(segments), profile) {
+		t.Errorf("profile is not reassembled")
+	}
+
+	if jpegComponents(segments) != 3 {
+		t.Errorf("unexpected number of components: %v", jpegComponents(segments))
+	}
+}
+
+func TestRGBToSRGB(t *testing.T) {
+	im := rgb.NewImage(image.Rect(0, 0, 16, 16))
+	for i := range im.Pix {
+		im.Pix[i] = uint8(i)
+	}
+
+	p, _ := parseICC(rgbProfile(srgbTRC))
+	out, err := p.rgbToSRGB(im)
+	if err != nil {
+		t.Fatalf("rgbToSRGB() failed: %v", err)
+	}
+	for i, v := range out.Pix {
+		if d := int(v) - int(im.Pix[i]); d < -2 || d > 2 {
+			t.Fatalf("sRGB to sRGB mismatch at %v: %v vs %v", i, v, im.Pix[i])
+		}
+	}
+
+	// linear gray 128 is 188 in sRGB
+	p, _ = parseICC(rgbProfile([]byte("curv\x00\x00\x00\x00\x00\x00\x00\x00")))
+	for i := range im.Pix {
+		im.Pix[i] = 128
+	}
+	out, err = p.rgbToSRGB(im)
+	if err != nil {
+		t.Fatalf("rgbToSRGB() failed: %v", err)
+	}
+	if v := out.Pix[0]; v < 186 || v > 190 {
+		t.Errorf("unexpected linear to sRGB conversion: %v", v)
+	}
+}
+
+func TestCMYKToSRGB(t *testing.T) {
+	im := image.NewCMYK(image.Rect(0, 0, 3, 1))
+	copy(im.Pix, []uint8{0, 0, 0, 0, 255, 255, 255, 128, 0, 0, 0, 255})
+
+	p, _ := parseICC(cmykProfile())
+	out, err := cmykToSRGB(im, p)
+	if err != nil {
+		t.Fatalf("cmykToSRGB() failed: %v", err)
+	}
+
+	// L=50 is 119 in sRGB
+	for i, expect := range []uint8{255, 119, 0} {
+		for c := 0; c < 3; c++ {
+			if d := int(out.Pix[3*i+c]) - int(expect); d < -3 || d > 3 {
+				t.Errorf("pixel %v: expected %v, got %v", i, expect, out.Pix[3*i:3*i+3])
+				break
+			}
+		}
+	}
+
+	// without profile
+	out, err = cmykToSRGB(im, nil)
+	if err != nil {
+		t.Fatalf("cmykToSRGB() failed: %v", err)
+	}
+	if out.Pix[0] != 255 || out.Pix[3] != 0 || out.Pix[6] != 0 {
+		t.Errorf("unexpected naive conversion: %v", out.Pix)
+	}
+}
+
+func TestColorManagement(t *testing.T) {
+	data, err := os.ReadFile("./test.jpg")
+	if err != nil {
+		t.Fatalf("os.ReadFile() failed: %v", err)
+	}
+	data = withICC(data, rgbProfile(srgbTRC), 1000)
+
+	opts := &DecodeOptions{ColorManagement: true}
+
+	managed, err := DecodeWithOptions(bytes.NewReader(data), jpeg.OutColorSpaceRGB, image.Point{100, 100}, opts)
+	if err != nil {
+		t.Fatalf("DecodeWithOptions() failed: %v", err)
+	}
+	plain, err := DecodeWithOptions(bytes.NewReader(data), jpeg.OutColorSpaceRGB, image.Point{100, 100}, nil)
+	if err != nil {
+		t.Fatalf("DecodeWithOptions() failed: %v", err)
+	}
+
+	m, p := managed.(*rgb.Image), plain.(*rgb.Image)
+	if m.Rect != p.Rect {
+		t.Fatalf("size mismatch: %v vs %v", m.Rect, p.Rect)
+	}
+	for i := range m.Pix {
+		if d := int(m.Pix[i]) - int(p.Pix[i]); d < -2 || d > 2 {
+			t.Fatalf("sRGB profile changes colors at %v: %v vs %v", i, m.Pix[i], p.Pix[i])
+		}
+	}
+
+	gray, err := DecodeWithOptions(bytes.NewReader(data), jpeg.OutColorSpaceGray, image.Point{100, 100}, opts)
+	if err != nil {
+		t.Fatalf("DecodeWithOptions() failed: %v", err)
+	}
+	if _, ok := gray.(*image.Gray); !ok {
+		t.Errorf("unexpected image type: %T", gray)
+	}
+
+	// the profile doesn't describe converted colors anymore
+	for _, cm := range []bool{false, true} {
+		var buf bytes.Buffer
+		_, err = ResizeJpeg(bytes.NewReader(data), &buf, image.Point{100, 100}, &JpegOptions{Metadata: MetadataKeepICC},
+			WithDecodeOptions(&DecodeOptions{ColorManagement: cm}))
+		if err != nil {
+			t.Fatalf("ResizeJpeg() failed: %v", err)
+		}
+		segments, _ := jpegSegments(buf.Bytes())
+		if (iccProfileData(segments) != nil) == cm {
+			t.Errorf("ColorManagement=%v: unexpected ICC profile presence", cm)
+		}
+	}
+}
@@ -1,4 +1,6 @@
 
+#include <stdio.h>
+
 #include <ipp.h>
 
 #include "image.h"
@@ -8,3 +10,9 @@ void image_init()
 	ippInit();
 }
 
+
+void image_ipp_version(char *buf, size_t size)
+{
+	const IppLibraryVersion *version = ippiGetLibVersion();
+	snprintf(buf, size, "%s %s", version->Name, version->Version);
+}
@@ -21,18 +21,69 @@ typedef enum {
 	IMAGE_INTERPOLATION_ANTIALIASING_LANCZOS,
 } image_interpolation_t;
 
+typedef enum {
+	IMAGE_BORDER_REPLICATE = 1,
+	IMAGE_BORDER_REFLECT,
+	IMAGE_BORDER_REFLECT_101,
+	IMAGE_BORDER_WRAP,
+	IMAGE_BORDER_CONSTANT,
+} image_border_t;
+
+/* values of exif Orientation tag */
+typedef enum {
+	IMAGE_ORIENTATION_NORMAL = 1,
+	IMAGE_ORIENTATION_FLIP_HORIZONTAL,
+	IMAGE_ORIENTATION_ROTATE_180,
+	IMAGE_ORIENTATION_FLIP_VERTICAL,
+	IMAGE_ORIENTATION_TRANSPOSE,
+	IMAGE_ORIENTATION_ROTATE_90,
+	IMAGE_ORIENTATION_TRANSVERSE,
+	IMAGE_ORIENTATION_ROTATE_270,
+} image_orientation_t;
+
 typedef enum {
 	/* hope this won't overlap with IppStatus values from ipptypes.h */
 	IMAGE_ERR_MEMORY_ALLOCATION_FAILED = -100001,
 	IMAGE_ERR_INVALID_NUMBER_CHANNELS = -100002,
 	IMAGE_ERR_OUT_IMAGE_UNALLOCATED = -100003,
 	IMAGE_ERR_INVALID_INTERPOLATION = -100004,
+	IMAGE_ERR_INVALID_BORDER = -100005,
+	IMAGE_ERR_INVALID_ORIENTATION = -100006,
+	IMAGE_ERR_WEBP_DECODE_FAILED = -100007,
+	IMAGE_ERR_WEBP_ENCODE_FAILED = -100008,
+	IMAGE_ERR_JPEG_DECODE_FAILED = -100009,
 } image_error_t;
 
+struct image_resize_spec_s;
+struct image_jpeg_reader_s;
+
 void image_init();
+void image_ipp_version(char *buf, size_t size);
 image_interpolation_t image_interpolation_by_name(const char *name);
 int image_ipp_resize(const struct image_s *in, const unsigned char *in_data, struct image_s *out, unsigned char *out_data, image_interpolation_t interpolation, char *err, size_t err_size);
+int image_ipp_resize_spec_create(unsigned in_w, unsigned in_h, unsigned out_w, unsigned out_h, image_interpolation_t interpolation, struct image_resize_spec_s **spec, char *err, size_t err_size);
+int image_ipp_resize_with_spec(const struct image_resize_spec_s *spec, const struct image_s *in, const unsigned char *in_data, struct image_s *out, unsigned char *out_data, char *err, size_t err_size);
+void image_ipp_resize_spec_free(struct image_resize_spec_s *spec);
+int image_ipp_resize_src_rows(const struct image_resize_spec_s *spec, unsigned out_y, unsigned out_h, unsigned *in_y, unsigned *in_h, unsigned *in_offset_y, char *err, size_t err_size);
+int image_ipp_resize_rows(const struct image_resize_spec_s *spec, const struct image_s *in, const unsigned char *in_data, struct image_s *out, unsigned char *out_data, unsigned out_y, char *err, size_t err_size);
+int image_ipp_warp_affine(const struct image_s *in, const unsigned char *in_data, struct image_s *out, unsigned char *out_data, const double coeffs[2][3], image_interpolation_t interpolation, char *err, size_t err_size);
 int image_ipp_replicate_border_inplace(struct image_s *dst_im, unsigned char *dst_im_data, unsigned src_off_x, unsigned src_off_y, unsigned src_w, unsigned src_h, char *err, size_t err_size);
+int image_ipp_copy_border_inplace(struct image_s *dst_im, unsigned char *dst_im_data, unsigned src_off_x, unsigned src_off_y, unsigned src_w, unsigned src_h, image_border_t border, const unsigned char *value, char *err, size_t err_size);
+int image_ipp_copy_border(const struct image_s *src_im, const unsigned char *src_im_data, struct image_s *dst_im, unsigned char *dst_im_data, unsigned dst_off_x, unsigned dst_off_y, image_border_t border, const unsigned char *value, char *err, size_t err_size);
+int image_ipp_orient(const struct image_s *in, const unsigned char *in_data, struct image_s *out, unsigned char *out_data, image_orientation_t orientation, char *err, size_t err_size);
+int image_ipp_color_twist(struct image_s *in, unsigned short *in_data, const float twist[3][4], const unsigned char *out_lut, struct image_s *out, unsigned char *out_data, char *err, size_t err_size);
+int image_ipp_norm_diff(const struct image_s *a, const unsigned char *a_data, const struct image_s *b, const unsigned char *b_data, int l2, double *value, char *err, size_t err_size);
+int image_ipp_quality_index(const struct image_s *a, const unsigned char *a_data, const struct image_s *b, const unsigned char *b_data, float *value, char *err, size_t err_size);
+int image_webp_get_features(const unsigned char *data, size_t data_size, unsigned *w, unsigned *h, int *has_alpha, char *err, size_t err_size);
+int image_webp_decode(const unsigned char *data, size_t data_size, struct image_s *out, unsigned char *out_data, int no_fancy_upsampling, char *err, size_t err_size);
+int image_webp_encode(const struct image_s *in, const unsigned char *in_data, float quality, int lossless, int method, unsigned char **out_data, size_t *out_size, char *err, size_t err_size);
+void image_webp_free(void *ptr);
+int image_jpeg_reader_create(struct image_jpeg_reader_s **reader, char *err, size_t err_size);
+int image_jpeg_reader_feed(struct image_jpeg_reader_s *reader, const unsigned char *data, size_t data_size, char *err, size_t err_size);
+int image_jpeg_reader_read_header(struct image_jpeg_reader_s *reader, unsigned *w, unsigned *h, int *suspended, char *err, size_t err_size);
+int image_jpeg_reader_start(struct image_jpeg_reader_s *reader, unsigned channels, unsigned scale_num, unsigned *w, unsigned *h, int *suspended, char *err, size_t err_size);
+int image_jpeg_reader_read_row(struct image_jpeg_reader_s *reader, unsigned char *row, int *suspended, char *err, size_t err_size);
+void image_jpeg_reader_free(struct image_jpeg_reader_s *reader);
 const char *image_strerror(int code);
 
 #endif
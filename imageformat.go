@@ -0,0 +1,237 @@
+package ippresize
+
+//go:generate stringer -type=ImageFormat -trimprefix ImageFormat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/anight/go-libjpeg/jpeg"
+	"github.com/anight/go-libjpeg/rgb"
+	"golang.org/x/image/bmp"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+	"strings"
+)
+
+// ImageFormat is the format of the encoded input image
+type ImageFormat int
+
+const (
+	ImageFormatUnknown ImageFormat = iota
+	ImageFormatJPEG
+	ImageFormatPNG
+	ImageFormatGIF
+	ImageFormatBMP
+	ImageFormatWebP
+)
+
+// ParseImageFormat returns the format by its name or file extension, e.g. "webp" or ".jpg"
+func ParseImageFormat(name string) (ImageFormat, error) {
+	name = strings.TrimPrefix(name, ".")
+	if strings.EqualFold(name, "jpg") {
+		return ImageFormatJPEG, nil
+	}
+	for f := ImageFormatJPEG; f <= ImageFormatWebP; f++ {
+		if matchName(name, f) {
+			return f, nil
+		}
+	}
+	return ImageFormatUnknown, NewError(0, "unknown image format: %q", name)
+}
+
+// SniffFormat detects the format of the encoded image by its signature
+func SniffFormat(data []byte) ImageFormat {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xff\xd8\xff")):
+		return ImageFormatJPEG
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return ImageFormatPNG
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return ImageFormatGIF
+	case isBMP(data):
+		return ImageFormatBMP
+	case isWebP(data):
+		return ImageFormatWebP
+	}
+	return ImageFormatUnknown
+}
+
+// SniffSize returns the stored size of the encoded image without decoding it, EXIF orientation is not applied
+func SniffSize(data []byte) (size image.Point, format ImageFormat, err error) {
+	format = SniffFormat(data)
+
+	var config image.Config
+	switch format {
+	case ImageFormatUnknown:
+		err = NewError(0, "unknown image format")
+		return
+	case ImageFormatWebP:
+		size, _, err = webpFeatures(data)
+		return
+	case ImageFormatJPEG:
+		config, err = jpeg.DecodeConfig(bytes.NewReader(data))
+	default:
+		config, _, err = image.DecodeConfig(bytes.NewReader(data))
+	}
+	if err != nil {
+		return
+	}
+
+	size = image.Point{config.Width, config.Height}
+	return
+}
+
+// DecodeAny works like Decode() for JPEG, WebP, PNG, GIF (the first frame) and BMP images.
+// WebP images are scaled by libwebp, see DecodeWebP(). PNG, GIF and BMP images are decoded at full size.
+// Images other than JPEG are normalized to the colorspace, see DecodeAnyWithOptions().
+func DecodeAny(reader io.Reader, colorspace jpeg.OutColorSpace, bbox image.Point) (image.Image, ImageFormat, error) {
+	return DecodeAnyWithOptions(reader, colorspace, bbox, nil)
+}
+
+// DecodeAnyWithOptions works like DecodeAny() with the given options.
+// Images other than JPEG are returned as *image.Gray, *rgb.Image or *image.RGBA with premultiplied alpha
+// for OutColorSpaceGray, OutColorSpaceRGB and OutColorSpaceRGBA respectively. Gray and RGB images are
+// composed over the background of the options. OutColorSpaceSame keeps gray images gray,
+// images with alpha channel RGBA and the rest RGB.
+func DecodeAnyWithOptions(reader io.Reader, colorspace jpeg.OutColorSpace, bbox image.Point, opts *DecodeOptions) (image.Image, ImageFormat, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, ImageFormatUnknown, err
+	}
+
+	format := SniffFormat(data)
+	switch format {
+	case ImageFormatJPEG:
+		im, err := DecodeWithOptions(bytes.NewReader(data), colorspace, bbox, opts)
+		return im, format, err
+	case ImageFormatWebP:
+		im, err := decodeWebP(data, colorspace, bbox, opts)
+		return im, format, err
+	}
+
+	im, err := decodeNonJpeg(data, format, colorspace, opts)
+	return im, format, err
+}
+
+// isBMP checks the signature, the pixel data offset and the length of the DIB header of the BMP file header
+func isBMP(data []byte) bool {
+	if len(data) < 18 || !bytes.HasPrefix(data, []byte("BM")) {
+		return false
+	}
+
+	file_size := binary.LittleEndian.Uint32(data[2:6])
+	offset := binary.LittleEndian.Uint32(data[10:14])
+	dib_size := binary.LittleEndian.Uint32(data[14:18])
+
+	switch dib_size {
+	case 12, 40, 52, 56, 64, 108, 124:
+	default:
+		return false
+	}
+
+	// some writers leave the file size zero
+	return offset >= 14+dib_size && (file_size == 0 || file_size >= offset)
+}
+
+// decodeNonJpeg decodes PNG, GIF and BMP images with the standard decoders and normalizes the result.
+// The size is checked against the pixel limit of the options before decoding.
+func decodeNonJpeg(data []byte, format ImageFormat, colorspace jpeg.OutColorSpace, opts *DecodeOptions) (image.Image, error) {
+	var decode func(io.Reader) (image.Image, error)
+	var decodeConfig func(io.Reader) (image.Config, error)
+
+	switch format {
+	case ImageFormatPNG:
+		decode, decodeConfig = png.Decode, png.DecodeConfig
+	case ImageFormatGIF:
+		decode, decodeConfig = gif.Decode, gif.DecodeConfig
+	case ImageFormatBMP:
+		decode, decodeConfig = bmp.Decode, bmp.DecodeConfig
+	default:
+		return nil, NewError(0, "unsupported image format")
+	}
+
+	config, err := decodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	if max_pixels := opts.maxPixels(); max_pixels > 0 && int64(config.Width)*int64(config.Height) > max_pixels {
+		return nil, NewError(0, "image is too large: {width: %v, height: %v}, max pixels: %v", config.Width, config.Height, max_pixels)
+	}
+
+	im, err := decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return normalizeImage(im, colorspace, opts.background()), nil
+}
+
+// isGray reports whether the image has gray color model
+func isGray(im image.Image) bool {
+	model := im.ColorModel()
+	return model == color.GrayModel || model == color.Gray16Model
+}
+
+// isOpaque reports whether all pixels of the image are opaque, as far as it is cheap to find out
+func isOpaque(im image.Image) bool {
+	if o, ok := im.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// normalizeImage converts the image to *image.Gray, *rgb.Image or *image.RGBA according to colorspace,
+// composing images with alpha channel over background unless the output is RGBA
+func normalizeImage(im image.Image, colorspace jpeg.OutColorSpace, background color.Color) image.Image {
+	if colorspace == jpeg.OutColorSpaceSame {
+		switch {
+		case isGray(im):
+			colorspace = jpeg.OutColorSpaceGray
+		case isOpaque(im):
+			colorspace = jpeg.OutColorSpaceRGB
+		default:
+			colorspace = jpeg.OutColorSpaceRGBA
+		}
+	}
+
+	rect := image.Rectangle{Max: im.Bounds().Size()}
+
+	if colorspace == jpeg.OutColorSpaceGray && isGray(im) {
+		out := image.NewGray(rect)
+		draw.Draw(out, rect, im, im.Bounds().Min, draw.Src)
+		return out
+	}
+
+	// image.RGBA keeps colors premultiplied by alpha, so resizing it never bleeds color of transparent pixels
+	rgba := image.NewRGBA(rect)
+	if colorspace == jpeg.OutColorSpaceRGBA || isOpaque(im) {
+		draw.Draw(rgba, rect, im, im.Bounds().Min, draw.Src)
+	} else {
+		draw.Draw(rgba, rect, image.NewUniform(background), image.Point{}, draw.Src)
+		draw.Draw(rgba, rect, im, im.Bounds().Min, draw.Over)
+	}
+
+	switch colorspace {
+	case jpeg.OutColorSpaceRGBA:
+		return rgba
+	case jpeg.OutColorSpaceGray:
+		out := image.NewGray(rect)
+		for i, j := 0, 0; j < len(out.Pix); i, j = i+4, j+1 {
+			p := rgba.Pix[i : i+3 : i+3]
+			// same weights as color.GrayModel
+			out.Pix[j] = uint8((19595*uint32(p[0]) + 38470*uint32(p[1]) + 7471*uint32(p[2]) + 1<<15) >> 16)
+		}
+		return out
+	}
+
+	out := &rgb.Image{Pix: make([]uint8, 3*rect.Dx()*rect.Dy()), Stride: 3 * rect.Dx(), Rect: rect}
+	for i, j := 0, 0; j < len(out.Pix); i, j = i+4, j+3 {
+		copy(out.Pix[j:j+3], rgba.Pix[i:i+3])
+	}
+	return out
+}
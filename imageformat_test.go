@@ -0,0 +1,178 @@
+package ippresize
+
+import (
+	"bytes"
+	"github.com/anight/go-libjpeg/jpeg"
+	"github.com/anight/go-libjpeg/rgb"
+	"golang.org/x/image/bmp"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"os"
+	"testing"
+)
+
+// testNRGBA returns 4x2 image, left half opaque red, right half fully transparent green
+func testNRGBA() *image.NRGBA {
+	im := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			if x < 2 {
+				im.SetNRGBA(x, y, color.NRGBA{255, 0, 0, 255})
+			} else {
+				im.SetNRGBA(x, y, color.NRGBA{0, 255, 0, 0})
+			}
+		}
+	}
+	return im
+}
+
+func TestSniffFormat(t *testing.T) {
+	jpeg_data, err := os.ReadFile("./test.jpg")
+	if err != nil {
+		t.Fatalf("os.ReadFile() failed: %v", err)
+	}
+
+	var png_data, gif_data, bmp_data bytes.Buffer
+	png.Encode(&png_data, testNRGBA())
+	gif.Encode(&gif_data, testNRGBA(), nil)
+	bmp.Encode(&bmp_data, testNRGBA())
+
+	tests := []struct {
+		data   []byte
+		format ImageFormat
+	}{
+		{jpeg_data, ImageFormatJPEG},
+		{png_data.Bytes(), ImageFormatPNG},
+		{gif_data.Bytes(), ImageFormatGIF},
+		{bmp_data.Bytes(), ImageFormatBMP},
+		{[]byte("BM text starting with the bmp signature"), ImageFormatUnknown},
+		{append([]byte("BM"), bmp_data.Bytes()[2:14]...), ImageFormatUnknown},
+		{[]byte("garbage"), ImageFormatUnknown},
+		{nil, ImageFormatUnknown},
+	}
+	for _, item := range tests {
+		if format := SniffFormat(item.data); format != item.format {
+			t.Errorf("expected %v, got %v", item.format, format)
+		}
+	}
+}
+
+func TestDecodeAny(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testNRGBA()); err != nil {
+		t.Fatalf("png.Encode() failed: %v", err)
+	}
+	data := buf.Bytes()
+
+	im, format, err := DecodeAny(bytes.NewReader(data), jpeg.OutColorSpaceRGB, image.Point{})
+	if err != nil {
+		t.Fatalf("DecodeAny() failed: %v", err)
+	}
+	if format != ImageFormatPNG {
+		t.Errorf("unexpected format: %v", format)
+	}
+	i := im.(*rgb.Image)
+	if !bytes.Equal(i.Pix[:12], []uint8{255, 0, 0, 255, 0, 0, 255, 255, 255, 255, 255, 255}) {
+		t.Errorf("transparent pixels should be composed over white: %v", i.Pix[:12])
+	}
+
+	im, _, err = DecodeAnyWithOptions(bytes.NewReader(data), jpeg.OutColorSpaceGray, image.Point{}, &DecodeOptions{Background: color.Black})
+	if err != nil {
+		t.Fatalf("DecodeAnyWithOptions() failed: %v", err)
+	}
+	if g := im.(*image.Gray); !bytes.Equal(g.Pix[:4], []uint8{76, 76, 0, 0}) {
+		t.Errorf("unexpected gray pixels: %v", g.Pix[:4])
+	}
+
+	for _, cs := range []jpeg.OutColorSpace{jpeg.OutColorSpaceRGBA, jpeg.OutColorSpaceSame} {
+		im, _, err = DecodeAny(bytes.NewReader(data), cs, image.Point{})
+		if err != nil {
+			t.Fatalf("DecodeAny() failed: %v", err)
+		}
+		// premultiplied alpha
+		if i := im.(*image.RGBA); !bytes.Equal(i.Pix[4:12], []uint8{255, 0, 0, 255, 0, 0, 0, 0}) {
+			t.Errorf("unexpected rgba pixels: %v", i.Pix[4:12])
+		}
+	}
+
+	// 4x2 pixels
+	_, _, err = DecodeAnyWithOptions(bytes.NewReader(data), jpeg.OutColorSpaceRGB, image.Point{}, &DecodeOptions{MaxPixels: 7})
+	if err == nil {
+		t.Errorf("pixel limit should fail")
+	}
+	for _, max_pixels := range []int64{8, -1} {
+		if _, _, err = DecodeAnyWithOptions(bytes.NewReader(data), jpeg.OutColorSpaceRGB, image.Point{}, &DecodeOptions{MaxPixels: max_pixels}); err != nil {
+			t.Errorf("MaxPixels %v: DecodeAnyWithOptions() failed: %v", max_pixels, err)
+		}
+	}
+
+	_, _, err = DecodeAny(bytes.NewReader([]byte("garbage")), jpeg.OutColorSpaceRGB, image.Point{})
+	if err == nil {
+		t.Errorf("unknown format should fail")
+	}
+}
+
+func TestThumbnailFormats(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i)
+	}
+
+	var png_data, gif_data, bmp_data bytes.Buffer
+	png.Encode(&png_data, src)
+	gif.Encode(&gif_data, src, nil)
+	bmp.Encode(&bmp_data, src)
+
+	for _, item := range []struct {
+		data   []byte
+		format ImageFormat
+	}{
+		{png_data.Bytes(), ImageFormatPNG},
+		{gif_data.Bytes(), ImageFormatGIF},
+		{bmp_data.Bytes(), ImageFormatBMP},
+	} {
+		r, err := Thumbnail(bytes.NewReader(item.data), WithSize(image.Point{16, 16}), WithFit(FitCover))
+		if err != nil {
+			t.Fatalf("%v: Thumbnail() failed: %v", item.format, err)
+		}
+		if r.Source != item.format || r.Size != (image.Point{16, 16}) {
+			t.Errorf("%v: unexpected result: source=%v, size=%v", item.format, r.Source, r.Size)
+		}
+		if r.Transform.OrigSize != (image.Point{64, 32}) {
+			t.Errorf("%v: unexpected OrigSize: %v", item.format, r.Transform.OrigSize)
+		}
+	}
+
+	im, err := JpegToImage(bytes.NewReader(png_data.Bytes()), image.Point{16, 16}, InterpolationLinear)
+	if err != nil {
+		t.Fatalf("JpegToImage() failed: %v", err)
+	}
+	if im.Bounds() != image.Rect(0, 0, 16, 8) {
+		t.Errorf("unexpected bounds: %v", im.Bounds())
+	}
+}
+
+func TestSniffSize(t *testing.T) {
+	jpeg_data, err := os.ReadFile("./test.jpg")
+	if err != nil {
+		t.Fatalf("os.ReadFile() failed: %v", err)
+	}
+
+	var png_data bytes.Buffer
+	png.Encode(&png_data, testNRGBA())
+
+	if size, format, err := SniffSize(jpeg_data); err != nil || size != (image.Point{566, 850}) || format != ImageFormatJPEG {
+		t.Errorf("unexpected jpeg size: %v %v %v", size, format, err)
+	}
+	if size, format, err := SniffSize(png_data.Bytes()); err != nil || size != testNRGBA().Bounds().Size() || format != ImageFormatPNG {
+		t.Errorf("unexpected png size: %v %v %v", size, format, err)
+	}
+	if _, _, err := SniffSize([]byte("garbage")); err == nil {
+		t.Errorf("garbage should fail")
+	}
+	if _, _, err := SniffSize(jpeg_data[:4]); err == nil {
+		t.Errorf("truncated jpeg should fail")
+	}
+}
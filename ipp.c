@@ -1,5 +1,6 @@
 
 #include <stdio.h>
+#include <stdlib.h>
 #include <string.h>
 
 #include <ipp.h>
@@ -61,6 +62,16 @@ const char *image_strerror(int code)
 			return "Output image is unallocated";
 		case IMAGE_ERR_INVALID_INTERPOLATION:
 			return "Invalid interpolation";
+		case IMAGE_ERR_INVALID_BORDER:
+			return "Invalid border";
+		case IMAGE_ERR_INVALID_ORIENTATION:
+			return "Invalid orientation";
+		case IMAGE_ERR_WEBP_DECODE_FAILED:
+			return "WebP decoding failed";
+		case IMAGE_ERR_WEBP_ENCODE_FAILED:
+			return "WebP encoding failed";
+		case IMAGE_ERR_JPEG_DECODE_FAILED:
+			return "JPEG decoding failed";
 		default:
 			return ippGetStatusString(code);
 	}
@@ -77,22 +88,18 @@ const char *image_strerror(int code)
 })
 
 
-int image_ipp_resize(const struct image_s *in, const unsigned char *in_data, struct image_s *out, unsigned char *out_data, image_interpolation_t inter, char *err, size_t err_size)
+struct image_resize_spec_s {
+	IppiResizeSpec_32f *pSpec;
+	IppiInterpolationType interpolation;
+	int antialiasing;
+	IppiSize srcSize;
+	IppiSize dstSize;
+};
+
+int image_ipp_resize_spec_create(unsigned in_w, unsigned in_h, unsigned out_w, unsigned out_h, image_interpolation_t inter, struct image_resize_spec_s **spec, char *err, size_t err_size)
 {
 	IppStatus ippSts;
 
-	if (in->channels != 1 && in->channels != 3 && in->channels != 4) {
-		return error_code(IMAGE_ERR_INVALID_NUMBER_CHANNELS, "in->channels=%u", in->channels);
-	}
-
-	if (in->channels != out->channels) {
-		return error_code(IMAGE_ERR_INVALID_NUMBER_CHANNELS, "in->channels=%u, out->channels=%u", in->channels, out->channels);
-	}
-
-	if (out_data == NULL) {
-		return error_code(IMAGE_ERR_OUT_IMAGE_UNALLOCATED, "out_data == NULL");
-	}
-
 	/* special parameters for Lanczos */
 	const Ipp32u numLobes = 3;
 
@@ -109,8 +116,8 @@ int image_ipp_resize(const struct image_s *in, const unsigned char *in_data, str
 		return error_code(IMAGE_ERR_INVALID_INTERPOLATION, "inter=%d", inter);
 	}
 
-	IppiSize srcSize = { in->w, in->h };
-	IppiSize dstSize = { out->w, out->h };
+	IppiSize srcSize = { in_w, in_h };
+	IppiSize dstSize = { out_w, out_h };
 
 	int iSpecSize;
 	int iInitSize;
@@ -175,6 +182,8 @@ int image_ipp_resize(const struct image_s *in, const unsigned char *in_data, str
 			init_function_name = "ippiResizeSuperInit_8u";
 			break;
 		default:
+			ippsFree(pInitBuf);
+			ippsFree(pSpec);
 			return error_code(IMAGE_ERR_INVALID_INTERPOLATION, "interpolation=%d", interpolation);
 	}
 
@@ -182,14 +191,58 @@ int image_ipp_resize(const struct image_s *in, const unsigned char *in_data, str
 
 	if (ippSts != ippStsNoErr) {
 		ippsFree(pSpec);
-		return error_code_ipp("%s() failed, srcSize={width: %d, height: %d}, dstSize={width: %d, height: %d}, channels=%u",
-			init_function_name, srcSize.width, srcSize.height, dstSize.width, dstSize.height, in->channels);
+		return error_code_ipp("%s() failed, srcSize={width: %d, height: %d}, dstSize={width: %d, height: %d}",
+			init_function_name, srcSize.width, srcSize.height, dstSize.width, dstSize.height);
+	}
+
+	struct image_resize_spec_s *s = malloc(sizeof(*s));
+	if (s == NULL) {
+		ippsFree(pSpec);
+		return error_code(IMAGE_ERR_MEMORY_ALLOCATION_FAILED, "spec == NULL");
 	}
 
+	s->pSpec = pSpec;
+	s->interpolation = interpolation;
+	s->antialiasing = antialiasing;
+	s->srcSize = srcSize;
+	s->dstSize = dstSize;
+
+	*spec = s;
+
+	return ippStsNoErr;
+}
+
+void image_ipp_resize_spec_free(struct image_resize_spec_s *spec)
+{
+	if (spec != NULL) {
+		ippsFree(spec->pSpec);
+		free(spec);
+	}
+}
+
+/* resizes the dstSize rows of the destination image starting at dstOffset, in_data points to the source pixel given by ippiResizeGetSrcOffset() */
+static int image_ipp_resize_tile(const struct image_resize_spec_s *spec, const struct image_s *in, const unsigned char *in_data, struct image_s *out, unsigned char *out_data,
+	IppiPoint dstOffset, IppiSize dstSize, IppiBorderType border, char *err, size_t err_size)
+{
+	IppStatus ippSts;
+
+	if (in->channels != 1 && in->channels != 3 && in->channels != 4) {
+		return error_code(IMAGE_ERR_INVALID_NUMBER_CHANNELS, "in->channels=%u", in->channels);
+	}
+
+	if (in->channels != out->channels) {
+		return error_code(IMAGE_ERR_INVALID_NUMBER_CHANNELS, "in->channels=%u, out->channels=%u", in->channels, out->channels);
+	}
+
+	if (out_data == NULL) {
+		return error_code(IMAGE_ERR_OUT_IMAGE_UNALLOCATED, "out_data == NULL");
+	}
+
+	const IppiResizeSpec_32f *pSpec = spec->pSpec;
+
 	int bufSize = 0;
 	ippSts = ippiResizeGetBufferSize_8u(pSpec, dstSize, out->channels, &bufSize);
 	if (ippSts != ippStsNoErr) {
-		ippsFree(pSpec);
 		return error_code_ipp("ippiResizeGetBufferSize_8u() failed, dstSize={width: %d, height: %d}, channels=%u",
 			dstSize.width, dstSize.height, out->channels);
 	}
@@ -197,20 +250,17 @@ int image_ipp_resize(const struct image_s *in, const unsigned char *in_data, str
 	Ipp8u* pBuffer;
 	pBuffer = ippsMalloc_8u(bufSize);
 	if (pBuffer == NULL) {
-		ippsFree(pSpec);
 		return error_code(IMAGE_ERR_MEMORY_ALLOCATION_FAILED, "pBuffer == NULL");
 	}
 
-	IppiPoint dstOffset = {0, 0};
-
 	const char *resize_function_name = NULL;
 
-	if (antialiasing) {
+	if (spec->antialiasing) {
 		ippSts = channels_select_C134R(in->channels, ippiResizeAntialiasing_8u)
-			(in_data, in->rowstep, out_data, out->rowstep, dstOffset, dstSize, ippBorderRepl, 0, pSpec, pBuffer);
+			(in_data, in->rowstep, out_data, out->rowstep, dstOffset, dstSize, border, 0, pSpec, pBuffer);
 		resize_function_name = "ippiResizeAntialiasing_8u";
 	} else {
-		switch (interpolation) {
+		switch (spec->interpolation) {
 			case ippNearest:
 				ippSts = channels_select_C134R(in->channels, ippiResizeNearest_8u)
 					(in_data, in->rowstep, out_data, out->rowstep, dstOffset, dstSize, pSpec, pBuffer);
@@ -218,17 +268,17 @@ int image_ipp_resize(const struct image_s *in, const unsigned char *in_data, str
 				break;
 			case ippLinear:
 				ippSts = channels_select_C134R(in->channels, ippiResizeLinear_8u)
-					(in_data, in->rowstep, out_data, out->rowstep, dstOffset, dstSize, ippBorderRepl, 0, pSpec, pBuffer);
+					(in_data, in->rowstep, out_data, out->rowstep, dstOffset, dstSize, border, 0, pSpec, pBuffer);
 				resize_function_name = "ippiResizeLinear_8u";
 				break;
 			case ippCubic:
 				ippSts = channels_select_C134R(in->channels, ippiResizeCubic_8u)
-					(in_data, in->rowstep, out_data, out->rowstep, dstOffset, dstSize, ippBorderRepl, 0, pSpec, pBuffer);
+					(in_data, in->rowstep, out_data, out->rowstep, dstOffset, dstSize, border, 0, pSpec, pBuffer);
 				resize_function_name = "ippiResizeCubic_8u";
 				break;
 			case ippLanczos:
 				ippSts = channels_select_C134R(in->channels, ippiResizeLanczos_8u)
-					(in_data, in->rowstep, out_data, out->rowstep, dstOffset, dstSize, ippBorderRepl, 0, pSpec, pBuffer);
+					(in_data, in->rowstep, out_data, out->rowstep, dstOffset, dstSize, border, 0, pSpec, pBuffer);
 				resize_function_name = "ippiResizeLanczos_8u";
 				break;
 			case ippSuper:
@@ -237,12 +287,12 @@ int image_ipp_resize(const struct image_s *in, const unsigned char *in_data, str
 				resize_function_name = "ippiResizeSuper_8u";
 				break;
 			default:
-				return IMAGE_ERR_INVALID_INTERPOLATION;
+				ippsFree(pBuffer);
+				return error_code(IMAGE_ERR_INVALID_INTERPOLATION, "interpolation=%d", spec->interpolation);
 		}
 	}
 
-	ippsFree(pSpec);
-	ippiFree(pBuffer);
+	ippsFree(pBuffer);
 
 	if (ippSts != ippStsNoErr) {
 		return error_code_ipp("%s() failed", resize_function_name);
@@ -251,7 +301,298 @@ int image_ipp_resize(const struct image_s *in, const unsigned char *in_data, str
 	return ippStsNoErr;
 }
 
+int image_ipp_resize_with_spec(const struct image_resize_spec_s *spec, const struct image_s *in, const unsigned char *in_data, struct image_s *out, unsigned char *out_data, char *err, size_t err_size)
+{
+	IppStatus ippSts;
+
+	if (in->w != (unsigned) spec->srcSize.width || in->h != (unsigned) spec->srcSize.height ||
+		out->w != (unsigned) spec->dstSize.width || out->h != (unsigned) spec->dstSize.height) {
+		return error_code(ippStsSizeErr, "in={width: %u, height: %u}, out={width: %u, height: %u} don't match the spec", in->w, in->h, out->w, out->h);
+	}
+
+	IppiPoint dstOffset = {0, 0};
+
+	return image_ipp_resize_tile(spec, in, in_data, out, out_data, dstOffset, spec->dstSize, ippBorderRepl, err, err_size);
+}
+
+/* returns the source rows needed to resize out_h destination rows starting at out_y
+   and the source row in_offset_y the data passed to image_ipp_resize_rows() has to start from */
+int image_ipp_resize_src_rows(const struct image_resize_spec_s *spec, unsigned out_y, unsigned out_h, unsigned *in_y, unsigned *in_h, unsigned *in_offset_y, char *err, size_t err_size)
+{
+	IppStatus ippSts;
+
+	if (out_h == 0 || out_y + out_h > (unsigned) spec->dstSize.height) {
+		return error_code(ippStsSizeErr, "out_y=%u, out_h=%u, dstSize.height=%d", out_y, out_h, spec->dstSize.height);
+	}
+
+	IppiPoint dstOffset = {0, out_y};
+	IppiSize dstSize = {spec->dstSize.width, out_h};
+	IppiPoint srcOffset;
+	IppiSize srcSize;
+
+	ippSts = ippiResizeGetSrcRoi(spec->pSpec, dstOffset, dstSize, &srcOffset, &srcSize);
+	if (ippSts != ippStsNoErr) {
+		return error_code_ipp("ippiResizeGetSrcRoi() failed, dstOffset={x: %d, y: %d}, dstSize={width: %d, height: %d}",
+			dstOffset.x, dstOffset.y, dstSize.width, dstSize.height);
+	}
+
+	*in_y = srcOffset.y;
+	*in_h = srcSize.height;
+
+	ippSts = ippiResizeGetSrcOffset(spec->pSpec, dstOffset, &srcOffset);
+	if (ippSts != ippStsNoErr) {
+		return error_code_ipp("ippiResizeGetSrcOffset() failed, dstOffset={x: %d, y: %d}", dstOffset.x, dstOffset.y);
+	}
+
+	*in_offset_y = srcOffset.y;
+
+	return ippStsNoErr;
+}
+
+/* resizes out->h destination rows starting at out_y, in holds the source rows returned by image_ipp_resize_src_rows()
+   and in_data points to the row in_offset_y, the rows outside of the strip are taken from memory */
+int image_ipp_resize_rows(const struct image_resize_spec_s *spec, const struct image_s *in, const unsigned char *in_data, struct image_s *out, unsigned char *out_data, unsigned out_y, char *err, size_t err_size)
+{
+	IppStatus ippSts;
+
+	if (in->w != (unsigned) spec->srcSize.width || out->w != (unsigned) spec->dstSize.width ||
+		out->h == 0 || out_y + out->h > (unsigned) spec->dstSize.height) {
+		return error_code(ippStsSizeErr, "in={width: %u}, out={width: %u, height: %u}, out_y=%u don't match the spec", in->w, out->w, out->h, out_y);
+	}
+
+	IppiPoint dstOffset = {0, out_y};
+	IppiSize dstSize = {out->w, out->h};
+
+	int border = ippBorderRepl;
+	if (out_y > 0) {
+		border |= ippBorderInMemTop;
+	}
+	if (out_y + out->h < (unsigned) spec->dstSize.height) {
+		border |= ippBorderInMemBottom;
+	}
+
+	return image_ipp_resize_tile(spec, in, in_data, out, out_data, dstOffset, dstSize, (IppiBorderType) border, err, err_size);
+}
+
+int image_ipp_resize(const struct image_s *in, const unsigned char *in_data, struct image_s *out, unsigned char *out_data, image_interpolation_t inter, char *err, size_t err_size)
+{
+	struct image_resize_spec_s *spec = NULL;
+
+	int ret = image_ipp_resize_spec_create(in->w, in->h, out->w, out->h, inter, &spec, err, err_size);
+	if (ret != ippStsNoErr) {
+		return ret;
+	}
+
+	ret = image_ipp_resize_with_spec(spec, in, in_data, out, out_data, err, err_size);
+
+	image_ipp_resize_spec_free(spec);
+
+	return ret;
+}
+
+/* coeffs map the pixel centers of in to the pixel centers of out, only nearest neighbour, linear and cubic interpolations are supported */
+int image_ipp_warp_affine(const struct image_s *in, const unsigned char *in_data, struct image_s *out, unsigned char *out_data, const double coeffs[2][3], image_interpolation_t inter, char *err, size_t err_size)
+{
+	IppStatus ippSts;
+
+	/* special parameters for Cubic, the same as for resize */
+	const Ipp64f valueB = 0.;
+	const Ipp64f valueC = 0.5;
+
+	if (in->channels != 1 && in->channels != 3 && in->channels != 4) {
+		return error_code(IMAGE_ERR_INVALID_NUMBER_CHANNELS, "in->channels=%u", in->channels);
+	}
+
+	if (in->channels != out->channels) {
+		return error_code(IMAGE_ERR_INVALID_NUMBER_CHANNELS, "in->channels=%u, out->channels=%u", in->channels, out->channels);
+	}
+
+	if (out_data == NULL) {
+		return error_code(IMAGE_ERR_OUT_IMAGE_UNALLOCATED, "out_data == NULL");
+	}
+
+	int antialiasing;
+	IppiInterpolationType interpolation;
+
+	if (0 > image_ipp_inter(inter, &interpolation, &antialiasing) || antialiasing ||
+		(interpolation != ippNearest && interpolation != ippLinear && interpolation != ippCubic)) {
+		return error_code(IMAGE_ERR_INVALID_INTERPOLATION, "inter=%d", inter);
+	}
+
+	IppiSize srcSize = { in->w, in->h };
+	IppiSize dstSize = { out->w, out->h };
+
+	int iSpecSize;
+	int iInitSize;
+
+	ippSts = ippiWarpAffineGetSize(srcSize, dstSize, ipp8u, coeffs, interpolation, ippWarpForward, ippBorderRepl, &iSpecSize, &iInitSize);
+	if (ippSts != ippStsNoErr) {
+		return error_code_ipp("ippiWarpAffineGetSize() failed, srcSize={width: %d, height: %d}, dstSize={width: %d, height: %d}, inter=%d",
+			srcSize.width, srcSize.height, dstSize.width, dstSize.height, inter);
+	}
+
+	IppiWarpSpec *pSpec = (IppiWarpSpec *) ippsMalloc_8u(iSpecSize);
+	Ipp8u *pInitBuf = ippsMalloc_8u(iInitSize > 0 ? iInitSize : 1);
+
+	if (pSpec == NULL || pInitBuf == NULL) {
+		ippsFree(pSpec);
+		ippsFree(pInitBuf);
+		return error_code(IMAGE_ERR_MEMORY_ALLOCATION_FAILED, "ippsMalloc_8u() failed");
+	}
+
+	const char *function_name = NULL;
+
+	switch (interpolation) {
+		case ippNearest:
+			ippSts = ippiWarpAffineNearestInit(srcSize, dstSize, ipp8u, coeffs, ippWarpForward, in->channels, ippBorderRepl, NULL, 0, pSpec);
+			function_name = "ippiWarpAffineNearestInit";
+			break;
+		case ippLinear:
+			ippSts = ippiWarpAffineLinearInit(srcSize, dstSize, ipp8u, coeffs, ippWarpForward, in->channels, ippBorderRepl, NULL, 0, pSpec);
+			function_name = "ippiWarpAffineLinearInit";
+			break;
+		default:
+			ippSts = ippiWarpAffineCubicInit(srcSize, dstSize, ipp8u, coeffs, ippWarpForward, in->channels, valueB, valueC, ippBorderRepl, NULL, 0, pSpec, pInitBuf);
+			function_name = "ippiWarpAffineCubicInit";
+			break;
+	}
+
+	ippsFree(pInitBuf);
+
+	if (ippSts != ippStsNoErr) {
+		ippsFree(pSpec);
+		return error_code_ipp("%s() failed, srcSize={width: %d, height: %d}, dstSize={width: %d, height: %d}",
+			function_name, srcSize.width, srcSize.height, dstSize.width, dstSize.height);
+	}
+
+	int iBufSize;
+
+	ippSts = ippiWarpGetBufferSize(pSpec, dstSize, &iBufSize);
+	if (ippSts != ippStsNoErr) {
+		ippsFree(pSpec);
+		return error_code_ipp("ippiWarpGetBufferSize() failed");
+	}
+
+	Ipp8u *pBuffer = ippsMalloc_8u(iBufSize > 0 ? iBufSize : 1);
+	if (pBuffer == NULL) {
+		ippsFree(pSpec);
+		return error_code(IMAGE_ERR_MEMORY_ALLOCATION_FAILED, "pBuffer == NULL");
+	}
+
+	IppiPoint dstOffset = { 0, 0 };
+
+	switch (interpolation) {
+		case ippNearest:
+			ippSts = channels_select_C134R(in->channels, ippiWarpAffineNearest_8u)(in_data, in->rowstep, out_data, out->rowstep, dstOffset, dstSize, pSpec, pBuffer);
+			function_name = "ippiWarpAffineNearest_8u";
+			break;
+		case ippLinear:
+			ippSts = channels_select_C134R(in->channels, ippiWarpAffineLinear_8u)(in_data, in->rowstep, out_data, out->rowstep, dstOffset, dstSize, pSpec, pBuffer);
+			function_name = "ippiWarpAffineLinear_8u";
+			break;
+		default:
+			ippSts = channels_select_C134R(in->channels, ippiWarpAffineCubic_8u)(in_data, in->rowstep, out_data, out->rowstep, dstOffset, dstSize, pSpec, pBuffer);
+			function_name = "ippiWarpAffineCubic_8u";
+			break;
+	}
+
+	ippsFree(pBuffer);
+	ippsFree(pSpec);
+
+	if (ippSts != ippStsNoErr) {
+		return error_code_ipp("%s() failed, channels=%u", function_name, in->channels);
+	}
+
+	return ippStsNoErr;
+}
+
 int image_ipp_replicate_border_inplace(struct image_s *dst_im, unsigned char *dst_im_data, unsigned src_off_x, unsigned src_off_y, unsigned src_w, unsigned src_h, char *err, size_t err_size)
+{
+	return image_ipp_copy_border_inplace(dst_im, dst_im_data, src_off_x, src_off_y, src_w, src_h, IMAGE_BORDER_REPLICATE, NULL, err, err_size);
+}
+
+/* maps coordinate i of the border to the coordinate of the source of size n */
+static long image_border_index(long i, long n, image_border_t border)
+{
+	if (border == IMAGE_BORDER_WRAP) {
+		i %= n;
+		return i < 0 ? i + n : i;
+	}
+
+	/* IMAGE_BORDER_REFLECT: cba|abcd|dcb */
+	long period = 2 * n;
+	i %= period;
+	if (i < 0) {
+		i += period;
+	}
+	return i < n ? i : period - 1 - i;
+}
+
+/* ipp has no 8u functions for reflect and wrap borders */
+static void image_copy_border_generic_inplace(struct image_s *im, unsigned char *data, unsigned x0, unsigned y0, unsigned w, unsigned h, image_border_t border)
+{
+	const unsigned ch = im->channels;
+
+	for (unsigned y = y0; y < y0 + h; y++) {
+		unsigned char *row = data + y * im->rowstep;
+		for (unsigned x = 0; x < im->w; x++) {
+			if (x == x0) {
+				x = x0 + w - 1;
+				continue;
+			}
+			long sx = x0 + image_border_index((long) x - x0, w, border);
+			memcpy(row + x * ch, row + sx * ch, ch);
+		}
+	}
+
+	/* rows of the top and bottom borders are copies of complete rows */
+	for (unsigned y = 0; y < im->h; y++) {
+		if (y == y0) {
+			y = y0 + h - 1;
+			continue;
+		}
+		long sy = y0 + image_border_index((long) y - y0, h, border);
+		memcpy(data + y * im->rowstep, data + sy * im->rowstep, im->w * ch);
+	}
+}
+
+static IppStatus image_ipp_copy_const_border_inplace(unsigned channels, Ipp8u *start, int step, IppiSize srcSize, IppiSize dstSize, int top, int left, const unsigned char *value)
+{
+	const Ipp8u zero[4] = { 0, 0, 0, 0 };
+
+	if (value == NULL) {
+		value = zero;
+	}
+
+	switch (channels) {
+		case 1:
+			return ippiCopyConstBorder_8u_C1IR(start, step, srcSize, dstSize, top, left, value[0]);
+		case 3:
+			return ippiCopyConstBorder_8u_C3IR(start, step, srcSize, dstSize, top, left, value);
+		default:
+			return ippiCopyConstBorder_8u_C4IR(start, step, srcSize, dstSize, top, left, value);
+	}
+}
+
+static IppStatus image_ipp_copy_const_border(unsigned channels, const Ipp8u *src, int src_step, IppiSize srcSize, Ipp8u *dst, int dst_step, IppiSize dstSize, int top, int left, const unsigned char *value)
+{
+	const Ipp8u zero[4] = { 0, 0, 0, 0 };
+
+	if (value == NULL) {
+		value = zero;
+	}
+
+	switch (channels) {
+		case 1:
+			return ippiCopyConstBorder_8u_C1R(src, src_step, srcSize, dst, dst_step, dstSize, top, left, value[0]);
+		case 3:
+			return ippiCopyConstBorder_8u_C3R(src, src_step, srcSize, dst, dst_step, dstSize, top, left, value);
+		default:
+			return ippiCopyConstBorder_8u_C4R(src, src_step, srcSize, dst, dst_step, dstSize, top, left, value);
+	}
+}
+
+int image_ipp_copy_border_inplace(struct image_s *dst_im, unsigned char *dst_im_data, unsigned src_off_x, unsigned src_off_y, unsigned src_w, unsigned src_h, image_border_t border, const unsigned char *value, char *err, size_t err_size)
 {
 	IppStatus ippSts;
 
@@ -264,13 +605,296 @@ int image_ipp_replicate_border_inplace(struct image_s *dst_im, unsigned char *ds
 	IppiSize srcSize = { src_w, src_h };
 	IppiSize dstSize = { dst_im->w, dst_im->h };
 
-	ippSts = channels_select_C134IR(dst_im->channels, ippiCopyReplicateBorder_8u)
-		(start, dst_im->rowstep, srcSize, dstSize, src_off_y, src_off_x);
+	const char *function_name = NULL;
+
+	switch (border) {
+		case IMAGE_BORDER_REPLICATE:
+			ippSts = channels_select_C134IR(dst_im->channels, ippiCopyReplicateBorder_8u)
+				(start, dst_im->rowstep, srcSize, dstSize, src_off_y, src_off_x);
+			function_name = "ippiCopyReplicateBorder_8u";
+			break;
+		case IMAGE_BORDER_REFLECT_101:
+			ippSts = channels_select_C134IR(dst_im->channels, ippiCopyMirrorBorder_8u)
+				(start, dst_im->rowstep, srcSize, dstSize, src_off_y, src_off_x);
+			function_name = "ippiCopyMirrorBorder_8u";
+			break;
+		case IMAGE_BORDER_CONSTANT:
+			ippSts = image_ipp_copy_const_border_inplace(dst_im->channels, start, dst_im->rowstep, srcSize, dstSize, src_off_y, src_off_x, value);
+			function_name = "ippiCopyConstBorder_8u";
+			break;
+		case IMAGE_BORDER_REFLECT:
+		case IMAGE_BORDER_WRAP:
+			image_copy_border_generic_inplace(dst_im, dst_im_data, src_off_x, src_off_y, src_w, src_h, border);
+			return ippStsNoErr;
+		default:
+			return error_code(IMAGE_ERR_INVALID_BORDER, "border=%d", border);
+	}
+
+	if (ippSts != ippStsNoErr) {
+		return error_code_ipp("%s() failed", function_name);
+	}
+
+	return ippStsNoErr;
+}
+
+int image_ipp_copy_border(const struct image_s *src_im, const unsigned char *src_im_data, struct image_s *dst_im, unsigned char *dst_im_data, unsigned dst_off_x, unsigned dst_off_y, image_border_t border, const unsigned char *value, char *err, size_t err_size)
+{
+	IppStatus ippSts;
+
+	if (src_im->channels != 1 && src_im->channels != 3 && src_im->channels != 4) {
+		return error_code(IMAGE_ERR_INVALID_NUMBER_CHANNELS, "src_im->channels=%u", src_im->channels);
+	}
+
+	if (src_im->channels != dst_im->channels) {
+		return error_code(IMAGE_ERR_INVALID_NUMBER_CHANNELS, "src_im->channels=%u, dst_im->channels=%u", src_im->channels, dst_im->channels);
+	}
+
+	IppiSize srcSize = { src_im->w, src_im->h };
+	IppiSize dstSize = { dst_im->w, dst_im->h };
+
+	const char *function_name = NULL;
+
+	switch (border) {
+		case IMAGE_BORDER_REPLICATE:
+			ippSts = channels_select_C134R(src_im->channels, ippiCopyReplicateBorder_8u)
+				(src_im_data, src_im->rowstep, srcSize, dst_im_data, dst_im->rowstep, dstSize, dst_off_y, dst_off_x);
+			function_name = "ippiCopyReplicateBorder_8u";
+			break;
+		case IMAGE_BORDER_REFLECT_101:
+			ippSts = channels_select_C134R(src_im->channels, ippiCopyMirrorBorder_8u)
+				(src_im_data, src_im->rowstep, srcSize, dst_im_data, dst_im->rowstep, dstSize, dst_off_y, dst_off_x);
+			function_name = "ippiCopyMirrorBorder_8u";
+			break;
+		case IMAGE_BORDER_CONSTANT:
+			ippSts = image_ipp_copy_const_border(src_im->channels, src_im_data, src_im->rowstep, srcSize, dst_im_data, dst_im->rowstep, dstSize, dst_off_y, dst_off_x, value);
+			function_name = "ippiCopyConstBorder_8u";
+			break;
+		case IMAGE_BORDER_REFLECT:
+		case IMAGE_BORDER_WRAP:
+			ippSts = channels_select_C134R(src_im->channels, ippiCopy_8u)
+				(src_im_data, src_im->rowstep, dst_im_data + dst_im->channels * dst_off_x + dst_im->rowstep * dst_off_y, dst_im->rowstep, srcSize);
+			function_name = "ippiCopy_8u";
+			if (ippSts == ippStsNoErr) {
+				image_copy_border_generic_inplace(dst_im, dst_im_data, dst_off_x, dst_off_y, src_im->w, src_im->h, border);
+			}
+			break;
+		default:
+			return error_code(IMAGE_ERR_INVALID_BORDER, "border=%d", border);
+	}
+
+	if (ippSts != ippStsNoErr) {
+		return error_code_ipp("%s() failed", function_name);
+	}
+
+	return ippStsNoErr;
+}
+
+int image_ipp_orient(const struct image_s *in, const unsigned char *in_data, struct image_s *out, unsigned char *out_data, image_orientation_t orientation, char *err, size_t err_size)
+{
+	IppStatus ippSts;
+
+	if (in->channels != 1 && in->channels != 3 && in->channels != 4) {
+		return error_code(IMAGE_ERR_INVALID_NUMBER_CHANNELS, "in->channels=%u", in->channels);
+	}
+
+	if (in->channels != out->channels) {
+		return error_code(IMAGE_ERR_INVALID_NUMBER_CHANNELS, "in->channels=%u, out->channels=%u", in->channels, out->channels);
+	}
+
+	if (orientation < IMAGE_ORIENTATION_NORMAL || orientation > IMAGE_ORIENTATION_ROTATE_270) {
+		return error_code(IMAGE_ERR_INVALID_ORIENTATION, "orientation=%d", orientation);
+	}
+
+	const int transpose = orientation >= IMAGE_ORIENTATION_TRANSPOSE;
+
+	if ((transpose && (out->w != in->h || out->h != in->w)) || (!transpose && (out->w != in->w || out->h != in->h))) {
+		return error_code(ippStsSizeErr, "in={width: %u, height: %u}, out={width: %u, height: %u}, orientation=%d",
+			in->w, in->h, out->w, out->h, orientation);
+	}
+
+	IppiSize srcSize = { in->w, in->h };
+	IppiSize dstSize = { out->w, out->h };
+
+	const char *function_name = NULL;
+
+	/* transforms which swap axes are done with transpose followed by in-place mirror */
+	switch (orientation) {
+		case IMAGE_ORIENTATION_NORMAL:
+			ippSts = channels_select_C134R(in->channels, ippiCopy_8u)
+				(in_data, in->rowstep, out_data, out->rowstep, srcSize);
+			function_name = "ippiCopy_8u";
+			break;
+		case IMAGE_ORIENTATION_FLIP_HORIZONTAL:
+			ippSts = channels_select_C134R(in->channels, ippiMirror_8u)
+				(in_data, in->rowstep, out_data, out->rowstep, srcSize, ippAxsVertical);
+			function_name = "ippiMirror_8u";
+			break;
+		case IMAGE_ORIENTATION_ROTATE_180:
+			ippSts = channels_select_C134R(in->channels, ippiMirror_8u)
+				(in_data, in->rowstep, out_data, out->rowstep, srcSize, ippAxsBoth);
+			function_name = "ippiMirror_8u";
+			break;
+		case IMAGE_ORIENTATION_FLIP_VERTICAL:
+			ippSts = channels_select_C134R(in->channels, ippiMirror_8u)
+				(in_data, in->rowstep, out_data, out->rowstep, srcSize, ippAxsHorizontal);
+			function_name = "ippiMirror_8u";
+			break;
+		default:
+			ippSts = channels_select_C134R(in->channels, ippiTranspose_8u)
+				(in_data, in->rowstep, out_data, out->rowstep, srcSize);
+			function_name = "ippiTranspose_8u";
+			break;
+	}
+
+	if (ippSts != ippStsNoErr) {
+		return error_code_ipp("%s() failed", function_name);
+	}
+
+	if (transpose && orientation != IMAGE_ORIENTATION_TRANSPOSE) {
+		IppiAxis flip = orientation == IMAGE_ORIENTATION_ROTATE_90 ? ippAxsVertical :
+			(orientation == IMAGE_ORIENTATION_TRANSVERSE ? ippAxsBoth : ippAxsHorizontal);
+
+		ippSts = channels_select_C134IR(in->channels, ippiMirror_8u)(out_data, out->rowstep, dstSize, flip);
+
+		if (ippSts != ippStsNoErr) {
+			return error_code_ipp("ippiMirror_8u() failed");
+		}
+	}
+
+	return ippStsNoErr;
+}
+
+int image_ipp_color_twist(struct image_s *in, unsigned short *in_data, const float twist[3][4], const unsigned char *out_lut, struct image_s *out, unsigned char *out_data, char *err, size_t err_size)
+{
+	IppStatus ippSts;
+
+	if (in->channels != 3 || out->channels != 3) {
+		return error_code(IMAGE_ERR_INVALID_NUMBER_CHANNELS, "in->channels=%u, out->channels=%u", in->channels, out->channels);
+	}
+
+	if (out->w != in->w || out->h != in->h) {
+		return error_code(ippStsSizeErr, "in={width: %u, height: %u}, out={width: %u, height: %u}",
+			in->w, in->h, out->w, out->h);
+	}
+
+	IppiSize roiSize = { in->w, in->h };
+
+	/* input image is overwritten with the result of the transform */
+	ippSts = ippiColorTwist32f_16u_C3IR(in_data, in->rowstep, roiSize, twist);
 
 	if (ippSts != ippStsNoErr) {
-		return error_code_ipp("ippiCopyReplicateBorder_8u() failed");
+		return error_code_ipp("ippiColorTwist32f_16u_C3IR() failed");
+	}
+
+	/* out_lut has 65536 entries mapping the result to 8 bits */
+	for (unsigned y = 0; y < in->h; y++) {
+		const unsigned short *src = (const unsigned short *) ((const unsigned char *) in_data + y * in->rowstep);
+		unsigned char *dst = out_data + y * out->rowstep;
+		for (unsigned x = 0; x < 3 * in->w; x++) {
+			dst[x] = out_lut[src[x]];
+		}
 	}
 
 	return ippStsNoErr;
 }
 
+static int image_ipp_check_pair(const struct image_s *a, const struct image_s *b, char *err, size_t err_size)
+{
+	IppStatus ippSts;
+
+	if (a->channels != 1 && a->channels != 3 && a->channels != 4) {
+		return error_code(IMAGE_ERR_INVALID_NUMBER_CHANNELS, "a->channels=%u", a->channels);
+	}
+
+	if (a->channels != b->channels) {
+		return error_code(IMAGE_ERR_INVALID_NUMBER_CHANNELS, "a->channels=%u, b->channels=%u", a->channels, b->channels);
+	}
+
+	if (a->w != b->w || a->h != b->h || a->w == 0 || a->h == 0) {
+		return error_code(ippStsSizeErr, "a={width: %u, height: %u}, b={width: %u, height: %u}", a->w, a->h, b->w, b->h);
+	}
+
+	return ippStsNoErr;
+}
+
+/* value has a->channels entries, the sums of absolute differences with l2 == 0, the square roots of the sums of squared differences otherwise */
+int image_ipp_norm_diff(const struct image_s *a, const unsigned char *a_data, const struct image_s *b, const unsigned char *b_data, int l2, double *value, char *err, size_t err_size)
+{
+	IppStatus ippSts = image_ipp_check_pair(a, b, err, err_size);
+
+	if (ippSts != ippStsNoErr) {
+		return ippSts;
+	}
+
+	IppiSize roiSize = { a->w, a->h };
+
+	if (l2) {
+		ippSts = channels_select_C134R(a->channels, ippiNormDiff_L2_8u)(a_data, a->rowstep, b_data, b->rowstep, roiSize, value);
+		if (ippSts != ippStsNoErr) {
+			return error_code_ipp("ippiNormDiff_L2_8u() failed");
+		}
+	} else {
+		ippSts = channels_select_C134R(a->channels, ippiNormDiff_L1_8u)(a_data, a->rowstep, b_data, b->rowstep, roiSize, value);
+		if (ippSts != ippStsNoErr) {
+			return error_code_ipp("ippiNormDiff_L1_8u() failed");
+		}
+	}
+
+	return ippStsNoErr;
+}
+
+/* value has a->channels entries, the universal quality index of every channel computed over the whole image */
+int image_ipp_quality_index(const struct image_s *a, const unsigned char *a_data, const struct image_s *b, const unsigned char *b_data, float *value, char *err, size_t err_size)
+{
+	IppStatus ippSts = image_ipp_check_pair(a, b, err, err_size);
+
+	if (ippSts != ippStsNoErr) {
+		return ippSts;
+	}
+
+	IppiSize roiSize = { a->w, a->h };
+	int iBufSize = 0;
+
+	ippSts = ippiQualityIndexGetBufferSize(ipp8u, ippC1, roiSize, &iBufSize);
+
+	if (ippSts != ippStsNoErr) {
+		return error_code_ipp("ippiQualityIndexGetBufferSize() failed");
+	}
+
+	/* the channels are copied to planes as the multi-channel variants skip alpha */
+	const size_t plane_size = (size_t) a->w * a->h;
+	Ipp8u *pBuffer = ippsMalloc_8u(iBufSize > 0 ? iBufSize : 1);
+	Ipp8u *planes = ippsMalloc_8u(2 * plane_size);
+
+	if (pBuffer == NULL || planes == NULL) {
+		ippsFree(pBuffer);
+		ippsFree(planes);
+		return error_code(IMAGE_ERR_MEMORY_ALLOCATION_FAILED, "ippsMalloc_8u() failed");
+	}
+
+	for (unsigned c = 0; c < a->channels; c++) {
+		for (unsigned y = 0; y < a->h; y++) {
+			const unsigned char *a_row = a_data + y * a->rowstep;
+			const unsigned char *b_row = b_data + y * b->rowstep;
+			Ipp8u *a_plane = planes + y * a->w;
+			Ipp8u *b_plane = planes + plane_size + y * a->w;
+			for (unsigned x = 0; x < a->w; x++) {
+				a_plane[x] = a_row[x * a->channels + c];
+				b_plane[x] = b_row[x * a->channels + c];
+			}
+		}
+
+		ippSts = ippiQualityIndex_8u32f_C1R(planes, a->w, planes + plane_size, a->w, roiSize, &value[c], pBuffer);
+
+		if (ippSts != ippStsNoErr) {
+			ippsFree(pBuffer);
+			ippsFree(planes);
+			return error_code_ipp("ippiQualityIndex_8u32f_C1R() failed: channel=%u", c);
+		}
+	}
+
+	ippsFree(pBuffer);
+	ippsFree(planes);
+
+	return ippStsNoErr;
+}
@@ -0,0 +1,298 @@
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <setjmp.h>
+
+#include <jpeglib.h>
+#include <jerror.h>
+
+#include "image.h"
+
+#define error_code(code, fmt...) ({ \
+	char temp[err_size]; \
+	snprintf(temp, err_size, fmt); temp[err_size - 1] = '\0'; \
+	snprintf(err, err_size, "%s: %s (%d)", temp, image_strerror(code), code); \
+	(code); \
+})
+
+enum {
+	IMAGE_JPEG_READER_INIT = 0,
+	IMAGE_JPEG_READER_HEADER,
+	IMAGE_JPEG_READER_STARTING,
+	IMAGE_JPEG_READER_STARTED,
+};
+
+/* decompressor fed by image_jpeg_reader_feed(), it suspends when the fed data runs out */
+struct image_jpeg_reader_s {
+	struct jpeg_decompress_struct cinfo;
+	struct jpeg_error_mgr jerr;
+	struct jpeg_source_mgr src;
+	jmp_buf setjmp_buffer;
+	unsigned char *buf;
+	size_t buf_size;
+	size_t skip; /* bytes to skip from the data fed next */
+	int eof;
+	int state;
+};
+
+static const JOCTET image_jpeg_fake_eoi[2] = { 0xFF, JPEG_EOI };
+
+/* formats the message of the libjpeg error which jumped back to the function called from go */
+static int image_jpeg_error(struct image_jpeg_reader_s *reader, char *err, size_t err_size)
+{
+	char msg[JMSG_LENGTH_MAX];
+	(*reader->cinfo.err->format_message)((j_common_ptr) &reader->cinfo, msg);
+	return error_code(IMAGE_ERR_JPEG_DECODE_FAILED, "%s", msg);
+}
+
+static void image_jpeg_error_exit(j_common_ptr cinfo)
+{
+	struct image_jpeg_reader_s *reader = cinfo->client_data;
+	longjmp(reader->setjmp_buffer, 1);
+}
+
+static void image_jpeg_output_message(j_common_ptr cinfo)
+{
+	/* warnings are ignored */
+}
+
+static void image_jpeg_init_source(j_decompress_ptr cinfo)
+{
+}
+
+static boolean image_jpeg_fill_input_buffer(j_decompress_ptr cinfo)
+{
+	struct image_jpeg_reader_s *reader = cinfo->client_data;
+
+	if (!reader->eof) {
+		/* suspend until more data is fed */
+		return FALSE;
+	}
+
+	/* premature end of data, libjpeg handles this the same way */
+	WARNMS(cinfo, JWRN_JPEG_EOF);
+	cinfo->src->next_input_byte = image_jpeg_fake_eoi;
+	cinfo->src->bytes_in_buffer = sizeof(image_jpeg_fake_eoi);
+
+	return TRUE;
+}
+
+static void image_jpeg_skip_input_data(j_decompress_ptr cinfo, long num_bytes)
+{
+	struct image_jpeg_reader_s *reader = cinfo->client_data;
+	struct jpeg_source_mgr *src = cinfo->src;
+
+	if (num_bytes <= 0) {
+		return;
+	}
+
+	if ((size_t) num_bytes <= src->bytes_in_buffer) {
+		src->next_input_byte += num_bytes;
+		src->bytes_in_buffer -= num_bytes;
+		return;
+	}
+
+	reader->skip += num_bytes - src->bytes_in_buffer;
+	src->next_input_byte += src->bytes_in_buffer;
+	src->bytes_in_buffer = 0;
+}
+
+static void image_jpeg_term_source(j_decompress_ptr cinfo)
+{
+}
+
+int image_jpeg_reader_create(struct image_jpeg_reader_s **reader, char *err, size_t err_size)
+{
+	struct image_jpeg_reader_s *r = calloc(1, sizeof(*r));
+	if (r == NULL) {
+		return error_code(IMAGE_ERR_MEMORY_ALLOCATION_FAILED, "reader == NULL");
+	}
+
+	r->cinfo.err = jpeg_std_error(&r->jerr);
+	r->jerr.error_exit = image_jpeg_error_exit;
+	r->jerr.output_message = image_jpeg_output_message;
+	r->cinfo.client_data = r;
+
+	if (setjmp(r->setjmp_buffer)) {
+		int ret = image_jpeg_error(r, err, err_size);
+		jpeg_destroy_decompress(&r->cinfo);
+		free(r);
+		return ret;
+	}
+
+	jpeg_create_decompress(&r->cinfo);
+
+	r->src.init_source = image_jpeg_init_source;
+	r->src.fill_input_buffer = image_jpeg_fill_input_buffer;
+	r->src.skip_input_data = image_jpeg_skip_input_data;
+	r->src.resync_to_restart = jpeg_resync_to_restart;
+	r->src.term_source = image_jpeg_term_source;
+	r->src.next_input_byte = NULL;
+	r->src.bytes_in_buffer = 0;
+	r->cinfo.src = &r->src;
+
+	*reader = r;
+
+	return 0;
+}
+
+void image_jpeg_reader_free(struct image_jpeg_reader_s *reader)
+{
+	if (reader != NULL) {
+		jpeg_destroy_decompress(&reader->cinfo);
+		free(reader->buf);
+		free(reader);
+	}
+}
+
+/* appends the data to the unconsumed input, empty data means the end of input */
+int image_jpeg_reader_feed(struct image_jpeg_reader_s *reader, const unsigned char *data, size_t data_size, char *err, size_t err_size)
+{
+	if (data_size == 0) {
+		reader->eof = 1;
+		return 0;
+	}
+
+	if (reader->skip >= data_size) {
+		reader->skip -= data_size;
+		return 0;
+	}
+
+	data += reader->skip;
+	data_size -= reader->skip;
+	reader->skip = 0;
+
+	size_t remaining = reader->src.bytes_in_buffer;
+
+	if (remaining + data_size > reader->buf_size) {
+		size_t buf_size = 2 * reader->buf_size;
+		if (buf_size < remaining + data_size) {
+			buf_size = remaining + data_size;
+		}
+		unsigned char *buf = malloc(buf_size);
+		if (buf == NULL) {
+			return error_code(IMAGE_ERR_MEMORY_ALLOCATION_FAILED, "buf == NULL, size=%zu", buf_size);
+		}
+		if (remaining) {
+			memcpy(buf, reader->src.next_input_byte, remaining);
+		}
+		free(reader->buf);
+		reader->buf = buf;
+		reader->buf_size = buf_size;
+	} else if (remaining) {
+		memmove(reader->buf, reader->src.next_input_byte, remaining);
+	}
+
+	memcpy(reader->buf + remaining, data, data_size);
+
+	reader->src.next_input_byte = reader->buf;
+	reader->src.bytes_in_buffer = remaining + data_size;
+
+	return 0;
+}
+
+/* reads the header and returns the stored size of the image, *suspended is set if more data has to be fed */
+int image_jpeg_reader_read_header(struct image_jpeg_reader_s *reader, unsigned *w, unsigned *h, int *suspended, char *err, size_t err_size)
+{
+	*suspended = 0;
+
+	if (setjmp(reader->setjmp_buffer)) {
+		return image_jpeg_error(reader, err, err_size);
+	}
+
+	if (reader->state == IMAGE_JPEG_READER_INIT) {
+		int ret = jpeg_read_header(&reader->cinfo, TRUE);
+		if (ret == JPEG_SUSPENDED) {
+			*suspended = 1;
+			return 0;
+		}
+		if (ret != JPEG_HEADER_OK) {
+			return error_code(IMAGE_ERR_JPEG_DECODE_FAILED, "jpeg_read_header() failed, ret=%d", ret);
+		}
+		reader->state = IMAGE_JPEG_READER_HEADER;
+	}
+
+	*w = reader->cinfo.image_width;
+	*h = reader->cinfo.image_height;
+
+	return 0;
+}
+
+/* starts decompression scaled by scale_num/8, returns the size of the rows, *suspended is set if more data has to be fed */
+int image_jpeg_reader_start(struct image_jpeg_reader_s *reader, unsigned channels, unsigned scale_num, unsigned *w, unsigned *h, int *suspended, char *err, size_t err_size)
+{
+	*suspended = 0;
+
+	if (reader->state < IMAGE_JPEG_READER_HEADER) {
+		return error_code(IMAGE_ERR_JPEG_DECODE_FAILED, "header is not read");
+	}
+
+	if (setjmp(reader->setjmp_buffer)) {
+		return image_jpeg_error(reader, err, err_size);
+	}
+
+	if (reader->state == IMAGE_JPEG_READER_HEADER) {
+		if (reader->cinfo.jpeg_color_space == JCS_CMYK || reader->cinfo.jpeg_color_space == JCS_YCCK) {
+			return error_code(IMAGE_ERR_JPEG_DECODE_FAILED, "CMYK images are not supported");
+		}
+
+		switch (channels) {
+			case 1:
+				reader->cinfo.out_color_space = JCS_GRAYSCALE;
+				break;
+			case 3:
+				reader->cinfo.out_color_space = JCS_RGB;
+				break;
+#ifdef JCS_EXTENSIONS
+			case 4:
+				reader->cinfo.out_color_space = JCS_EXT_RGBA;
+				break;
+#endif
+			default:
+				return error_code(IMAGE_ERR_INVALID_NUMBER_CHANNELS, "channels=%u", channels);
+		}
+
+		reader->cinfo.scale_num = scale_num;
+		reader->cinfo.scale_denom = 8;
+		reader->state = IMAGE_JPEG_READER_STARTING;
+	}
+
+	if (reader->state == IMAGE_JPEG_READER_STARTING) {
+		if (!jpeg_start_decompress(&reader->cinfo)) {
+			*suspended = 1;
+			return 0;
+		}
+		reader->state = IMAGE_JPEG_READER_STARTED;
+	}
+
+	*w = reader->cinfo.output_width;
+	*h = reader->cinfo.output_height;
+
+	return 0;
+}
+
+/* reads the next row, *suspended is set if more data has to be fed */
+int image_jpeg_reader_read_row(struct image_jpeg_reader_s *reader, unsigned char *row, int *suspended, char *err, size_t err_size)
+{
+	*suspended = 0;
+
+	if (reader->state != IMAGE_JPEG_READER_STARTED) {
+		return error_code(IMAGE_ERR_JPEG_DECODE_FAILED, "decompression is not started");
+	}
+
+	if (reader->cinfo.output_scanline >= reader->cinfo.output_height) {
+		return error_code(IMAGE_ERR_JPEG_DECODE_FAILED, "all %u rows are read", reader->cinfo.output_height);
+	}
+
+	if (setjmp(reader->setjmp_buffer)) {
+		return image_jpeg_error(reader, err, err_size);
+	}
+
+	JSAMPROW rows[1] = { row };
+
+	if (jpeg_read_scanlines(&reader->cinfo, rows, 1) == 0) {
+		*suspended = 1;
+	}
+
+	return 0;
+}
@@ -0,0 +1,194 @@
+package ippresize
+
+/*
+#include "image.h"
+#cgo pkg-config: libjpeg
+*/
+import "C"
+
+import (
+	"image"
+	"io"
+	"runtime"
+	"unsafe"
+)
+
+// compressed data read from the underlying reader at once
+const jpegReadChunk = 32 * 1024
+
+// JpegRowReader is a RowReader decoding JPEG scanlines with libjpeg. The compressed data is read
+// from the underlying reader as the rows are decoded, so neither the compressed nor the decoded image
+// is held in memory, except progressive images which libjpeg has to buffer entirely.
+// EXIF orientation is not applied, CMYK images are not supported.
+type JpegRowReader struct {
+	reader   io.Reader
+	jpeg     *C.struct_image_jpeg_reader_s
+	chunk    []byte
+	eof      bool
+	size     image.Point
+	channels int
+	row      int
+}
+
+// jpegScaleNum returns the smallest libjpeg scale n/8 giving the size not smaller than target, empty target means no scaling
+func jpegScaleNum(size image.Point, target image.Point) int {
+	if target.X <= 0 && target.Y <= 0 {
+		return 8
+	}
+	for n := 1; n < 8; n++ {
+		if (size.X*n+7)/8 >= target.X && (size.Y*n+7)/8 >= target.Y {
+			return n
+		}
+	}
+	return 8
+}
+
+// NewJpegRowReader reads the JPEG header and prepares decoding of the rows in the format,
+// libjpeg scales the image to the smallest size covering bbox like Decode() does. Close() must be called when done.
+func NewJpegRowReader(reader io.Reader, format PixelFormat, bbox image.Point) (r *JpegRowReader, err error) {
+	if format != PixelFormatRGB && format != PixelFormatRGBA && format != PixelFormatGray {
+		return nil, NewError(0, "invalid pixel format: %v", format)
+	}
+
+	r = &JpegRowReader{
+		reader:   reader,
+		chunk:    make([]byte, jpegReadChunk),
+		channels: format.Channels(),
+	}
+
+	const err_size = 1024
+	var cerr [err_size]C.char
+
+	ret := C.image_jpeg_reader_create(&r.jpeg, &cerr[0], err_size)
+	if ret != 0 {
+		return nil, NewError(int(ret), "C.image_jpeg_reader_create() failed: %v", C.GoString(&cerr[0]))
+	}
+
+	defer func() {
+		if err != nil {
+			r.Close()
+			r = nil
+		}
+	}()
+
+	var w, h C.uint
+
+	err = r.call("C.image_jpeg_reader_read_header()", func(suspended *C.int, cerr *C.char, err_size C.size_t) C.int {
+		return C.image_jpeg_reader_read_header(r.jpeg, &w, &h, suspended, cerr, err_size)
+	})
+	if err != nil {
+		return
+	}
+
+	scale_num := jpegScaleNum(image.Point{int(w), int(h)}, bbox)
+
+	err = r.call("C.image_jpeg_reader_start()", func(suspended *C.int, cerr *C.char, err_size C.size_t) C.int {
+		return C.image_jpeg_reader_start(r.jpeg, C.uint(r.channels), C.uint(scale_num), &w, &h, suspended, cerr, err_size)
+	})
+	if err != nil {
+		return
+	}
+
+	r.size = image.Point{int(w), int(h)}
+
+	return
+}
+
+// call calls the decoding function feeding more data to libjpeg until it doesn't suspend
+func (r *JpegRowReader) call(name string, f func(suspended *C.int, cerr *C.char, err_size C.size_t) C.int) error {
+	if r.jpeg == nil {
+		return NewError(0, "reader is closed")
+	}
+
+	const err_size = 1024
+	var cerr [err_size]C.char
+
+	for {
+		var suspended C.int
+		ret := f(&suspended, &cerr[0], err_size)
+		if ret != 0 {
+			return NewError(int(ret), "%v failed: %v", name, C.GoString(&cerr[0]))
+		}
+		if suspended == 0 {
+			return nil
+		}
+		if err := r.feed(); err != nil {
+			return err
+		}
+	}
+}
+
+// feed passes the next chunk of the compressed data to libjpeg
+func (r *JpegRowReader) feed() error {
+	if r.eof {
+		return NewError(0, "unexpected end of JPEG data")
+	}
+
+	n, err := r.reader.Read(r.chunk)
+	if err == io.EOF && n == 0 {
+		r.eof = true
+	} else if err != nil && err != io.EOF {
+		return err
+	} else if n == 0 {
+		return nil
+	}
+
+	const err_size = 1024
+	var cerr [err_size]C.char
+
+	var data *C.uchar
+	if n > 0 {
+		data = (*C.uchar)(unsafe.Pointer(&r.chunk[0]))
+	}
+
+	ret := C.image_jpeg_reader_feed(r.jpeg, data, C.size_t(n), &cerr[0], err_size)
+
+	runtime.KeepAlive(r.chunk)
+
+	if ret != 0 {
+		return NewError(int(ret), "C.image_jpeg_reader_feed() failed: %v", C.GoString(&cerr[0]))
+	}
+
+	return nil
+}
+
+// Size returns the size of the decoded image
+func (r *JpegRowReader) Size() image.Point {
+	return r.size
+}
+
+func (r *JpegRowReader) Channels() int {
+	return r.channels
+}
+
+// ReadRow decodes the next row, io.EOF is returned after the last one
+func (r *JpegRowReader) ReadRow(row []uint8) error {
+	if r.row >= r.size.Y {
+		return io.EOF
+	}
+
+	if len(row) < r.channels*r.size.X {
+		return NewError(0, "row is too short: %v < %v", len(row), r.channels*r.size.X)
+	}
+
+	row_data := (*C.uchar)(unsafe.Pointer(&row[0]))
+
+	err := r.call("C.image_jpeg_reader_read_row()", func(suspended *C.int, cerr *C.char, err_size C.size_t) C.int {
+		return C.image_jpeg_reader_read_row(r.jpeg, row_data, suspended, cerr, err_size)
+	})
+
+	runtime.KeepAlive(row)
+
+	if err != nil {
+		return err
+	}
+
+	r.row++
+	return nil
+}
+
+// Close frees libjpeg decompressor, it doesn't close the underlying reader
+func (r *JpegRowReader) Close() {
+	C.image_jpeg_reader_free(r.jpeg)
+	r.jpeg = nil
+}
@@ -0,0 +1,122 @@
+package ippresize
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"os"
+	"testing"
+	"testing/iotest"
+)
+
+func TestJpegRowReader(t *testing.T) {
+	data, err := os.ReadFile("./test.jpg")
+	if err != nil {
+		t.Fatalf("os.ReadFile() failed: %v", err)
+	}
+
+	for _, tc := range []struct {
+		format PixelFormat
+		bbox   image.Point
+		size   image.Point
+	}{
+		{PixelFormatRGB, image.Point{}, image.Point{566, 850}},
+		{PixelFormatGray, image.Point{}, image.Point{566, 850}},
+		{PixelFormatRGBA, image.Point{}, image.Point{566, 850}},
+		{PixelFormatGray, image.Point{100, 0}, image.Point{142, 213}},
+		{PixelFormatRGBA, image.Point{300, 300}, image.Point{354, 532}},
+	} {
+		// small reads make libjpeg suspend in the middle of everything
+		reader, err := NewJpegRowReader(iotest.HalfReader(bytes.NewReader(data)), tc.format, tc.bbox)
+		if err != nil {
+			t.Fatalf("NewJpegRowReader() failed: %v", err)
+		}
+
+		if reader.Size() != tc.size || reader.Channels() != tc.format.Channels() {
+			t.Fatalf("%v: unexpected size %v, channels %v", tc.format, reader.Size(), reader.Channels())
+		}
+
+		stride := reader.Channels() * reader.Size().X
+		pix := make([]uint8, stride*reader.Size().Y)
+		for y := 0; y < reader.Size().Y; y++ {
+			if err := reader.ReadRow(pix[y*stride : (y+1)*stride]); err != nil {
+				t.Fatalf("%v: ReadRow() failed at row %v: %v", tc.format, y, err)
+			}
+		}
+		if err := reader.ReadRow(make([]uint8, stride)); err != io.EOF {
+			t.Errorf("%v: expected io.EOF after the last row, got %v", tc.format, err)
+		}
+		reader.Close()
+
+		// DCT scaling is checked by the size only
+		if tc.bbox != (image.Point{}) {
+			continue
+		}
+
+		im, err := Decode(bytes.NewReader(data), tc.format.colorspace(), tc.bbox)
+		if err != nil {
+			t.Fatalf("Decode() failed: %v", err)
+		}
+		expect, _, _, err := imagePix(im)
+		if err != nil {
+			t.Fatalf("imagePix() failed: %v", err)
+		}
+		if im.Bounds().Size() != tc.size {
+			t.Fatalf("%v: Decode() returned size %v", tc.format, im.Bounds().Size())
+		}
+		if d := meanDiff(pix, expect); d > 1.5 {
+			t.Errorf("%v: mean difference from Decode() is %v", tc.format, d)
+		}
+	}
+
+	// rows of the jpeg resized while decoding
+	reader, err := NewJpegRowReader(bytes.NewReader(data), PixelFormatRGB, image.Point{})
+	if err != nil {
+		t.Fatalf("NewJpegRowReader() failed: %v", err)
+	}
+	defer reader.Close()
+	var out bytes.Buffer
+	if err := ResizeStream(reader, rowsFunc(func(row []uint8) error { _, err := out.Write(row); return err }), image.Point{100, 150}, InterpolationAntialiasingLanczos); err != nil {
+		t.Fatalf("ResizeStream() failed: %v", err)
+	}
+	if out.Len() != 3*100*150 {
+		t.Errorf("unexpected output length %v", out.Len())
+	}
+
+	if _, err := NewJpegRowReader(bytes.NewReader([]byte("garbage")), PixelFormatRGB, image.Point{}); err == nil {
+		t.Errorf("garbage should fail")
+	}
+
+	if _, err := NewJpegRowReader(bytes.NewReader(data[:100]), PixelFormatRGB, image.Point{}); err == nil {
+		t.Errorf("truncated header should fail")
+	}
+
+	if _, err := NewJpegRowReader(bytes.NewReader(data), PixelFormat(10), image.Point{}); err == nil {
+		t.Errorf("invalid format should fail")
+	}
+}
+
+func TestJpegScaleNum(t *testing.T) {
+	size := image.Point{566, 850}
+	for _, tc := range []struct {
+		target image.Point
+		n      int
+	}{
+		{image.Point{}, 8},
+		{image.Point{71, 0}, 1},
+		{image.Point{72, 0}, 2},
+		{image.Point{0, 213}, 2},
+		{image.Point{566, 850}, 8},
+		{image.Point{1000, 0}, 8},
+	} {
+		if n := jpegScaleNum(size, tc.target); n != tc.n {
+			t.Errorf("%v: expected %v, got %v", tc.target, tc.n, n)
+		}
+	}
+}
+
+type rowsFunc func(row []uint8) error
+
+func (f rowsFunc) WriteRow(row []uint8) error {
+	return f(row)
+}
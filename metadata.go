@@ -0,0 +1,152 @@
+package ippresize
+
+//go:generate stringer -type=MetadataPolicy -trimprefix Metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+)
+
+// MetadataPolicy defines which metadata of the source jpeg image is copied to the resized one
+type MetadataPolicy int
+
+const (
+	MetadataStrip    MetadataPolicy = iota // drop all metadata
+	MetadataKeepAll                        // keep EXIF, XMP, ICC profile, IPTC and comments
+	MetadataKeepICC                        // keep the ICC profile only
+	MetadataStripGPS                       // keep all but GPS location, XMP with GPS properties is dropped
+)
+
+var (
+	xmpHeader         = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	xmpExtendedHeader = []byte("http://ns.adobe.com/xmp/extension/\x00")
+	iccHeader         = []byte("ICC_PROFILE\x00")
+	iptcHeader        = []byte("Photoshop 3.0\x00")
+)
+
+// keepSegment reports whether the segment is copied according to the policy.
+// Segments describing the encoding (JFIF, Adobe) or referring to other data of the stream (MPF) are never copied.
+func (p MetadataPolicy) keepSegment(s jpegSegment) bool {
+	switch {
+	case s.marker == markerAPP2 && bytes.HasPrefix(s.data, iccHeader):
+		return p != MetadataStrip
+	case s.marker == markerAPP1 && bytes.HasPrefix(s.data, exifHeader):
+		return p == MetadataKeepAll || p == MetadataStripGPS
+	case s.marker == markerAPP1 && (bytes.HasPrefix(s.data, xmpHeader) || bytes.HasPrefix(s.data, xmpExtendedHeader)):
+		if p == MetadataStripGPS {
+			return !bytes.Contains(s.data, []byte("exif:GPS"))
+		}
+		return p == MetadataKeepAll
+	case s.marker == markerAPP13 && bytes.HasPrefix(s.data, iptcHeader), s.marker == markerCOM:
+		return p == MetadataKeepAll || p == MetadataStripGPS
+	}
+	return false
+}
+
+// copyMetadata inserts metadata segments of the src jpeg stream selected by the policy into the dst jpeg stream
+// right after SOI and JFIF markers. Exif dimensions are updated to size, exif orientation is reset
+// if the orientation has been applied to the image. The ICC profile is dropped if the colors have been converted to sRGB.
+func copyMetadata(dst []byte, src []byte, policy MetadataPolicy, size image.Point, oriented bool, converted bool) ([]byte, error) {
+	if policy == MetadataStrip {
+		return dst, nil
+	}
+
+	src_segments, err := jpegSegments(src)
+	if err != nil {
+		return nil, err
+	}
+
+	dst_segments, err := jpegSegments(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	insert := 2
+	if len(dst_segments) > 0 && dst_segments[0].marker == markerAPP0 {
+		insert = dst_segments[0].offset + 4 + len(dst_segments[0].data)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(dst[:insert])
+
+	for _, s := range src_segments {
+		if !policy.keepSegment(s) || (converted && s.marker == markerAPP2 && bytes.HasPrefix(s.data, iccHeader)) {
+			continue
+		}
+		data := s.data
+		if s.marker == markerAPP1 && bytes.HasPrefix(data, exifHeader) {
+			data = updateExif(data, policy, size, oriented)
+		}
+		buf.Write([]byte{0xff, s.marker})
+		binary.Write(&buf, binary.BigEndian, uint16(len(data)+2))
+		buf.Write(data)
+	}
+
+	buf.Write(dst[insert:])
+	return buf.Bytes(), nil
+}
+
+// updateExif returns a copy of the exif segment payload with dimensions, orientation and GPS updated.
+// Malformed tiff data is returned as is.
+func updateExif(payload []byte, policy MetadataPolicy, size image.Point, oriented bool) []byte {
+	payload = append([]byte(nil), payload...)
+
+	t, err := newTIFFReader(payload[len(exifHeader):])
+	if err != nil {
+		return payload
+	}
+
+	ifd0 := t.firstIFD()
+	entries, _, err := t.readIFD(ifd0)
+	if err != nil {
+		return payload
+	}
+
+	// the embedded thumbnail in IFD1 would be displayed with a wrong orientation
+	if oriented {
+		t.setNextIFD(ifd0, 0)
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		switch e.tag {
+		case tagImageWidth:
+			t.setUint(e, uint32(size.X))
+		case tagImageLength:
+			t.setUint(e, uint32(size.Y))
+		case tagOrientation:
+			if oriented {
+				t.setUint(e, uint32(OrientationNormal))
+			}
+		case tagExifIFD:
+			if offset, ok := t.uint(e); ok {
+				updateExifIFD(t, offset, size)
+			}
+		case tagGPSIFD:
+			if policy == MetadataStripGPS {
+				if offset, ok := t.uint(e); ok {
+					t.clearIFD(offset)
+				}
+				t.removeEntry(ifd0, i)
+			}
+		}
+	}
+
+	return payload
+}
+
+func updateExifIFD(t *tiffReader, offset uint32, size image.Point) {
+	entries, _, err := t.readIFD(offset)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		switch e.tag {
+		case tagPixelXDimension:
+			t.setUint(e, uint32(size.X))
+		case tagPixelYDimension:
+			t.setUint(e, uint32(size.Y))
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package ippresize
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"os"
+	"testing"
+)
+
+// withMetadata inserts exif with orientation, dimensions and GPS location, ICC profile and XMP segments
+// into the jpeg stream
+func withMetadata(data []byte, order binary.ByteOrder, o Orientation, xmp string) []byte {
+	entry := func(w *bytes.Buffer, tag, typ uint16, count, value uint32) {
+		binary.Write(w, order, []uint16{tag, typ})
+		binary.Write(w, order, count)
+		if typ == 3 && count == 1 {
+			binary.Write(w, order, []uint16{uint16(value), 0})
+		} else {
+			binary.Write(w, order, value)
+		}
+	}
+
+	// IFD0 at 8 with 3 entries, Exif IFD at 50 with 2 entries, GPS IFD at 80 with 2 entries,
+	// GPS latitude (3 rationals) at 110
+	var tiff bytes.Buffer
+	if order == binary.LittleEndian {
+		tiff.WriteString("II")
+	} else {
+		tiff.WriteString("MM")
+	}
+	binary.Write(&tiff, order, uint16(42))
+	binary.Write(&tiff, order, uint32(8))
+
+	binary.Write(&tiff, order, uint16(3))
+	entry(&tiff, tagOrientation, 3, 1, uint32(o))
+	entry(&tiff, tagExifIFD, 4, 1, 50)
+	entry(&tiff, tagGPSIFD, 4, 1, 80)
+	binary.Write(&tiff, order, uint32(0))
+
+	binary.Write(&tiff, order, uint16(2))
+	entry(&tiff, tagPixelXDimension, 4, 1, 566)
+	entry(&tiff, tagPixelYDimension, 3, 1, 850)
+	binary.Write(&tiff, order, uint32(0))
+
+	binary.Write(&tiff, order, uint16(2))
+	entry(&tiff, 0x0001, 2, 2, 'N') // GPSLatitudeRef
+	entry(&tiff, 0x0002, 5, 3, 110) // GPSLatitude
+	binary.Write(&tiff, order, uint32(0))
+
+	binary.Write(&tiff, order, []uint32{55, 1, 45, 1, 1234, 100})
+
+	var out bytes.Buffer
+	segment := func(marker byte, payload ...[]byte) {
+		p := bytes.Join(payload, nil)
+		out.Write([]byte{0xff, marker})
+		binary.Write(&out, binary.BigEndian, uint16(len(p)+2))
+		out.Write(p)
+	}
+
+	out.Write(data[:2])
+	segment(markerAPP1, exifHeader, tiff.Bytes())
+	segment(markerAPP2, iccHeader, []byte{1, 1}, []byte("fake profile"))
+	segment(markerAPP1, xmpHeader, []byte(xmp))
+	segment(markerCOM, []byte("comment"))
+	out.Write(data[2:])
+	return out.Bytes()
+}
+
+// exifValues returns the orientation, pixel dimensions and presence of GPS IFD in the exif of the jpeg stream
+func exifValues(t *testing.T, data []byte) (o uint32, size image.Point, gps bool) {
+	segments, err := jpegSegments(data)
+	if err != nil {
+		t.Fatalf("jpegSegments() failed: %v", err)
+	}
+	r, err := newTIFFReader(exifTIFF(segments))
+	if err != nil {
+		t.Fatalf("newTIFFReader() failed: %v", err)
+	}
+	entries, _, err := r.readIFD(r.firstIFD())
+	if err != nil {
+		t.Fatalf("readIFD() failed: %v", err)
+	}
+	for _, e := range entries {
+		switch e.tag {
+		case tagOrientation:
+			o, _ = r.uint(e)
+		case tagGPSIFD:
+			gps = true
+		case tagExifIFD:
+			offset, _ := r.uint(e)
+			exif_entries, _, err := r.readIFD(offset)
+			if err != nil {
+				t.Fatalf("readIFD() failed: %v", err)
+			}
+			for _, e := range exif_entries {
+				v, _ := r.uint(e)
+				switch e.tag {
+				case tagPixelXDimension:
+					size.X = int(v)
+				case tagPixelYDimension:
+					size.Y = int(v)
+				}
+			}
+		}
+	}
+	return
+}
+
+func TestMetadataPolicy(t *testing.T) {
+	data, err := os.ReadFile("./test.jpg")
+	if err != nil {
+		t.Fatalf("os.ReadFile() failed: %v", err)
+	}
+
+	type found struct {
+		exif, icc, xmp, com bool
+	}
+
+	tests := []struct {
+		policy MetadataPolicy
+		xmp    string
+		expect found
+	}{
+		{MetadataStrip, "", found{}},
+		{MetadataKeepAll, "<x:xmpmeta exif:GPSLatitude=\"55,45N\"/>", found{true, true, true, true}},
+		{MetadataKeepICC, "", found{false, true, false, false}},
+		{MetadataStripGPS, "<x:xmpmeta/>", found{true, true, true, true}},
+		{MetadataStripGPS, "<x:xmpmeta exif:GPSLatitude=\"55,45N\"/>", found{true, true, false, true}},
+	}
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		for _, item := range tests {
+			src := withMetadata(data, order, OrientationRotate90, item.xmp)
+
+			var buf bytes.Buffer
+			_, err := ResizeJpeg(bytes.NewReader(src), &buf, image.Point{100, 0}, &JpegOptions{Metadata: item.policy})
+			if err != nil {
+				t.Fatalf("ResizeJpeg(%v) failed: %v", item.policy, err)
+			}
+
+			segments, err := jpegSegments(buf.Bytes())
+			if err != nil {
+				t.Fatalf("jpegSegments() failed: %v", err)
+			}
+			var got found
+			for _, s := range segments {
+				switch {
+				case s.marker == markerAPP1 && bytes.HasPrefix(s.data, exifHeader):
+					got.exif = true
+				case s.marker == markerAPP2 && bytes.HasPrefix(s.data, iccHeader):
+					got.icc = true
+				case s.marker == markerAPP1 && bytes.HasPrefix(s.data, xmpHeader):
+					got.xmp = true
+				case s.marker == markerCOM:
+					got.com = true
+				}
+			}
+			if got != item.expect {
+				t.Errorf("%v %v: expected %+v, got %+v", order, item.policy, item.expect, got)
+			}
+			if !got.exif {
+				continue
+			}
+
+			// the image is rotated from 566x850 to 850x566 and resized to 100x67
+			o, size, gps := exifValues(t, buf.Bytes())
+			if o != uint32(OrientationNormal) {
+				t.Errorf("%v %v: orientation is not reset: %v", order, item.policy, o)
+			}
+			if size != (image.Point{100, 67}) {
+				t.Errorf("%v %v: unexpected exif dimensions: %v", order, item.policy, size)
+			}
+			if gps != (item.policy == MetadataKeepAll) {
+				t.Errorf("%v %v: unexpected GPS IFD presence: %v", order, item.policy, gps)
+			}
+			latitude := make([]byte, 4)
+			order.PutUint32(latitude, 1234)
+			if item.policy == MetadataStripGPS && bytes.Contains(exifTIFF(segments), latitude) {
+				t.Errorf("%v %v: GPS values are not cleared", order, item.policy)
+			}
+		}
+	}
+}
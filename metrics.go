@@ -0,0 +1,76 @@
+package ippresize
+
+import (
+	"errors"
+	"image"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics receives the measurements of the processing stages, the methods are called concurrently.
+// Sizes are zero when not known because of an error.
+type Metrics interface {
+	// ObserveDecode is called after an image is decoded, size is the decoded size
+	ObserveDecode(format ImageFormat, duration time.Duration, size image.Point, err error)
+	// ObserveResize is called after an IPP resize of an image from in_size to out_size
+	ObserveResize(interpolation Interpolation, duration time.Duration, in_size image.Point, out_size image.Point, err error)
+	// ObserveEncode is called after an image of the size is encoded
+	ObserveEncode(format ImageFormat, duration time.Duration, size image.Point, err error)
+}
+
+type metricsHolder struct {
+	m Metrics
+}
+
+var currentMetrics atomic.Value // of metricsHolder
+
+// SetMetrics installs the metrics for all the processing, nil disables measuring, which is the default
+func SetMetrics(m Metrics) {
+	currentMetrics.Store(metricsHolder{m})
+}
+
+// ErrorStatus returns the IppStatus of the error, zero for the errors not coming from IPP
+func ErrorStatus(err error) IppStatus {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code()
+	}
+	return 0
+}
+
+// stage measures a processing stage, it does nothing without metrics
+type stage struct {
+	m     Metrics
+	start time.Time
+}
+
+func startStage() stage {
+	h, _ := currentMetrics.Load().(metricsHolder)
+	if h.m == nil {
+		return stage{}
+	}
+	return stage{m: h.m, start: time.Now()}
+}
+
+func (s stage) decoded(format ImageFormat, im image.Image, err error) {
+	if s.m == nil {
+		return
+	}
+	var size image.Point
+	if im != nil && err == nil {
+		size = im.Bounds().Size()
+	}
+	s.m.ObserveDecode(format, time.Since(s.start), size, err)
+}
+
+func (s stage) resized(interpolation Interpolation, in_size image.Point, out_size image.Point, err error) {
+	if s.m != nil {
+		s.m.ObserveResize(interpolation, time.Since(s.start), in_size, out_size, err)
+	}
+}
+
+func (s stage) encoded(format ImageFormat, size image.Point, err error) {
+	if s.m != nil {
+		s.m.ObserveEncode(format, time.Since(s.start), size, err)
+	}
+}
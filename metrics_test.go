@@ -0,0 +1,122 @@
+package ippresize
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+type observation struct {
+	stage    string
+	label    string
+	in_size  image.Point
+	out_size image.Point
+	err      error
+}
+
+type recordingMetrics struct {
+	mu           sync.Mutex
+	observations []observation
+}
+
+func (m *recordingMetrics) add(o observation, duration time.Duration) {
+	if duration < 0 {
+		panic("negative duration")
+	}
+	m.mu.Lock()
+	m.observations = append(m.observations, o)
+	m.mu.Unlock()
+}
+
+func (m *recordingMetrics) ObserveDecode(format ImageFormat, duration time.Duration, size image.Point, err error) {
+	m.add(observation{"decode", format.String(), image.Point{}, size, err}, duration)
+}
+
+func (m *recordingMetrics) ObserveResize(interpolation Interpolation, duration time.Duration, in_size image.Point, out_size image.Point, err error) {
+	m.add(observation{"resize", interpolation.String(), in_size, out_size, err}, duration)
+}
+
+func (m *recordingMetrics) ObserveEncode(format ImageFormat, duration time.Duration, size image.Point, err error) {
+	m.add(observation{"encode", format.String(), image.Point{}, size, err}, duration)
+}
+
+func (m *recordingMetrics) take() []observation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o := m.observations
+	m.observations = nil
+	return o
+}
+
+func TestMetrics(t *testing.T) {
+	data, err := os.ReadFile("./test.jpg")
+	if err != nil {
+		t.Fatalf("os.ReadFile() failed: %v", err)
+	}
+
+	m := &recordingMetrics{}
+	SetMetrics(m)
+	defer SetMetrics(nil)
+
+	r, err := Thumbnail(bytes.NewReader(data), WithSize(image.Point{100, 0}), WithInterpolation(InterpolationCubic), WithFormat(PixelFormatRGBA))
+	if err != nil {
+		t.Fatalf("Thumbnail() failed: %v", err)
+	}
+	for _, format := range []ImageFormat{ImageFormatPNG, ImageFormatWebP, ImageFormatJPEG} {
+		if err := r.Encode(io.Discard, format, 0); err != nil {
+			t.Fatalf("Encode() failed: %v", err)
+		}
+	}
+
+	o := m.take()
+	if len(o) != 5 {
+		t.Fatalf("expected 5 observations, got %+v", o)
+	}
+	if o[0].stage != "decode" || o[0].label != "JPEG" || o[0].err != nil || o[0].out_size.X < 100 {
+		t.Errorf("unexpected decode observation: %+v", o[0])
+	}
+	if o[1].stage != "resize" || o[1].label != "Cubic" || o[1].err != nil || o[1].in_size != o[0].out_size || o[1].out_size != r.Size {
+		t.Errorf("unexpected resize observation: %+v", o[1])
+	}
+	for i, format := range []string{"PNG", "WebP", "JPEG"} {
+		if e := o[2+i]; e.stage != "encode" || e.label != format || e.err != nil || e.out_size != r.Size {
+			t.Errorf("unexpected encode observation: %+v", e)
+		}
+	}
+
+	if _, err := ResizeJpeg(bytes.NewReader(data), io.Discard, image.Point{50, 50}, nil); err != nil {
+		t.Fatalf("ResizeJpeg() failed: %v", err)
+	}
+	o = m.take()
+	if len(o) < 3 || o[0].stage != "decode" || o[len(o)-1].stage != "encode" || o[len(o)-1].out_size != (image.Point{50, 50}) {
+		t.Errorf("unexpected ResizeJpeg() observations: %+v", o)
+	}
+
+	// errors carry IppStatus
+	in := make([]uint8, 3*3*3)
+	out := make([]uint8, 3*100*100)
+	err = Resize(in, 9, image.Point{3, 3}, out, 300, image.Point{100, 100}, 3, InterpolationLanczos)
+	o = m.take()
+	if err == nil || len(o) != 1 || o[0].err != err || ErrorStatus(err) == 0 {
+		t.Errorf("unexpected error observations: %v %+v", err, o)
+	}
+
+	if _, err := Thumbnail(bytes.NewReader([]byte("garbage"))); err == nil {
+		t.Errorf("garbage should fail")
+	}
+	o = m.take()
+	if len(o) != 1 || o[0].stage != "decode" || o[0].err == nil || o[0].out_size != (image.Point{}) {
+		t.Errorf("unexpected decode error observations: %+v", o)
+	}
+
+	// nothing is observed after the metrics are removed
+	SetMetrics(nil)
+	Thumbnail(bytes.NewReader(data), WithSize(image.Point{100, 0}))
+	if o := m.take(); len(o) != 0 {
+		t.Errorf("unexpected observations: %+v", o)
+	}
+}
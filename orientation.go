@@ -0,0 +1,229 @@
+package ippresize
+
+//go:generate stringer -type=Orientation -trimprefix Orientation
+
+/*
+#include "image.h"
+*/
+import "C"
+
+import (
+	"github.com/anight/go-libjpeg/rgb"
+	"image"
+	"runtime"
+	"unsafe"
+)
+
+// Orientation is the value of exif Orientation tag: the transform to apply to the stored image to display it
+type Orientation C.image_orientation_t
+
+const (
+	OrientationNormal         Orientation = C.IMAGE_ORIENTATION_NORMAL
+	OrientationFlipHorizontal Orientation = C.IMAGE_ORIENTATION_FLIP_HORIZONTAL // mirror left to right
+	OrientationRotate180      Orientation = C.IMAGE_ORIENTATION_ROTATE_180
+	OrientationFlipVertical   Orientation = C.IMAGE_ORIENTATION_FLIP_VERTICAL // mirror top to bottom
+	OrientationTranspose      Orientation = C.IMAGE_ORIENTATION_TRANSPOSE     // mirror along the top-left to bottom-right diagonal
+	OrientationRotate90       Orientation = C.IMAGE_ORIENTATION_ROTATE_90     // rotate 90 degrees clockwise
+	OrientationTransverse     Orientation = C.IMAGE_ORIENTATION_TRANSVERSE    // mirror along the top-right to bottom-left diagonal
+	OrientationRotate270      Orientation = C.IMAGE_ORIENTATION_ROTATE_270    // rotate 90 degrees counterclockwise
+)
+
+func (o Orientation) valid() bool {
+	return o >= OrientationNormal && o <= OrientationRotate270
+}
+
+// transposes reports whether the orientation swaps width and height of the image
+func (o Orientation) transposes() bool {
+	return o >= OrientationTranspose && o <= OrientationRotate270
+}
+
+// Size returns the size of the image of the given stored size after the orientation is applied
+func (o Orientation) Size(size image.Point) image.Point {
+	if o.transposes() {
+		return image.Point{size.Y, size.X}
+	}
+	return size
+}
+
+// Inverse returns the orientation undoing o
+func (o Orientation) Inverse() Orientation {
+	switch o {
+	case OrientationRotate90:
+		return OrientationRotate270
+	case OrientationRotate270:
+		return OrientationRotate90
+	}
+	return o
+}
+
+// Point maps a point of the stored image of the given size to the oriented image.
+// Coordinates are continuous, pixel (i, j) covers the square [i, i+1) x [j, j+1).
+func (o Orientation) Point(x, y float64, size image.Point) (float64, float64) {
+	w, h := float64(size.X), float64(size.Y)
+	switch o {
+	case OrientationFlipHorizontal:
+		return w - x, y
+	case OrientationRotate180:
+		return w - x, h - y
+	case OrientationFlipVertical:
+		return x, h - y
+	case OrientationTranspose:
+		return y, x
+	case OrientationRotate90:
+		return h - y, x
+	case OrientationTransverse:
+		return h - y, w - x
+	case OrientationRotate270:
+		return y, w - x
+	}
+	return x, y
+}
+
+// Rect maps a rectangle of the stored image of the given size to the oriented image
+func (o Orientation) Rect(r image.Rectangle, size image.Point) image.Rectangle {
+	x0, y0 := o.Point(float64(r.Min.X), float64(r.Min.Y), size)
+	x1, y1 := o.Point(float64(r.Max.X), float64(r.Max.Y), size)
+	return image.Rect(int(x0), int(y0), int(x1), int(y1))
+}
+
+// Orient applies the orientation to the image and returns the result with its size
+func Orient(in []uint8, in_stride int, in_size image.Point, channels int, o Orientation) ([]uint8, image.Point, error) {
+	out_size := o.Size(in_size)
+	out_stride := channels * out_size.X
+	out := make([]uint8, out_stride*out_size.Y)
+	err := orient(in, in_stride, in_size, out, out_stride, channels, o)
+	return out, out_size, err
+}
+
+// orient writes the input image with the orientation applied to the output buffer
+func orient(in []uint8, in_stride int, in_size image.Point, out []uint8, out_stride int, channels int, o Orientation) error {
+
+	if in_size.X <= 0 || in_size.Y <= 0 {
+		return NewError(0, "one of the input image dimensions is invalid: {width: %v, height: %v}", in_size.X, in_size.Y)
+	}
+
+	if !o.valid() {
+		return NewError(0, "invalid orientation: %v", o)
+	}
+
+	out_size := o.Size(in_size)
+
+	if len(in) < in_stride*(in_size.Y-1)+channels*in_size.X {
+		return NewError(0, "input image buffer size doesn't match image dimensions: {width: %v, height: %v, channels: %v}, len=%v",
+			in_size.X, in_size.Y, channels, len(in))
+	}
+
+	if len(out) < out_stride*(out_size.Y-1)+channels*out_size.X {
+		return NewError(0, "output image buffer size doesn't match image dimensions: {width: %v, height: %v, channels: %v}, len=%v",
+			out_size.X, out_size.Y, channels, len(out))
+	}
+
+	var img_in C.struct_image_s
+	img_in.w = C.uint(in_size.X)
+	img_in.h = C.uint(in_size.Y)
+	img_in.channels = C.uint(channels)
+	img_in.rowstep = C.size_t(in_stride)
+	img_in_data := (*C.uchar)(unsafe.Pointer(&in[0]))
+
+	var img_out C.struct_image_s
+	img_out.w = C.uint(out_size.X)
+	img_out.h = C.uint(out_size.Y)
+	img_out.channels = C.uint(channels)
+	img_out.rowstep = C.size_t(out_stride)
+	img_out_data := (*C.uchar)(unsafe.Pointer(&out[0]))
+
+	const err_size = 1024
+	var cerr [err_size]C.char
+
+	ret := C.image_ipp_orient(&img_in, img_in_data, &img_out, img_out_data, C.image_orientation_t(o), &cerr[0], err_size)
+
+	/* make 100% sure garbage collector wont kill these objects in the middle of execution of c function */
+	runtime.KeepAlive(img_in)
+	runtime.KeepAlive(img_in_data)
+	runtime.KeepAlive(img_out)
+	runtime.KeepAlive(img_out_data)
+
+	if ret != 0 {
+		return NewError(int(ret), "C.image_ipp_orient() failed: %v", C.GoString(&cerr[0]))
+	}
+
+	return nil
+}
+
+// OrientImage applies the orientation to *image.Gray, *image.RGBA, *rgb.Image or *image.YCbCr image.
+// Transposing orientations turn 4:2:2 chroma subsampling into 4:4:0 and vice versa, they are not supported for 4:1:1 and 4:1:0.
+func OrientImage(im image.Image, o Orientation) (image.Image, error) {
+	if o == OrientationNormal {
+		return im, nil
+	}
+
+	size := o.Size(im.Bounds().Size())
+	rect := image.Rectangle{Max: size}
+
+	switch i := im.(type) {
+	case *image.Gray:
+		out := image.NewGray(rect)
+		return out, orient(i.Pix, i.Stride, i.Bounds().Size(), out.Pix, out.Stride, 1, o)
+	case *image.RGBA:
+		out := image.NewRGBA(rect)
+		return out, orient(i.Pix, i.Stride, i.Bounds().Size(), out.Pix, out.Stride, 4, o)
+	case *rgb.Image:
+		out := &rgb.Image{Pix: make([]uint8, 3*size.X*size.Y), Stride: 3 * size.X, Rect: rect}
+		return out, orient(i.Pix, i.Stride, i.Bounds().Size(), out.Pix, out.Stride, 3, o)
+	case *image.YCbCr:
+		return orientYCbCr(i, o)
+	}
+
+	return nil, NewError(0, "unsupported color model")
+}
+
+// orientRatio returns the chroma subsampling of the image after the orientation is applied,
+// false if the result can't be represented by image.YCbCr
+func orientRatio(ratio image.YCbCrSubsampleRatio, o Orientation) (image.YCbCrSubsampleRatio, bool) {
+	if o.transposes() {
+		switch ratio {
+		case image.YCbCrSubsampleRatio422:
+			return image.YCbCrSubsampleRatio440, true
+		case image.YCbCrSubsampleRatio440:
+			return image.YCbCrSubsampleRatio422, true
+		case image.YCbCrSubsampleRatio411, image.YCbCrSubsampleRatio410:
+			return ratio, false
+		}
+	}
+	return ratio, true
+}
+
+func orientYCbCr(ycbcr *image.YCbCr, o Orientation) (*image.YCbCr, error) {
+	ratio, ok := orientRatio(ycbcr.SubsampleRatio, o)
+	if !ok {
+		return nil, NewError(0, "orientation %v is not supported for SubsampleRatio=%v", o, ratio)
+	}
+
+	if ycbcr.Rect.Min != (image.Point{}) {
+		return nil, NewError(0, "Unaligned source image dimensions: %v, SubsampleRatio=%v", ycbcr.Rect, ycbcr.SubsampleRatio)
+	}
+
+	size := ycbcr.Rect.Size()
+	out := image.NewYCbCr(image.Rectangle{Max: o.Size(size)}, ratio)
+
+	err := orient(ycbcr.Y, ycbcr.YStride, size, out.Y, out.YStride, 1, o)
+	if err != nil {
+		return nil, err
+	}
+
+	// chroma planes of the input image, rounded up the same way image.NewYCbCr() does
+	c_size := ycbcr.COffset(size.X-1, size.Y-1) - ycbcr.COffset(0, size.Y-1) + 1
+	c_size_y := (ycbcr.COffset(0, size.Y-1)-ycbcr.COffset(0, 0))/ycbcr.CStride + 1
+
+	err = orient(ycbcr.Cb, ycbcr.CStride, image.Point{c_size, c_size_y}, out.Cb, out.CStride, 1, o)
+	if err != nil {
+		return nil, err
+	}
+
+	err = orient(ycbcr.Cr, ycbcr.CStride, image.Point{c_size, c_size_y}, out.Cr, out.CStride, 1, o)
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
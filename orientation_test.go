@@ -0,0 +1,163 @@
+package ippresize
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"os"
+	"testing"
+)
+
+// withExifOrientation inserts exif segment with the orientation tag right after SOI marker of the jpeg stream
+func withExifOrientation(data []byte, order binary.ByteOrder, o Orientation) []byte {
+	var tiff bytes.Buffer
+	if order == binary.LittleEndian {
+		tiff.WriteString("II")
+	} else {
+		tiff.WriteString("MM")
+	}
+	binary.Write(&tiff, order, uint16(42))
+	binary.Write(&tiff, order, uint32(8))
+	binary.Write(&tiff, order, uint16(1))
+	binary.Write(&tiff, order, []uint16{tagOrientation, 3})
+	binary.Write(&tiff, order, uint32(1))
+	binary.Write(&tiff, order, []uint16{uint16(o), 0})
+	binary.Write(&tiff, order, uint32(0))
+
+	payload := append(append([]byte{}, exifHeader...), tiff.Bytes()...)
+
+	var out bytes.Buffer
+	out.Write(data[:2])
+	out.Write([]byte{0xff, markerAPP1})
+	binary.Write(&out, binary.BigEndian, uint16(len(payload)+2))
+	out.Write(payload)
+	out.Write(data[2:])
+	return out.Bytes()
+}
+
+func TestExifOrientation(t *testing.T) {
+	data, err := os.ReadFile("./test.jpg")
+	if err != nil {
+		t.Fatalf("os.ReadFile() failed: %v", err)
+	}
+
+	if o := exifOrientation(data); o != OrientationNormal {
+		t.Errorf("expected %v, got %v", OrientationNormal, o)
+	}
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		for o := OrientationNormal; o <= OrientationRotate270; o++ {
+			if got := exifOrientation(withExifOrientation(data, order, o)); got != o {
+				t.Errorf("%v: expected %v, got %v", order, o, got)
+			}
+		}
+		if got := exifOrientation(withExifOrientation(data, order, 9)); got != OrientationNormal {
+			t.Errorf("%v: invalid orientation should be ignored, got %v", order, got)
+		}
+	}
+
+	if o := exifOrientation([]byte("not a jpeg")); o != OrientationNormal {
+		t.Errorf("expected %v, got %v", OrientationNormal, o)
+	}
+}
+
+func TestOrient(t *testing.T) {
+	in_size := image.Point{5, 3}
+	for _, channels := range []int{1, 3, 4} {
+		in := make([]uint8, channels*in_size.X*in_size.Y)
+		for i := range in {
+			in[i] = uint8(i)
+		}
+
+		for o := OrientationNormal; o <= OrientationRotate270; o++ {
+			out, out_size, err := Orient(in, channels*in_size.X, in_size, channels, o)
+			if err != nil {
+				t.Fatalf("Orient(%v) failed: %v", o, err)
+			}
+			if out_size != o.Size(in_size) {
+				t.Fatalf("Orient(%v): unexpected size %v", o, out_size)
+			}
+			for y := 0; y < in_size.Y; y++ {
+				for x := 0; x < in_size.X; x++ {
+					// map the center of the pixel
+					fx, fy := o.Point(float64(x)+0.5, float64(y)+0.5, in_size)
+					ox, oy := int(fx), int(fy)
+					for c := 0; c < channels; c++ {
+						expected := in[channels*(y*in_size.X+x)+c]
+						if got := out[channels*(oy*out_size.X+ox)+c]; got != expected {
+							t.Fatalf("Orient(%v), channels=%v: pixel (%v, %v) expected at (%v, %v), got %v instead of %v", o, channels, x, y, ox, oy, got, expected)
+						}
+					}
+				}
+			}
+
+			back, _, err := Orient(out, channels*out_size.X, out_size, channels, o.Inverse())
+			if err != nil {
+				t.Fatalf("Orient(%v) failed: %v", o.Inverse(), err)
+			}
+			if !bytes.Equal(back, in) {
+				t.Errorf("Orient(%v) is not undone by %v", o, o.Inverse())
+			}
+		}
+	}
+
+	_, _, err := Orient(make([]uint8, 15), 5, in_size, 1, 0)
+	if err == nil {
+		t.Errorf("invalid orientation should fail")
+	}
+}
+
+func TestOrientedJpeg(t *testing.T) {
+	data, err := os.ReadFile("./test.jpg")
+	if err != nil {
+		t.Fatalf("os.ReadFile() failed: %v", err)
+	}
+	rotated := withExifOrientation(data, binary.BigEndian, OrientationRotate90)
+
+	box := image.Point{200, 100}
+
+	_, size, err := JpegToRGB(bytes.NewReader(data), box, InterpolationLinear)
+	if err != nil {
+		t.Fatalf("JpegToRGB() failed: %v", err)
+	}
+	if size.Y != box.Y || size.X >= box.X {
+		t.Errorf("unexpected size of portrait image: %v", size)
+	}
+
+	_, size, err = JpegToRGB(bytes.NewReader(rotated), box, InterpolationLinear)
+	if err != nil {
+		t.Fatalf("JpegToRGB() failed: %v", err)
+	}
+	if size != (image.Point{150, 100}) {
+		t.Errorf("unexpected size of rotated image: %v", size)
+	}
+
+	// the rotated result must match the plain one rotated afterwards
+	plain, plain_size, err := JpegToFitGray(bytes.NewReader(data), image.Point{50, 50}, FitFill, nil, InterpolationNearestNeighbour, nil)
+	if err != nil {
+		t.Fatalf("JpegToFitGray() failed: %v", err)
+	}
+	var transform Transform
+	got, got_size, err := JpegToFitGray(bytes.NewReader(rotated), image.Point{50, 50}, FitFill, nil, InterpolationNearestNeighbour, &transform)
+	if err != nil {
+		t.Fatalf("JpegToFitGray() failed: %v", err)
+	}
+	expected, expected_size, err := Orient(plain, plain_size.X, plain_size, 1, OrientationRotate90)
+	if err != nil {
+		t.Fatalf("Orient() failed: %v", err)
+	}
+	if got_size != expected_size || !bytes.Equal(got, expected) {
+		t.Errorf("rotated jpeg doesn't match the rotated result")
+	}
+	if transform.OrigSize != (image.Point{850, 566}) || transform.Orientation != OrientationRotate90 {
+		t.Errorf("unexpected transform: %+v", transform)
+	}
+
+	im, err := JpegToImage(bytes.NewReader(rotated), box, InterpolationLinear)
+	if err != nil {
+		t.Fatalf("JpegToImage() failed: %v", err)
+	}
+	if s := im.Bounds().Size(); s.X <= s.Y {
+		t.Errorf("JpegToImage() result is not rotated: %v", s)
+	}
+}
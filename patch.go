@@ -0,0 +1,246 @@
+package ippresize
+
+/*
+#include "image.h"
+*/
+import "C"
+
+import (
+	"image"
+	"math"
+	"runtime"
+	"unsafe"
+)
+
+// ExtractPatch returns a patch of size pixels centered at (cx, cy) of the input image.
+// The patch covers size/scale pixels of the input image, so scale > 1 zooms in.
+// The window is mapped to the patch exactly, including sub-pixel offsets of the center.
+// The part of the window outside of the input image is taken according to mode relative to the image edges, see BorderMode.
+// Pixels outside of the input image are never read.
+func ExtractPatch(in []uint8, in_stride int, in_size image.Point, channels int, cx, cy float64, size image.Point, scale float64, mode BorderMode, value []uint8, interpolation Interpolation) ([]uint8, error) {
+
+	if in_size.X <= 0 || in_size.Y <= 0 {
+		return nil, NewError(0, "one of the input image dimensions is invalid: {width: %v, height: %v}", in_size.X, in_size.Y)
+	}
+
+	if channels != 1 && channels != 3 && channels != 4 {
+		return nil, NewError(0, "invalid number of channels: %v", channels)
+	}
+
+	if in_stride < channels*in_size.X || len(in) < in_stride*(in_size.Y-1)+channels*in_size.X {
+		return nil, NewError(0, "input image buffer size doesn't match image dimensions: {width: %v, height: %v, channels: %v, stride: %v}, len=%v",
+			in_size.X, in_size.Y, channels, in_stride, len(in))
+	}
+
+	if size.X <= 0 || size.Y <= 0 {
+		return nil, NewError(0, "one of the patch dimensions is invalid: {width: %v, height: %v}", size.X, size.Y)
+	}
+
+	if !(scale > 0) {
+		return nil, NewError(0, "invalid patch scale: %v", scale)
+	}
+
+	value_data, err := borderValue(channels, mode, value)
+	if err != nil {
+		return nil, err
+	}
+
+	out_stride := channels * size.X
+	out := make([]uint8, out_stride*size.Y)
+
+	// patch window in input image coordinates
+	wx0 := cx - float64(size.X)/(2*scale)
+	wy0 := cy - float64(size.Y)/(2*scale)
+	wx1 := wx0 + float64(size.X)/scale
+	wy1 := wy0 + float64(size.Y)/scale
+
+	src := image.Rect(
+		int(math.Floor(wx0)), int(math.Floor(wy0)),
+		int(math.Ceil(wx1)), int(math.Ceil(wy1)),
+	).Intersect(image.Rectangle{Max: in_size})
+
+	if src.Empty() && mode == BorderConstant {
+		if value_data != nil {
+			fillColor(out, value)
+		}
+		return out, nil
+	}
+
+	// the window with the margin for the support of the filter is mapped to the patch exactly
+	margin := 2
+	if !warpInterpolation(interpolation) {
+		margin = int(math.Ceil(5 * math.Max(1, 1/scale)))
+	}
+
+	area := image.Rect(
+		int(math.Floor(wx0))-margin, int(math.Floor(wy0))-margin,
+		int(math.Ceil(wx1))+margin, int(math.Ceil(wy1))+margin,
+	)
+	area_size := area.Size()
+
+	var area_pix []uint8
+	var area_stride int
+
+	if area.In(image.Rectangle{Max: in_size}) {
+		area_pix = in[channels*area.Min.X+in_stride*area.Min.Y:]
+		area_stride = in_stride
+	} else {
+		area_pix, area_stride = borderArea(in, in_stride, in_size, channels, area, mode, value)
+	}
+
+	// pixel centers of the area to the pixel centers of the patch
+	coeffs := [2][3]float64{
+		{scale, 0, scale*(float64(area.Min.X)-wx0+0.5) - 0.5},
+		{0, scale, scale*(float64(area.Min.Y)-wy0+0.5) - 0.5},
+	}
+
+	warp_interpolation := interpolation
+
+	if !warpInterpolation(interpolation) {
+		// the filter is applied by resize close to the scale of the patch, the warp only shifts and stretches the result slightly
+		resized_size := image.Point{
+			X: int(math.Max(1, math.Round(float64(area_size.X)*scale))),
+			Y: int(math.Max(1, math.Round(float64(area_size.Y)*scale))),
+		}
+		resized_stride := channels * resized_size.X
+		resized := make([]uint8, resized_stride*resized_size.Y)
+
+		err = Resize(area_pix, area_stride, area_size, resized, resized_stride, resized_size, channels, interpolation)
+		if err != nil {
+			return nil, err
+		}
+
+		kx := float64(resized_size.X) / float64(area_size.X)
+		ky := float64(resized_size.Y) / float64(area_size.Y)
+		coeffs[0][0], coeffs[0][2] = scale/kx, coeffs[0][2]+scale*(0.5/kx-0.5)
+		coeffs[1][1], coeffs[1][2] = scale/ky, coeffs[1][2]+scale*(0.5/ky-0.5)
+
+		area_pix, area_stride, area_size = resized, resized_stride, resized_size
+		warp_interpolation = InterpolationLinear
+	}
+
+	err = warpAffine(area_pix, area_stride, area_size, out, out_stride, size, channels, coeffs, warp_interpolation)
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// warpInterpolation reports whether the interpolation is supported by warpAffine()
+func warpInterpolation(interpolation Interpolation) bool {
+	switch interpolation {
+	case InterpolationNearestNeighbour, InterpolationLinear, InterpolationCubic:
+		return true
+	}
+	return false
+}
+
+// borderArea returns a copy of the area of the input image, the pixels outside of the image are taken according to mode
+func borderArea(in []uint8, in_stride int, in_size image.Point, channels int, area image.Rectangle, mode BorderMode, value []uint8) (pix []uint8, stride int) {
+	size := area.Size()
+	stride = channels * size.X
+	pix = make([]uint8, stride*size.Y)
+
+	if mode == BorderConstant && value != nil {
+		fillColor(pix, value)
+	}
+
+	for y := 0; y < size.Y; y++ {
+		sy, ok := borderIndex(area.Min.Y+y, in_size.Y, mode)
+		if !ok {
+			continue
+		}
+		row := pix[y*stride:]
+		for x := 0; x < size.X; x++ {
+			sx, ok := borderIndex(area.Min.X+x, in_size.X, mode)
+			if !ok {
+				continue
+			}
+			offset := in_stride*sy + channels*sx
+			copy(row[channels*x:channels*(x+1)], in[offset:offset+channels])
+		}
+	}
+
+	return
+}
+
+// borderIndex maps coordinate i to the coordinate of the image of size n, ok is false for the constant border outside of the image
+func borderIndex(i, n int, mode BorderMode) (index int, ok bool) {
+	if i >= 0 && i < n {
+		return i, true
+	}
+
+	switch mode {
+	case BorderConstant:
+		return 0, false
+	case BorderWrap:
+		i %= n
+		if i < 0 {
+			i += n
+		}
+		return i, true
+	case BorderReflect, BorderReflect101:
+		period, last := 2*n, 2*n-1
+		if mode == BorderReflect101 {
+			if n == 1 {
+				return 0, true
+			}
+			period, last = 2*n-2, 2*n-2
+		}
+		i %= period
+		if i < 0 {
+			i += period
+		}
+		if i >= n {
+			i = last - i
+		}
+		return i, true
+	}
+
+	return clampInt(i, 0, n-1), true
+}
+
+// warpAffine maps the input image to the output image, coeffs transform the pixel centers of the input image to the ones of the output image.
+// Only nearest neighbour, linear and cubic interpolations are supported, the input image is extended by replication of the edge pixels.
+func warpAffine(in []uint8, in_stride int, in_size image.Point, out []uint8, out_stride int, out_size image.Point, channels int, coeffs [2][3]float64, interpolation Interpolation) error {
+
+	var img_in C.struct_image_s
+	img_in.w = C.uint(in_size.X)
+	img_in.h = C.uint(in_size.Y)
+	img_in.channels = C.uint(channels)
+	img_in.rowstep = C.ulong(in_stride)
+	img_in_data := (*C.uchar)(unsafe.Pointer(&in[0]))
+
+	var img_out C.struct_image_s
+	img_out.w = C.uint(out_size.X)
+	img_out.h = C.uint(out_size.Y)
+	img_out.channels = C.uint(channels)
+	img_out.rowstep = C.ulong(out_stride)
+	img_out_data := (*C.uchar)(unsafe.Pointer(&out[0]))
+
+	var c_coeffs [2][3]C.double
+	for r := range coeffs {
+		for c := range coeffs[r] {
+			c_coeffs[r][c] = C.double(coeffs[r][c])
+		}
+	}
+
+	const err_size = 1024
+	var err [err_size]C.char
+
+	ret := C.image_ipp_warp_affine(&img_in, img_in_data, &img_out, img_out_data, &c_coeffs[0], C.image_interpolation_t(interpolation), &err[0], err_size)
+
+	/* make 100% sure garbage collector wont kill these objects in the middle of execution of c function */
+	runtime.KeepAlive(img_in)
+	runtime.KeepAlive(img_in_data)
+	runtime.KeepAlive(img_out)
+	runtime.KeepAlive(img_out_data)
+	runtime.KeepAlive(c_coeffs)
+
+	if ret != 0 {
+		return NewError(int(ret), "C.image_ipp_warp_affine() failed: %v", C.GoString(&err[0]))
+	}
+
+	return nil
+}
@@ -0,0 +1,200 @@
+package ippresize
+
+import (
+	"bytes"
+	"image"
+	"math"
+	"testing"
+)
+
+func TestExtractPatch(t *testing.T) {
+	size := image.Point{10, 10}
+	in := make([]uint8, size.X*size.Y)
+	for i := range in {
+		in[i] = uint8(i)
+	}
+
+	tests := []struct {
+		cx, cy   float64
+		mode     BorderMode
+		expected []uint8
+	}{
+		{5, 5, BorderReplicate, []uint8{
+			33, 34, 35, 36,
+			43, 44, 45, 46,
+			53, 54, 55, 56,
+			63, 64, 65, 66,
+		}},
+		{1, 1, BorderReplicate, []uint8{
+			0, 0, 1, 2,
+			0, 0, 1, 2,
+			10, 10, 11, 12,
+			20, 20, 21, 22,
+		}},
+		{1, 1, BorderConstant, []uint8{
+			7, 7, 7, 7,
+			7, 0, 1, 2,
+			7, 10, 11, 12,
+			7, 20, 21, 22,
+		}},
+		{10, 9, BorderReflect, []uint8{
+			78, 79, 79, 78,
+			88, 89, 89, 88,
+			98, 99, 99, 98,
+			98, 99, 99, 98,
+		}},
+		{-10, -10, BorderConstant, []uint8{
+			7, 7, 7, 7,
+			7, 7, 7, 7,
+			7, 7, 7, 7,
+			7, 7, 7, 7,
+		}},
+		{-10, 0.5, BorderWrap, []uint8{
+			98, 99, 90, 91,
+			8, 9, 0, 1,
+			18, 19, 10, 11,
+			28, 29, 20, 21,
+		}},
+		{-10, 5, BorderReplicate, []uint8{
+			30, 30, 30, 30,
+			40, 40, 40, 40,
+			50, 50, 50, 50,
+			60, 60, 60, 60,
+		}},
+		{-10, 5, BorderReflect, []uint8{
+			38, 39, 39, 38,
+			48, 49, 49, 48,
+			58, 59, 59, 58,
+			68, 69, 69, 68,
+		}},
+		{-10, 5, BorderReflect101, []uint8{
+			36, 37, 38, 39,
+			46, 47, 48, 49,
+			56, 57, 58, 59,
+			66, 67, 68, 69,
+		}},
+		{25, 5, BorderReflect101, []uint8{
+			35, 36, 37, 38,
+			45, 46, 47, 48,
+			55, 56, 57, 58,
+			65, 66, 67, 68,
+		}},
+	}
+
+	for _, item := range tests {
+		out, err := ExtractPatch(in, size.X, size, 1, item.cx, item.cy, image.Point{4, 4}, 1, item.mode, []uint8{7}, InterpolationNearestNeighbour)
+		if err != nil {
+			t.Fatalf("ExtractPatch(%v, %v, %v) failed: %v", item.cx, item.cy, item.mode, err)
+		}
+		if !bytes.Equal(out, item.expected) {
+			t.Errorf("ExtractPatch(%v, %v, %v): expected %v, got %v", item.cx, item.cy, item.mode, item.expected, out)
+		}
+	}
+
+	// 2x zoom of the corner with a linear filter has enough support from the replicated border
+	out, err := ExtractPatch(in, size.X, size, 1, 0, 0, image.Point{4, 4}, 2, BorderReplicate, nil, InterpolationLinear)
+	if err != nil {
+		t.Fatalf("ExtractPatch() failed: %v", err)
+	}
+	expected := samplePatch(in, size, 1, 0, 0, image.Point{4, 4}, 2, BorderReplicate)
+	for i, v := range out {
+		if math.Abs(float64(v)-expected[i]) > 1 {
+			t.Errorf("2x zoom: sample %v expected %.2f, got %v", i, expected[i], v)
+		}
+	}
+
+	// short buffers and strides fail
+	for _, item := range []struct {
+		in        []uint8
+		in_stride int
+	}{
+		{in[:len(in)-1], size.X},
+		{in, size.X - 1},
+		{in, size.X + 1},
+		{nil, size.X},
+	} {
+		if _, err := ExtractPatch(item.in, item.in_stride, size, 1, 5, 5, image.Point{4, 4}, 1, BorderReplicate, nil, InterpolationLinear); err == nil {
+			t.Errorf("len %v, stride %v: expected an error", len(item.in), item.in_stride)
+		}
+	}
+	if _, err := ExtractPatch(in, size.X, size, 2, 5, 5, image.Point{4, 4}, 1, BorderReplicate, nil, InterpolationLinear); err == nil {
+		t.Errorf("invalid number of channels should fail")
+	}
+}
+
+// samplePatch returns the patch sampled from the image with bilinear interpolation at the exact positions of its pixel centers
+func samplePatch(in []uint8, size image.Point, channels int, cx, cy float64, patch_size image.Point, scale float64, mode BorderMode) []float64 {
+	pixel := func(x, y, c int) float64 {
+		sx, ok_x := borderIndex(x, size.X, mode)
+		sy, ok_y := borderIndex(y, size.Y, mode)
+		if !ok_x || !ok_y {
+			return 0
+		}
+		return float64(in[(sy*size.X+sx)*channels+c])
+	}
+
+	out := make([]float64, patch_size.X*patch_size.Y*channels)
+	for j := 0; j < patch_size.Y; j++ {
+		for i := 0; i < patch_size.X; i++ {
+			fx := cx + (float64(i)+0.5-float64(patch_size.X)/2)/scale - 0.5
+			fy := cy + (float64(j)+0.5-float64(patch_size.Y)/2)/scale - 0.5
+			x0, y0 := int(math.Floor(fx)), int(math.Floor(fy))
+			ax, ay := fx-float64(x0), fy-float64(y0)
+			for c := 0; c < channels; c++ {
+				out[(j*patch_size.X+i)*channels+c] = (1-ay)*((1-ax)*pixel(x0, y0, c)+ax*pixel(x0+1, y0, c)) +
+					ay*((1-ax)*pixel(x0, y0+1, c)+ax*pixel(x0+1, y0+1, c))
+			}
+		}
+	}
+	return out
+}
+
+func TestExtractPatchSubpixel(t *testing.T) {
+	size := image.Point{40, 30}
+	channels := 3
+	in := testPattern(size, channels, channels*size.X)
+
+	tests := []struct {
+		cx, cy float64
+		scale  float64
+		mode   BorderMode
+	}{
+		{10.5, 12, 1, BorderReplicate},
+		{10.25, 7.75, 1, BorderReplicate},
+		{20.3, 15.6, 1.7, BorderReflect},
+		{1.5, 28.5, 1, BorderReflect101},
+		{38.2, 0.7, 2, BorderWrap},
+		{0.5, 3.5, 1, BorderConstant},
+		{19.5, 14.5, 0.75, BorderReplicate},
+	}
+
+	patch_size := image.Point{8, 6}
+	for _, item := range tests {
+		out, err := ExtractPatch(in, channels*size.X, size, channels, item.cx, item.cy, patch_size, item.scale, item.mode, nil, InterpolationLinear)
+		if err != nil {
+			t.Fatalf("ExtractPatch(%v, %v, %v) failed: %v", item.cx, item.cy, item.scale, err)
+		}
+		expected := samplePatch(in, size, channels, item.cx, item.cy, patch_size, item.scale, item.mode)
+		for i, v := range out {
+			if math.Abs(float64(v)-expected[i]) > 1 {
+				t.Errorf("ExtractPatch(%v, %v, %v, %v): sample %v expected %.2f, got %v", item.cx, item.cy, item.scale, item.mode, i, expected[i], v)
+				break
+			}
+		}
+	}
+
+	// filters applied by resize keep the position of the window
+	for _, interpolation := range []Interpolation{InterpolationCubic, InterpolationLanczos, InterpolationAntialiasingLinear} {
+		out, err := ExtractPatch(in, channels*size.X, size, channels, 10.5, 12.25, patch_size, 1, BorderReplicate, nil, interpolation)
+		if err != nil {
+			t.Fatalf("ExtractPatch(%v) failed: %v", interpolation, err)
+		}
+		expected := samplePatch(in, size, channels, 10.5, 12.25, patch_size, 1, BorderReplicate)
+		for i, v := range out {
+			if math.Abs(float64(v)-expected[i]) > 4 {
+				t.Errorf("ExtractPatch(%v): sample %v expected %.2f, got %v", interpolation, i, expected[i], v)
+				break
+			}
+		}
+	}
+}
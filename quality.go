@@ -0,0 +1,331 @@
+package ippresize
+
+/*
+#include "image.h"
+*/
+import "C"
+
+import (
+	"image"
+	"math"
+	"runtime"
+	"unsafe"
+)
+
+// constants of the structural similarity for 8 bit samples
+const (
+	ssimC1     = (0.01 * 255) * (0.01 * 255)
+	ssimC2     = (0.03 * 255) * (0.03 * 255)
+	ssimRadius = 5 // of the 11x11 gaussian window
+	ssimSigma  = 1.5
+)
+
+// msssimWeights are the weights of the scales of the multi-scale structural similarity, the finest scale first
+var msssimWeights = [...]float64{0.0448, 0.2856, 0.3001, 0.2363, 0.1333}
+
+// checkPair checks the images a and b of the same size and number of channels
+func checkPair(a []uint8, a_stride int, b []uint8, b_stride int, size image.Point, channels int) error {
+
+	if size.X <= 0 || size.Y <= 0 {
+		return NewError(0, "one of the image dimensions is invalid: {width: %v, height: %v}", size.X, size.Y)
+	}
+
+	if channels != 1 && channels != 3 && channels != 4 {
+		return NewError(0, "invalid number of channels: %v", channels)
+	}
+
+	if len(a) < a_stride*(size.Y-1)+channels*size.X {
+		return NewError(0, "first image buffer size doesn't match image dimensions: {width: %v, height: %v, channels: %v}, len=%v",
+			size.X, size.Y, channels, len(a))
+	}
+
+	if len(b) < b_stride*(size.Y-1)+channels*size.X {
+		return NewError(0, "second image buffer size doesn't match image dimensions: {width: %v, height: %v, channels: %v}, len=%v",
+			size.X, size.Y, channels, len(b))
+	}
+
+	return nil
+}
+
+func pairImages(a []uint8, a_stride int, b []uint8, b_stride int, size image.Point, channels int) (img_a C.struct_image_s, img_a_data *C.uchar, img_b C.struct_image_s, img_b_data *C.uchar) {
+	img_a.w = C.uint(size.X)
+	img_a.h = C.uint(size.Y)
+	img_a.channels = C.uint(channels)
+	img_a.rowstep = C.size_t(a_stride)
+	img_a_data = (*C.uchar)(unsafe.Pointer(&a[0]))
+
+	img_b = img_a
+	img_b.rowstep = C.size_t(b_stride)
+	img_b_data = (*C.uchar)(unsafe.Pointer(&b[0]))
+	return
+}
+
+// normDiff returns the sum of the per channel norms of the difference of the images, L2 norms are squared
+func normDiff(a []uint8, a_stride int, b []uint8, b_stride int, size image.Point, channels int, l2 bool) (sum float64, err error) {
+	if err = checkPair(a, a_stride, b, b_stride, size, channels); err != nil {
+		return
+	}
+
+	img_a, img_a_data, img_b, img_b_data := pairImages(a, a_stride, b, b_stride, size, channels)
+
+	var c_l2 C.int
+	if l2 {
+		c_l2 = 1
+	}
+
+	var value [4]C.double
+
+	const err_size = 1024
+	var cerr [err_size]C.char
+
+	ret := C.image_ipp_norm_diff(&img_a, img_a_data, &img_b, img_b_data, c_l2, &value[0], &cerr[0], err_size)
+
+	/* make 100% sure garbage collector wont kill these objects in the middle of execution of c function */
+	runtime.KeepAlive(img_a)
+	runtime.KeepAlive(img_a_data)
+	runtime.KeepAlive(img_b)
+	runtime.KeepAlive(img_b_data)
+
+	if ret != 0 {
+		err = NewError(int(ret), "C.image_ipp_norm_diff() failed: %v", C.GoString(&cerr[0]))
+		return
+	}
+
+	for c := 0; c < channels; c++ {
+		v := float64(value[c])
+		if l2 {
+			v *= v
+		}
+		sum += v
+	}
+
+	return
+}
+
+// MAE returns the mean absolute error between the samples of the images of the same size, from 0 for equal images to 255
+func MAE(a []uint8, a_stride int, b []uint8, b_stride int, size image.Point, channels int) (float64, error) {
+	sum, err := normDiff(a, a_stride, b, b_stride, size, channels, false)
+	if err != nil {
+		return 0, err
+	}
+	return sum / (float64(size.X) * float64(size.Y) * float64(channels)), nil
+}
+
+// PSNR returns the peak signal-to-noise ratio of the images of the same size in dB, +Inf for equal images
+func PSNR(a []uint8, a_stride int, b []uint8, b_stride int, size image.Point, channels int) (float64, error) {
+	sum, err := normDiff(a, a_stride, b, b_stride, size, channels, true)
+	if err != nil {
+		return 0, err
+	}
+	mse := sum / (float64(size.X) * float64(size.Y) * float64(channels))
+	if mse == 0 {
+		return math.Inf(1), nil
+	}
+	return 10 * math.Log10(255*255/mse), nil
+}
+
+// QualityIndex returns the universal image quality index of the images of the same size computed over the whole image
+// and averaged over the channels, it is 1 for equal images. Constant images make it undefined and return an error.
+func QualityIndex(a []uint8, a_stride int, b []uint8, b_stride int, size image.Point, channels int) (index float64, err error) {
+	if err = checkPair(a, a_stride, b, b_stride, size, channels); err != nil {
+		return
+	}
+
+	img_a, img_a_data, img_b, img_b_data := pairImages(a, a_stride, b, b_stride, size, channels)
+
+	var value [4]C.float
+
+	const err_size = 1024
+	var cerr [err_size]C.char
+
+	ret := C.image_ipp_quality_index(&img_a, img_a_data, &img_b, img_b_data, &value[0], &cerr[0], err_size)
+
+	/* make 100% sure garbage collector wont kill these objects in the middle of execution of c function */
+	runtime.KeepAlive(img_a)
+	runtime.KeepAlive(img_a_data)
+	runtime.KeepAlive(img_b)
+	runtime.KeepAlive(img_b_data)
+
+	if ret != 0 {
+		err = NewError(int(ret), "C.image_ipp_quality_index() failed: %v", C.GoString(&cerr[0]))
+		return
+	}
+
+	for c := 0; c < channels; c++ {
+		index += float64(value[c])
+	}
+	index /= float64(channels)
+
+	return
+}
+
+// SSIM returns the mean structural similarity of the images of the same size over 11x11 gaussian windows,
+// averaged over the channels. It is 1 for equal images, the window is smaller for images smaller than it.
+func SSIM(a []uint8, a_stride int, b []uint8, b_stride int, size image.Point, channels int) (float64, error) {
+	if err := checkPair(a, a_stride, b, b_stride, size, channels); err != nil {
+		return 0, err
+	}
+
+	var sum float64
+	for c := 0; c < channels; c++ {
+		pa := newPlane(a, a_stride, size, channels, c)
+		pb := newPlane(b, b_stride, size, channels, c)
+		ssim, _ := planeSSIM(pa, pb)
+		sum += ssim
+	}
+
+	return sum / float64(channels), nil
+}
+
+// MSSSIM returns the multi-scale structural similarity of the images of the same size averaged over the channels.
+// It uses up to 5 scales halving the size while it stays at least 11 pixels, the weights are renormalized when fewer scales fit.
+func MSSSIM(a []uint8, a_stride int, b []uint8, b_stride int, size image.Point, channels int) (float64, error) {
+	if err := checkPair(a, a_stride, b, b_stride, size, channels); err != nil {
+		return 0, err
+	}
+
+	scales := 1
+	for s := size; scales < len(msssimWeights) && s.X/2 >= 2*ssimRadius+1 && s.Y/2 >= 2*ssimRadius+1; s = s.Div(2) {
+		scales++
+	}
+
+	var weight_sum float64
+	for _, w := range msssimWeights[:scales] {
+		weight_sum += w
+	}
+
+	var sum float64
+	for c := 0; c < channels; c++ {
+		pa := newPlane(a, a_stride, size, channels, c)
+		pb := newPlane(b, b_stride, size, channels, c)
+
+		product := 1.0
+		for i := 0; i < scales; i++ {
+			ssim, cs := planeSSIM(pa, pb)
+			// contrast and structure only at the finer scales, luminance as well at the coarsest one
+			if i == scales-1 {
+				product *= math.Pow(math.Max(ssim, 0), msssimWeights[i]/weight_sum)
+				break
+			}
+			product *= math.Pow(math.Max(cs, 0), msssimWeights[i]/weight_sum)
+			pa, pb = pa.half(), pb.half()
+		}
+		sum += product
+	}
+
+	return sum / float64(channels), nil
+}
+
+// plane is a single channel of an image
+type plane struct {
+	pix  []float64
+	size image.Point
+}
+
+func newPlane(pix []uint8, stride int, size image.Point, channels int, channel int) plane {
+	p := plane{pix: make([]float64, size.X*size.Y), size: size}
+	for y := 0; y < size.Y; y++ {
+		row := pix[y*stride:]
+		for x := 0; x < size.X; x++ {
+			p.pix[y*size.X+x] = float64(row[x*channels+channel])
+		}
+	}
+	return p
+}
+
+// half returns the plane downsampled by 2 averaging 2x2 blocks
+func (p plane) half() plane {
+	size := p.size.Div(2)
+	h := plane{pix: make([]float64, size.X*size.Y), size: size}
+	for y := 0; y < size.Y; y++ {
+		r0 := p.pix[2*y*p.size.X:]
+		r1 := p.pix[(2*y+1)*p.size.X:]
+		for x := 0; x < size.X; x++ {
+			h.pix[y*size.X+x] = (r0[2*x] + r0[2*x+1] + r1[2*x] + r1[2*x+1]) / 4
+		}
+	}
+	return h
+}
+
+// gaussianKernel returns the normalized kernel of the radius
+func gaussianKernel(radius int) []float64 {
+	kernel := make([]float64, 2*radius+1)
+	var sum float64
+	for i := range kernel {
+		d := float64(i - radius)
+		kernel[i] = math.Exp(-d * d / (2 * ssimSigma * ssimSigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+	return kernel
+}
+
+// filter returns the weighted means of the windows fully inside the plane, the kernel is applied in both directions
+func (p plane) filter(kernel []float64) plane {
+	n := len(kernel)
+	size := image.Point{p.size.X - n + 1, p.size.Y - n + 1}
+
+	tmp := make([]float64, size.X*p.size.Y)
+	for y := 0; y < p.size.Y; y++ {
+		row := p.pix[y*p.size.X:]
+		for x := 0; x < size.X; x++ {
+			var v float64
+			for i, k := range kernel {
+				v += k * row[x+i]
+			}
+			tmp[y*size.X+x] = v
+		}
+	}
+
+	out := plane{pix: make([]float64, size.X*size.Y), size: size}
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			var v float64
+			for i, k := range kernel {
+				v += k * tmp[(y+i)*size.X+x]
+			}
+			out.pix[y*size.X+x] = v
+		}
+	}
+	return out
+}
+
+// product returns the plane of the products of the samples of the planes
+func (p plane) product(q plane) plane {
+	out := plane{pix: make([]float64, len(p.pix)), size: p.size}
+	for i := range p.pix {
+		out.pix[i] = p.pix[i] * q.pix[i]
+	}
+	return out
+}
+
+// planeSSIM returns the mean structural similarity of the planes of the same size and the mean of its contrast and structure part
+func planeSSIM(a plane, b plane) (ssim float64, cs float64) {
+	radius := ssimRadius
+	if r := (a.size.X - 1) / 2; r < radius {
+		radius = r
+	}
+	if r := (a.size.Y - 1) / 2; r < radius {
+		radius = r
+	}
+	kernel := gaussianKernel(radius)
+
+	mu_a, mu_b := a.filter(kernel), b.filter(kernel)
+	aa, bb, ab := a.product(a).filter(kernel), b.product(b).filter(kernel), a.product(b).filter(kernel)
+
+	for i := range mu_a.pix {
+		ma, mb := mu_a.pix[i], mu_b.pix[i]
+		var_a := aa.pix[i] - ma*ma
+		var_b := bb.pix[i] - mb*mb
+		cov := ab.pix[i] - ma*mb
+
+		c := (2*cov + ssimC2) / (var_a + var_b + ssimC2)
+		cs += c
+		ssim += (2*ma*mb + ssimC1) / (ma*ma + mb*mb + ssimC1) * c
+	}
+
+	n := float64(len(mu_a.pix))
+	return ssim / n, cs / n
+}
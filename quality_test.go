@@ -0,0 +1,136 @@
+package ippresize
+
+import (
+	"image"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+type qualityMetric struct {
+	name string
+	f    func(a []uint8, a_stride int, b []uint8, b_stride int, size image.Point, channels int) (float64, error)
+}
+
+var qualityMetrics = [...]qualityMetric{
+	{"MAE", MAE},
+	{"PSNR", PSNR},
+	{"QualityIndex", QualityIndex},
+	{"SSIM", SSIM},
+	{"MSSSIM", MSSSIM},
+}
+
+// testPattern returns a smooth image with the stride padded by garbage
+func testPattern(size image.Point, channels int, stride int) []uint8 {
+	pix := make([]uint8, stride*size.Y)
+	for i := range pix {
+		pix[i] = 0xee
+	}
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			for c := 0; c < channels; c++ {
+				v := 120 + 60*math.Sin(float64(x)/7+float64(c)) + 50*math.Cos(float64(y)/5)
+				pix[y*stride+x*channels+c] = uint8(v)
+			}
+		}
+	}
+	return pix
+}
+
+// withNoise returns a copy of the image with uniform noise of the amplitude added to the samples
+func withNoise(pix []uint8, amplitude int, seed int64) []uint8 {
+	r := rand.New(rand.NewSource(seed))
+	out := make([]uint8, len(pix))
+	for i, v := range pix {
+		n := int(v) + r.Intn(2*amplitude+1) - amplitude
+		if n < 0 {
+			n = 0
+		} else if n > 255 {
+			n = 255
+		}
+		out[i] = uint8(n)
+	}
+	return out
+}
+
+func TestQualityMetrics(t *testing.T) {
+	size := image.Point{150, 130}
+
+	for _, channels := range []int{1, 3, 4} {
+		stride := channels*size.X + 5
+		a := testPattern(size, channels, stride)
+
+		// the same image with another stride
+		b_stride := channels * size.X
+		b := make([]uint8, b_stride*size.Y)
+		for y := 0; y < size.Y; y++ {
+			copy(b[y*b_stride:(y+1)*b_stride], a[y*stride:])
+		}
+
+		expected := map[string]float64{"MAE": 0, "PSNR": math.Inf(1), "QualityIndex": 1, "SSIM": 1, "MSSSIM": 1}
+		for _, m := range qualityMetrics {
+			v, err := m.f(a, stride, b, b_stride, size, channels)
+			if err != nil {
+				t.Fatalf("%v() failed: %v", m.name, err)
+			}
+			if math.Abs(v-expected[m.name]) > 1e-6 && v != expected[m.name] {
+				t.Errorf("%v: equal images with %v channels: expected %v, got %v", m.name, channels, expected[m.name], v)
+			}
+		}
+
+		// constant offset
+		for i := range b {
+			b[i] += 10
+		}
+		if mae, _ := MAE(a, stride, b, b_stride, size, channels); math.Abs(mae-10) > 1e-9 {
+			t.Errorf("MAE: expected 10, got %v", mae)
+		}
+		if psnr, _ := PSNR(a, stride, b, b_stride, size, channels); math.Abs(psnr-10*math.Log10(255*255/100.)) > 1e-9 {
+			t.Errorf("PSNR: expected %v, got %v", 10*math.Log10(255*255/100.), psnr)
+		}
+
+		// more noise makes all the metrics worse
+		weak, strong := withNoise(a, 5, 1), withNoise(a, 40, 2)
+		for _, m := range qualityMetrics {
+			v_weak, err := m.f(a, stride, weak, stride, size, channels)
+			if err != nil {
+				t.Fatalf("%v() failed: %v", m.name, err)
+			}
+			v_strong, err := m.f(a, stride, strong, stride, size, channels)
+			if err != nil {
+				t.Fatalf("%v() failed: %v", m.name, err)
+			}
+			if m.name == "MAE" {
+				v_weak, v_strong = -v_weak, -v_strong
+			}
+			if !(v_weak > v_strong) || (m.name != "MAE" && m.name != "PSNR" && (v_weak >= 1 || v_strong <= 0)) {
+				t.Errorf("%v with %v channels: weak noise %v, strong noise %v", m.name, channels, v_weak, v_strong)
+			}
+		}
+	}
+
+	// images smaller than the window and too small for all the scales
+	for _, size := range []image.Point{{1, 1}, {5, 40}, {30, 30}} {
+		a := testPattern(size, 3, 3*size.X)
+		b := withNoise(a, 20, 3)
+		for _, m := range []qualityMetric{qualityMetrics[3], qualityMetrics[4]} {
+			v, err := m.f(a, 3*size.X, b, 3*size.X, size, 3)
+			if err != nil || math.IsNaN(v) || v > 1 {
+				t.Errorf("%v of %v image: %v, %v", m.name, size, v, err)
+			}
+		}
+	}
+
+	a := testPattern(size, 3, 3*size.X)
+	for _, m := range qualityMetrics {
+		if _, err := m.f(a, 3*size.X, a[:len(a)-1], 3*size.X, size, 3); err == nil {
+			t.Errorf("%v: short buffer should fail", m.name)
+		}
+		if _, err := m.f(a, 3*size.X, a, 3*size.X, size, 2); err == nil {
+			t.Errorf("%v: 2 channels should fail", m.name)
+		}
+		if _, err := m.f(a, 3*size.X, a, 3*size.X, image.Point{}, 3); err == nil {
+			t.Errorf("%v: empty size should fail", m.name)
+		}
+	}
+}
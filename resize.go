@@ -1,6 +1,7 @@
 package ippresize
 
 //go:generate stringer -type=Interpolation -trimprefix Interpolation
+//go:generate stringer -type=Gravity -trimprefix Gravity
 
 /*
 #include "image.h"
@@ -9,6 +10,8 @@ package ippresize
 import "C"
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"github.com/anight/go-libjpeg/jpeg"
 	"github.com/anight/go-libjpeg/rgb"
@@ -16,6 +19,7 @@ import (
 	"io"
 	"math"
 	"runtime"
+	"strings"
 	"unsafe"
 )
 
@@ -32,6 +36,69 @@ const (
 	InterpolationAntialiasingLanczos Interpolation = C.IMAGE_INTERPOLATION_ANTIALIASING_LANCZOS
 )
 
+// matchName compares the name with the name of the constant case-insensitively, '-' and '_' in the name are ignored
+func matchName(name string, value fmt.Stringer) bool {
+	return strings.EqualFold(strings.NewReplacer("-", "", "_", "").Replace(name), value.String())
+}
+
+// ParseInterpolation returns the interpolation by its name, e.g. "lanczos" or "antialiasing-cubic"
+func ParseInterpolation(name string) (Interpolation, error) {
+	for i := InterpolationNearestNeighbour; i <= InterpolationAntialiasingLanczos; i++ {
+		if matchName(name, i) {
+			return i, nil
+		}
+	}
+	return 0, NewError(0, "unknown interpolation: %q", name)
+}
+
+// Gravity defines where the resized image is placed inside a larger output box
+type Gravity int
+
+const (
+	GravityCenter Gravity = iota
+	GravityTop
+	GravityBottom
+	GravityLeft
+	GravityRight
+	GravityTopLeft
+	GravityTopRight
+	GravityBottomLeft
+	GravityBottomRight
+	GravitySmart // crop of FitCover on the most detailed part of the image, see FitOptions.CropStrategy; center otherwise
+)
+
+// ParseGravity returns the gravity by its name, e.g. "center", "top-left" or "smart"
+func ParseGravity(name string) (Gravity, error) {
+	for g := GravityCenter; g <= GravitySmart; g++ {
+		if matchName(name, g) {
+			return g, nil
+		}
+	}
+	return 0, NewError(0, "unknown gravity: %q", name)
+}
+
+// offset returns the position of the inner rectangle inside the outer one
+func (g Gravity) offset(outer image.Point, inner image.Point) image.Point {
+	free := outer.Sub(inner)
+	p := image.Point{free.X / 2, free.Y / 2}
+
+	switch g {
+	case GravityTop, GravityTopLeft, GravityTopRight:
+		p.Y = 0
+	case GravityBottom, GravityBottomLeft, GravityBottomRight:
+		p.Y = free.Y
+	}
+
+	switch g {
+	case GravityLeft, GravityTopLeft, GravityBottomLeft:
+		p.X = 0
+	case GravityRight, GravityTopRight, GravityBottomRight:
+		p.X = free.X
+	}
+
+	return p
+}
+
 type Error struct {
 	error string
 	code  int
@@ -50,15 +117,97 @@ func (e *Error) Code() IppStatus {
 }
 
 func Decode(reader io.Reader, colorspace jpeg.OutColorSpace, bbox image.Point) (image.Image, error) {
-	decoderOptions := jpeg.DecoderOptions{
-		OutColorSpace: colorspace,
-		ScaleTarget:   image.Rectangle{Max: bbox},
-		DCTMethod:     jpeg.DCTIFast,
+	return DecodeWithOptions(reader, colorspace, bbox, nil)
+}
+
+// DecodeWithOptions works like Decode() with the given options, the image is returned as stored, exif orientation is not applied
+func DecodeWithOptions(reader io.Reader, colorspace jpeg.OutColorSpace, bbox image.Point, opts *DecodeOptions) (image.Image, error) {
+	if opts.colorManagement() {
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, err
+		}
+		return decodeManaged(data, colorspace, bbox, opts)
 	}
-	return jpeg.Decode(reader, &decoderOptions)
+	return jpeg.Decode(reader, opts.decoderOptions(colorspace, bbox))
 }
 
-func Resize(in []uint8, in_stride int, in_size image.Point, out []uint8, out_stride int, out_size image.Point, channels int, interpolation Interpolation) error {
+// decodeImage works like DecodeAny() for the encoded image data and also reports the size and the exif orientation of the original image.
+// Sizes passed to and returned from scale_target and orig_size are in display orientation,
+// while the decoded image is returned as stored in the jpeg stream.
+func decodeImage(ctx context.Context, data []byte, colorspace jpeg.OutColorSpace, scale_target func(orig_size image.Point) image.Point, opts *DecodeOptions) (im image.Image, orig_size image.Point, orientation Orientation, format ImageFormat, err error) {
+	orientation = OrientationNormal
+	format = SniffFormat(data)
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	_, span := startSpan(ctx, "decode")
+	s := startStage()
+	defer func() {
+		s.decoded(format, im, err)
+		span.SetAttribute("format", format.String())
+		setSizeAttributes(span, "source", orig_size)
+		if im != nil {
+			setSizeAttributes(span, "decoded", im.Bounds().Size())
+		}
+		span.End(err)
+	}()
+
+	if format == ImageFormatWebP {
+		orig_size, _, err = webpFeatures(data)
+		if err != nil {
+			return
+		}
+		im, err = decodeWebP(data, colorspace, opts.scaleTarget(orig_size, scale_target(orig_size)), opts)
+		return
+	}
+
+	if format != ImageFormatJPEG {
+		// other formats are decoded at full size, there is nothing like libjpeg prescaling
+		im, err = decodeNonJpeg(data, format, colorspace, opts)
+		if err == nil {
+			orig_size = im.Bounds().Size()
+		}
+		return
+	}
+
+	var config image.Config
+	config, err = jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+
+	if opts.autoOrient() {
+		orientation = exifOrientation(data)
+	}
+	orig_size = orientation.Size(image.Point{config.Width, config.Height})
+	target := opts.scaleTarget(orig_size, scale_target(orig_size))
+	// libjpeg scales the stored image, so the target must be swapped back
+	if opts.colorManagement() {
+		im, err = decodeManaged(data, colorspace, orientation.Size(target), opts)
+	} else {
+		im, err = jpeg.Decode(bytes.NewReader(data), opts.decoderOptions(colorspace, orientation.Size(target)))
+	}
+	return
+}
+
+// imagePix returns pixel data of the decoded image
+func imagePix(im image.Image) (pix []uint8, stride int, channels int, err error) {
+	switch i := im.(type) {
+	case *image.Gray:
+		return i.Pix, i.Stride, 1, nil
+	case *rgb.Image:
+		return i.Pix, i.Stride, 3, nil
+	case *image.RGBA:
+		return i.Pix, i.Stride, 4, nil
+	}
+	return nil, 0, 0, NewError(0, "unsupported color model")
+}
+
+// checkResize validates image dimensions and buffer sizes of a resize
+func checkResize(in []uint8, in_size image.Point, out []uint8, out_size image.Point, channels int) error {
 
 	if in_size.X <= 0 || in_size.Y <= 0 {
 		return NewError(0, "one of the input image dimensions is invalid: {width: %v, height: %v}", in_size.X, in_size.Y)
@@ -78,6 +227,15 @@ func Resize(in []uint8, in_stride int, in_size image.Point, out []uint8, out_str
 			out_size.X, out_size.Y, channels, len(out))
 	}
 
+	return nil
+}
+
+func Resize(in []uint8, in_stride int, in_size image.Point, out []uint8, out_stride int, out_size image.Point, channels int, interpolation Interpolation) error {
+
+	if err := checkResize(in, in_size, out, out_size, channels); err != nil {
+		return err
+	}
+
 	var img_in C.struct_image_s
 	img_in.w = C.uint(in_size.X)
 	img_in.h = C.uint(in_size.Y)
@@ -95,6 +253,8 @@ func Resize(in []uint8, in_stride int, in_size image.Point, out []uint8, out_str
 	const err_size = 1024
 	var err [err_size]C.char
 
+	s := startStage()
+
 	ret := C.image_ipp_resize(&img_in, img_in_data, &img_out, img_out_data, C.image_interpolation_t(interpolation), &err[0], err_size)
 
 	/* make 100% sure garbage collector wont kill these objects in the middle of execution of c function */
@@ -104,44 +264,59 @@ func Resize(in []uint8, in_stride int, in_size image.Point, out []uint8, out_str
 	runtime.KeepAlive(img_out_data)
 
 	if ret != 0 {
-		return NewError(int(ret), "C.image_ipp_resize() failed: %v", C.GoString(&err[0]))
+		e := NewError(int(ret), "C.image_ipp_resize() failed: %v", C.GoString(&err[0]))
+		s.resized(interpolation, in_size, out_size, e)
+		return e
 	}
 
+	s.resized(interpolation, in_size, out_size, nil)
 	return nil
 }
 
-func ReplicateBorder(in []uint8, in_stride int, in_size image.Point, channels int, src image.Rectangle) error {
+// ResizeContext works like Resize(). If the context can be cancelled the image is resized in tiles of rows
+// and the context is checked in between, its error is returned when it is done.
+func ResizeContext(ctx context.Context, in []uint8, in_stride int, in_size image.Point, out []uint8, out_stride int, out_size image.Point, channels int, interpolation Interpolation) (err error) {
+	ctx, span := startResizeSpan(ctx, in_size, out_size, channels, interpolation)
+	defer func() {
+		span.End(err)
+	}()
 
-	if in_size.X <= 0 || in_size.Y <= 0 {
-		return NewError(0, "one of the input image dimensions is invalid: {width: %v, height: %v}", in_size.X, in_size.Y)
+	if err = ctx.Err(); err != nil {
+		return
 	}
 
-	if len(in) < channels*in_size.X*in_size.Y {
-		return NewError(0, "input image buffer size doesn't match image dimensions: {width: %v, height: %v, channels: %v}, len=%v",
-			in_size.X, in_size.Y, channels, len(in))
+	if ctx.Done() == nil {
+		return Resize(in, in_stride, in_size, out, out_stride, out_size, channels, interpolation)
 	}
 
-	var img C.struct_image_s
-	img.w = C.uint(in_size.X)
-	img.h = C.uint(in_size.Y)
-	img.channels = C.uint(channels)
-	img.rowstep = C.size_t(in_stride)
-	img_data := (*C.uchar)(unsafe.Pointer(&in[0]))
+	if err = checkResize(in, in_size, out, out_size, channels); err != nil {
+		return
+	}
 
-	const err_size = 1024
-	var err [err_size]C.char
+	s := startStage()
 
-	ret := C.image_ipp_replicate_border_inplace(&img, img_data, C.uint(src.Min.X), C.uint(src.Min.Y), C.uint(src.Dx()), C.uint(src.Dy()), &err[0], err_size)
+	spec, err := createResizeSpec(resizeKey{in_size, out_size, interpolation})
+	if err == nil {
+		err = resizeWithSpec(ctx, spec, in, in_stride, in_size, out, out_stride, out_size, channels)
+		C.image_ipp_resize_spec_free(spec)
+	}
 
-	/* make 100% sure garbage collector wont kill these objects in the middle of execution of c function */
-	runtime.KeepAlive(img)
-	runtime.KeepAlive(img_data)
+	s.resized(interpolation, in_size, out_size, err)
+	return
+}
 
-	if ret != 0 {
-		return NewError(int(ret), "C.image_ipp_replicate_border_inplace() failed: %v", C.GoString(&err[0]))
-	}
+// startResizeSpan starts "resize" span with the geometry of the resize
+func startResizeSpan(ctx context.Context, in_size image.Point, out_size image.Point, channels int, interpolation Interpolation) (context.Context, Span) {
+	ctx, span := startSpan(ctx, "resize")
+	setSizeAttributes(span, "source", in_size)
+	setSizeAttributes(span, "target", out_size)
+	span.SetAttribute("channels", channels)
+	span.SetAttribute("interpolation", interpolation.String())
+	return ctx, span
+}
 
-	return nil
+func ReplicateBorder(in []uint8, in_stride int, in_size image.Point, channels int, src image.Rectangle) error {
+	return PadBorder(in, in_stride, in_size, channels, src, BorderReplicate, nil)
 }
 
 func GetProportionalLargestInnerSize(in_size image.Point, box image.Point) image.Point {
@@ -188,185 +363,502 @@ func ResizeProportional(in []uint8, in_stride int, in_size image.Point, channels
 	return out, out_size, err
 }
 
+// ResizePad resizes the image proportionally to fit into out_size_box and pads the rest of the box with the given color.
+// If transform is not nil, it receives the geometry of the operation.
+func ResizePad(in []uint8, in_stride int, in_size image.Point, channels int, out_size_box image.Point, color []uint8, gravity Gravity, interpolation Interpolation, transform *Transform) ([]uint8, image.Point, error) {
+	if len(color) != channels {
+		return nil, image.Point{}, NewError(0, "pad color doesn't match number of channels: {channels: %v}, len=%v", channels, len(color))
+	}
+	return ResizeFit(in, in_stride, in_size, channels, out_size_box, FitContain, &FitOptions{Gravity: gravity, PadColor: color}, interpolation, transform)
+}
+
 func ResizePadGray(in []uint8, in_stride int, in_size image.Point, channels int, out_size_box image.Point, interpolation Interpolation) ([]uint8, image.Point, error) {
-	out_size := out_size_box
-	target_out_size := GetProportionalLargestInnerSize(in_size, out_size_box)
-	out := make([]uint8, channels*out_size_box.X*out_size_box.Y)
-	if target_out_size.X != out_size.X || target_out_size.Y != out_size.Y {
-		for i := range out {
-			out[i] = 128
-		}
+	return ResizePad(in, in_stride, in_size, channels, out_size_box, grayColor(channels), GravityCenter, interpolation, nil)
+}
+
+// grayColor returns the pad color used by ResizePadGray() and JpegToSquare*() functions
+func grayColor(channels int) []uint8 {
+	return bytes.Repeat([]uint8{128}, channels)
+}
+
+// fillColor fills the buffer with repeated pixels of the given color
+func fillColor(buf []uint8, color []uint8) {
+	if len(buf) == 0 || len(color) == 0 {
+		return
+	}
+	n := copy(buf, color)
+	for n < len(buf) {
+		n += copy(buf[n:], buf[:n])
+	}
+}
+
+// ResizeRect resizes the src rectangle of the input image to out_size.
+// Pixels outside of src are never touched.
+// If transform is not nil, it receives the geometry of the operation on success.
+func ResizeRect(in []uint8, in_stride int, in_size image.Point, channels int, src image.Rectangle, out_size image.Point, interpolation Interpolation, transform *Transform) ([]uint8, image.Point, error) {
+	if src.Empty() || !src.In(image.Rectangle{Max: in_size}) {
+		return nil, image.Point{}, NewError(0, "source rectangle %v doesn't fit into the input image: {width: %v, height: %v}", src, in_size.X, in_size.Y)
+	}
+	if out_size.X <= 0 || out_size.Y <= 0 {
+		return nil, image.Point{}, NewError(0, "one of the output image dimensions is invalid: {width: %v, height: %v}", out_size.X, out_size.Y)
+	}
+	if channels != 1 && channels != 3 && channels != 4 {
+		return nil, image.Point{}, NewError(0, "invalid number of channels: %v", channels)
 	}
+	if in_stride < channels*in_size.X || len(in) < in_stride*(in_size.Y-1)+channels*in_size.X {
+		return nil, image.Point{}, NewError(0, "input image buffer size doesn't match image dimensions: {width: %v, height: %v, channels: %v, stride: %v}, len=%v",
+			in_size.X, in_size.Y, channels, in_stride, len(in))
+	}
+	out := make([]uint8, channels*out_size.X*out_size.Y)
 	out_rowstep := channels * out_size.X
-	target_offset := channels*int((out_size.X-target_out_size.X)/2) + out_rowstep*int((out_size.Y-target_out_size.Y)/2)
-	err := Resize(in, in_stride, in_size, out[target_offset:], out_rowstep, target_out_size, channels, interpolation)
-	return out, out_size, err
+	src_offset := channels*src.Min.X + in_stride*src.Min.Y
+	if err := Resize(in[src_offset:], in_stride, src.Size(), out, out_rowstep, out_size, channels, interpolation); err != nil {
+		return nil, image.Point{}, err
+	}
+	if transform != nil {
+		*transform = newTransform(in_size, src, image.Rectangle{Max: out_size}, out_size)
+	}
+	return out, out_size, nil
 }
 
-func JpegToRGBA(reader io.Reader, bbox image.Point, interpolation Interpolation) (pixdata []uint8, size image.Point, err error) {
-	var im image.Image
-	im, err = Decode(reader, jpeg.OutColorSpaceRGBA, bbox)
+// GetCropRect returns the largest rectangle of the input image with the aspect ratio of out_size_box,
+// placed according to gravity. Resizing it to out_size_box is the same as resizing the whole image
+// to cover the box and cropping the overflow.
+func GetCropRect(in_size image.Point, out_size_box image.Point, gravity Gravity) image.Rectangle {
+	scale := math.Max(float64(out_size_box.X)/float64(in_size.X), float64(out_size_box.Y)/float64(in_size.Y))
+
+	size := image.Point{
+		X: int(math.Round(float64(out_size_box.X) / scale)),
+		Y: int(math.Round(float64(out_size_box.Y) / scale)),
+	}
+
+	// never let rounding collapse the rectangle or push it outside of the image
+	if size.X < 1 {
+		size.X = 1
+	} else if size.X > in_size.X {
+		size.X = in_size.X
+	}
+	if size.Y < 1 {
+		size.Y = 1
+	} else if size.Y > in_size.Y {
+		size.Y = in_size.Y
+	}
+
+	pos := gravity.offset(in_size, size)
+	return image.Rectangle{pos, pos.Add(size)}
+}
+
+// ResizeCrop resizes the image proportionally to cover out_size_box and crops the overflow with the given gravity.
+// The crop is applied to the source before resizing, so the discarded pixels are never processed.
+func ResizeCrop(in []uint8, in_stride int, in_size image.Point, channels int, out_size_box image.Point, gravity Gravity, interpolation Interpolation, transform *Transform) ([]uint8, image.Point, error) {
+	return ResizeFit(in, in_stride, in_size, channels, out_size_box, FitCover, &FitOptions{Gravity: gravity}, interpolation, transform)
+}
+
+// ResizeFit resizes the image to the box according to fit and its options, see ComputeLayout().
+// Zero box dimension means it follows the aspect ratio of the image.
+// If transform is not nil, it receives the geometry of the operation.
+func ResizeFit(in []uint8, in_stride int, in_size image.Point, channels int, box image.Point, fit Fit, opts *FitOptions, interpolation Interpolation, transform *Transform) ([]uint8, image.Point, error) {
+
+	if in_size.X <= 0 || in_size.Y <= 0 {
+		return nil, image.Point{}, NewError(0, "one of the input image dimensions is invalid: {width: %v, height: %v}", in_size.X, in_size.Y)
+	}
+
+	layout, err := smartLayout(ComputeLayout(in_size, box, fit, opts), opts, in, in_stride, in_size, channels, OrientationNormal)
 	if err != nil {
-		return
+		return nil, image.Point{}, err
 	}
 
-	im_rgba := im.(*image.RGBA)
-	pixdata, size, err = ResizeProportional(im_rgba.Pix, im_rgba.Stride, im_rgba.Bounds().Max, 4, bbox, interpolation)
-	return
+	var color []uint8
+	if opts != nil {
+		color = opts.PadColor
+	}
+
+	out, err := resizeLayout(context.Background(), nil, in, in_stride, in_size, channels, layout, color, OrientationNormal, interpolation)
+	if out == nil {
+		return nil, image.Point{}, err
+	}
+	if transform != nil {
+		*transform = newTransform(in_size, layout.Src, layout.Dst, layout.Size)
+	}
+	return out, layout.Size, err
 }
 
-func JpegToRGB(reader io.Reader, bbox image.Point, interpolation Interpolation) (pixdata []uint8, size image.Point, err error) {
+// resizeLayout resizes the input image according to the layout and applies the orientation to the result.
+// The layout is in display orientation, in_size is the size of the image as stored.
+// The padding is filled with color, gray if it is empty. Resize specifications are cached by the resizer unless it is nil.
+func resizeLayout(ctx context.Context, resizer *Resizer, in []uint8, in_stride int, in_size image.Point, channels int, layout Layout, color []uint8, orientation Orientation, interpolation Interpolation) ([]uint8, error) {
+
+	if layout.Size.X <= 0 || layout.Size.Y <= 0 {
+		return nil, NewError(0, "one of the output image dimensions is invalid: {width: %v, height: %v}", layout.Size.X, layout.Size.Y)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]uint8, channels*layout.Size.X*layout.Size.Y)
+
+	if layout.Padded() {
+		if len(color) == 0 {
+			color = grayColor(channels)
+		}
+		if len(color) != channels {
+			return nil, NewError(0, "pad color doesn't match number of channels: {channels: %v}, len=%v", channels, len(color))
+		}
+		fillColor(out, color)
+	}
+
+	out_rowstep := channels * layout.Size.X
+	dst_offset := channels*layout.Dst.Min.X + out_rowstep*layout.Dst.Min.Y
+
+	if orientation == OrientationNormal {
+		src_offset := channels*layout.Src.Min.X + in_stride*layout.Src.Min.Y
+		err := resizer.ResizeContext(ctx, in[src_offset:], in_stride, layout.Src.Size(), out[dst_offset:], out_rowstep, layout.Dst.Size(), channels, interpolation)
+		return out, err
+	}
+
+	// resize in stored orientation and orient the smaller resized block into place
+	src := orientation.Inverse().Rect(layout.Src, orientation.Size(in_size))
+	block_size := orientation.Inverse().Size(layout.Dst.Size())
+	block_rowstep := channels * block_size.X
+	block := make([]uint8, block_rowstep*block_size.Y)
+
+	src_offset := channels*src.Min.X + in_stride*src.Min.Y
+	err := resizer.ResizeContext(ctx, in[src_offset:], in_stride, src.Size(), block, block_rowstep, block_size, channels, interpolation)
+	if err != nil {
+		return out, err
+	}
+
+	err = orient(block, block_rowstep, block_size, out[dst_offset:], out_rowstep, channels, orientation)
+	return out, err
+}
+
+// decodeToLayout decodes the image at the scale target and resizes it according to the layout,
+// both computed in display orientation, and applies the exif orientation. The fit options give the pad color
+// and the smart crop.
+func decodeToLayout(ctx context.Context, reader io.Reader, colorspace jpeg.OutColorSpace, scale_target func(orig_size image.Point) image.Point, layout_func func(orig_size image.Point, decoded_size image.Point) Layout, fit_opts *FitOptions, interpolation Interpolation, transform *Transform, decode_opts *DecodeOptions) (pixdata []uint8, size image.Point, format ImageFormat, err error) {
+	var data []byte
+	data, err = io.ReadAll(reader)
+	if err != nil {
+		return
+	}
+
 	var im image.Image
-	im, err = Decode(reader, jpeg.OutColorSpaceRGB, bbox)
+	var orig_size image.Point
+	var orientation Orientation
+	im, orig_size, orientation, format, err = decodeImage(ctx, data, colorspace, scale_target, decode_opts)
+	if err != nil {
+		return
+	}
+
+	pix, stride, channels, err := imagePix(im)
+	if err != nil {
+		return
+	}
+
+	in_size := im.Bounds().Size()
+	decoded_size := orientation.Size(in_size)
+	var layout Layout
+	layout, err = smartLayout(layout_func(orig_size, decoded_size), fit_opts, pix, stride, in_size, channels, orientation)
 	if err != nil {
 		return
 	}
 
-	im_rgb := im.(*rgb.Image)
-	pixdata, size, err = ResizeProportional(im_rgb.Pix, im_rgb.Stride, im_rgb.Bounds().Max, 3, bbox, interpolation)
+	pixdata, err = resizeLayout(ctx, nil, pix, stride, in_size, channels, layout, fit_opts.PadColor, orientation, interpolation)
+	if pixdata == nil {
+		return
+	}
+	size = layout.Size
+	if transform != nil {
+		*transform = newTransform(decoded_size, layout.Src, layout.Dst, layout.Size)
+		transform.Orientation = orientation
+		transform.rebase(orig_size)
+	}
+	return
+}
+
+// JpegTo*Context() functions work like the JpegTo*() ones, they stop with the error of the context when it is done
+// and decode with decode_opts, nil means the defaults. See ThumbnailContext() for the options not covered by them.
+func JpegToRGBA(reader io.Reader, bbox image.Point, interpolation Interpolation) (pixdata []uint8, size image.Point, err error) {
+	return JpegToRGBAContext(context.Background(), reader, bbox, interpolation, nil)
+}
+
+func JpegToRGBAContext(ctx context.Context, reader io.Reader, bbox image.Point, interpolation Interpolation, decode_opts *DecodeOptions) (pixdata []uint8, size image.Point, err error) {
+	var r *Result
+	r, err = ThumbnailContext(ctx, reader, WithFormat(PixelFormatRGBA), WithSize(bbox), withProportional(), WithInterpolation(interpolation), WithDecodeOptions(decode_opts))
+	if r != nil {
+		pixdata, size = r.Pix, r.Size
+	}
+	return
+}
+
+func JpegToRGB(reader io.Reader, bbox image.Point, interpolation Interpolation) (pixdata []uint8, size image.Point, err error) {
+	return JpegToRGBContext(context.Background(), reader, bbox, interpolation, nil)
+}
+
+func JpegToRGBContext(ctx context.Context, reader io.Reader, bbox image.Point, interpolation Interpolation, decode_opts *DecodeOptions) (pixdata []uint8, size image.Point, err error) {
+	var r *Result
+	r, err = ThumbnailContext(ctx, reader, WithFormat(PixelFormatRGB), WithSize(bbox), withProportional(), WithInterpolation(interpolation), WithDecodeOptions(decode_opts))
+	if r != nil {
+		pixdata, size = r.Pix, r.Size
+	}
 	return
 }
 
 func JpegToGray(reader io.Reader, bbox image.Point, interpolation Interpolation) (pixdata []uint8, size image.Point, err error) {
-	var im image.Image
-	im, err = Decode(reader, jpeg.OutColorSpaceGray, bbox)
-	if err != nil {
-		return
+	return JpegToGrayContext(context.Background(), reader, bbox, interpolation, nil)
+}
+
+func JpegToGrayContext(ctx context.Context, reader io.Reader, bbox image.Point, interpolation Interpolation, decode_opts *DecodeOptions) (pixdata []uint8, size image.Point, err error) {
+	var r *Result
+	r, err = ThumbnailContext(ctx, reader, WithFormat(PixelFormatGray), WithSize(bbox), withProportional(), WithInterpolation(interpolation), WithDecodeOptions(decode_opts))
+	if r != nil {
+		pixdata, size = r.Pix, r.Size
 	}
+	return
+}
 
-	im_gray := im.(*image.Gray)
-	pixdata, size, err = ResizeProportional(im_gray.Pix, im_gray.Stride, im_gray.Bounds().Max, 1, bbox, interpolation)
+func JpegToFitRGBA(reader io.Reader, box image.Point, fit Fit, opts *FitOptions, interpolation Interpolation, transform *Transform) (pixdata []uint8, size image.Point, err error) {
+	return JpegToFitRGBAContext(context.Background(), reader, box, fit, opts, interpolation, transform, nil)
+}
+
+func JpegToFitRGBAContext(ctx context.Context, reader io.Reader, box image.Point, fit Fit, opts *FitOptions, interpolation Interpolation, transform *Transform, decode_opts *DecodeOptions) (pixdata []uint8, size image.Point, err error) {
+	var r *Result
+	r, err = ThumbnailContext(ctx, reader, WithFormat(PixelFormatRGBA), WithSize(box), WithFit(fit), withFitOptions(opts), WithInterpolation(interpolation), WithDecodeOptions(decode_opts))
+	if r != nil {
+		pixdata, size = r.Pix, r.Size
+		if transform != nil {
+			*transform = r.Transform
+		}
+	}
 	return
 }
 
-func JpegToSquareRGBA(reader io.Reader, sqsize int, interpolation Interpolation) (pixdata []uint8, err error) {
-	bbox := image.Point{sqsize, sqsize}
-	var im image.Image
-	im, err = Decode(reader, jpeg.OutColorSpaceRGBA, bbox)
-	if err != nil {
-		return
+func JpegToFitRGB(reader io.Reader, box image.Point, fit Fit, opts *FitOptions, interpolation Interpolation, transform *Transform) (pixdata []uint8, size image.Point, err error) {
+	return JpegToFitRGBContext(context.Background(), reader, box, fit, opts, interpolation, transform, nil)
+}
+
+func JpegToFitRGBContext(ctx context.Context, reader io.Reader, box image.Point, fit Fit, opts *FitOptions, interpolation Interpolation, transform *Transform, decode_opts *DecodeOptions) (pixdata []uint8, size image.Point, err error) {
+	var r *Result
+	r, err = ThumbnailContext(ctx, reader, WithFormat(PixelFormatRGB), WithSize(box), WithFit(fit), withFitOptions(opts), WithInterpolation(interpolation), WithDecodeOptions(decode_opts))
+	if r != nil {
+		pixdata, size = r.Pix, r.Size
+		if transform != nil {
+			*transform = r.Transform
+		}
 	}
+	return
+}
+
+func JpegToFitGray(reader io.Reader, box image.Point, fit Fit, opts *FitOptions, interpolation Interpolation, transform *Transform) (pixdata []uint8, size image.Point, err error) {
+	return JpegToFitGrayContext(context.Background(), reader, box, fit, opts, interpolation, transform, nil)
+}
 
-	im_rgba := im.(*image.RGBA)
-	pixdata, _, err = ResizePadGray(im_rgba.Pix, im_rgba.Stride, im_rgba.Bounds().Max, 4, bbox, interpolation)
+func JpegToFitGrayContext(ctx context.Context, reader io.Reader, box image.Point, fit Fit, opts *FitOptions, interpolation Interpolation, transform *Transform, decode_opts *DecodeOptions) (pixdata []uint8, size image.Point, err error) {
+	var r *Result
+	r, err = ThumbnailContext(ctx, reader, WithFormat(PixelFormatGray), WithSize(box), WithFit(fit), withFitOptions(opts), WithInterpolation(interpolation), WithDecodeOptions(decode_opts))
+	if r != nil {
+		pixdata, size = r.Pix, r.Size
+		if transform != nil {
+			*transform = r.Transform
+		}
+	}
 	return
 }
 
-func JpegToSquareRGB(reader io.Reader, sqsize int, interpolation Interpolation) (pixdata []uint8, err error) {
-	bbox := image.Point{sqsize, sqsize}
-	var im image.Image
-	im, err = Decode(reader, jpeg.OutColorSpaceRGB, bbox)
-	if err != nil {
-		return
+func JpegToPaddedRGBA(reader io.Reader, bbox image.Point, color []uint8, gravity Gravity, interpolation Interpolation, transform *Transform) (pixdata []uint8, err error) {
+	return JpegToPaddedRGBAContext(context.Background(), reader, bbox, color, gravity, interpolation, transform, nil)
+}
+
+func JpegToPaddedRGBAContext(ctx context.Context, reader io.Reader, bbox image.Point, color []uint8, gravity Gravity, interpolation Interpolation, transform *Transform, decode_opts *DecodeOptions) (pixdata []uint8, err error) {
+	if len(color) != 4 {
+		return nil, NewError(0, "pad color doesn't match number of channels: {channels: %v}, len=%v", 4, len(color))
 	}
+	pixdata, _, err = JpegToFitRGBAContext(ctx, reader, bbox, FitContain, &FitOptions{Gravity: gravity, PadColor: color}, interpolation, transform, decode_opts)
+	return
+}
 
-	im_rgb := im.(*rgb.Image)
-	pixdata, _, err = ResizePadGray(im_rgb.Pix, im_rgb.Stride, im_rgb.Bounds().Max, 3, bbox, interpolation)
+func JpegToPaddedRGB(reader io.Reader, bbox image.Point, color []uint8, gravity Gravity, interpolation Interpolation, transform *Transform) (pixdata []uint8, err error) {
+	return JpegToPaddedRGBContext(context.Background(), reader, bbox, color, gravity, interpolation, transform, nil)
+}
+
+func JpegToPaddedRGBContext(ctx context.Context, reader io.Reader, bbox image.Point, color []uint8, gravity Gravity, interpolation Interpolation, transform *Transform, decode_opts *DecodeOptions) (pixdata []uint8, err error) {
+	if len(color) != 3 {
+		return nil, NewError(0, "pad color doesn't match number of channels: {channels: %v}, len=%v", 3, len(color))
+	}
+	pixdata, _, err = JpegToFitRGBContext(ctx, reader, bbox, FitContain, &FitOptions{Gravity: gravity, PadColor: color}, interpolation, transform, decode_opts)
 	return
 }
 
-func JpegToSquareGray(reader io.Reader, sqsize int, interpolation Interpolation) (pixdata []uint8, err error) {
-	bbox := image.Point{sqsize, sqsize}
-	var im image.Image
-	im, err = Decode(reader, jpeg.OutColorSpaceGray, bbox)
-	if err != nil {
-		return
+func JpegToPaddedGray(reader io.Reader, bbox image.Point, color []uint8, gravity Gravity, interpolation Interpolation, transform *Transform) (pixdata []uint8, err error) {
+	return JpegToPaddedGrayContext(context.Background(), reader, bbox, color, gravity, interpolation, transform, nil)
+}
+
+func JpegToPaddedGrayContext(ctx context.Context, reader io.Reader, bbox image.Point, color []uint8, gravity Gravity, interpolation Interpolation, transform *Transform, decode_opts *DecodeOptions) (pixdata []uint8, err error) {
+	if len(color) != 1 {
+		return nil, NewError(0, "pad color doesn't match number of channels: {channels: %v}, len=%v", 1, len(color))
 	}
+	pixdata, _, err = JpegToFitGrayContext(ctx, reader, bbox, FitContain, &FitOptions{Gravity: gravity, PadColor: color}, interpolation, transform, decode_opts)
+	return
+}
+
+func JpegToCroppedRGBA(reader io.Reader, bbox image.Point, gravity Gravity, interpolation Interpolation, transform *Transform) (pixdata []uint8, err error) {
+	return JpegToCroppedRGBAContext(context.Background(), reader, bbox, gravity, interpolation, transform, nil)
+}
+
+func JpegToCroppedRGBAContext(ctx context.Context, reader io.Reader, bbox image.Point, gravity Gravity, interpolation Interpolation, transform *Transform, decode_opts *DecodeOptions) (pixdata []uint8, err error) {
+	pixdata, _, err = JpegToFitRGBAContext(ctx, reader, bbox, FitCover, &FitOptions{Gravity: gravity}, interpolation, transform, decode_opts)
+	return
+}
+
+func JpegToCroppedRGB(reader io.Reader, bbox image.Point, gravity Gravity, interpolation Interpolation, transform *Transform) (pixdata []uint8, err error) {
+	return JpegToCroppedRGBContext(context.Background(), reader, bbox, gravity, interpolation, transform, nil)
+}
 
-	im_gray := im.(*image.Gray)
-	pixdata, _, err = ResizePadGray(im_gray.Pix, im_gray.Stride, im_gray.Bounds().Max, 1, bbox, interpolation)
+func JpegToCroppedRGBContext(ctx context.Context, reader io.Reader, bbox image.Point, gravity Gravity, interpolation Interpolation, transform *Transform, decode_opts *DecodeOptions) (pixdata []uint8, err error) {
+	pixdata, _, err = JpegToFitRGBContext(ctx, reader, bbox, FitCover, &FitOptions{Gravity: gravity}, interpolation, transform, decode_opts)
 	return
 }
 
+func JpegToCroppedGray(reader io.Reader, bbox image.Point, gravity Gravity, interpolation Interpolation, transform *Transform) (pixdata []uint8, err error) {
+	return JpegToCroppedGrayContext(context.Background(), reader, bbox, gravity, interpolation, transform, nil)
+}
+
+func JpegToCroppedGrayContext(ctx context.Context, reader io.Reader, bbox image.Point, gravity Gravity, interpolation Interpolation, transform *Transform, decode_opts *DecodeOptions) (pixdata []uint8, err error) {
+	pixdata, _, err = JpegToFitGrayContext(ctx, reader, bbox, FitCover, &FitOptions{Gravity: gravity}, interpolation, transform, decode_opts)
+	return
+}
+
+func JpegToSquareRGBA(reader io.Reader, sqsize int, interpolation Interpolation) (pixdata []uint8, err error) {
+	return JpegToSquareRGBAContext(context.Background(), reader, sqsize, interpolation, nil)
+}
+
+func JpegToSquareRGBAContext(ctx context.Context, reader io.Reader, sqsize int, interpolation Interpolation, decode_opts *DecodeOptions) (pixdata []uint8, err error) {
+	return JpegToPaddedRGBAContext(ctx, reader, image.Point{sqsize, sqsize}, grayColor(4), GravityCenter, interpolation, nil, decode_opts)
+}
+
+func JpegToSquareRGB(reader io.Reader, sqsize int, interpolation Interpolation) (pixdata []uint8, err error) {
+	return JpegToSquareRGBContext(context.Background(), reader, sqsize, interpolation, nil)
+}
+
+func JpegToSquareRGBContext(ctx context.Context, reader io.Reader, sqsize int, interpolation Interpolation, decode_opts *DecodeOptions) (pixdata []uint8, err error) {
+	return JpegToPaddedRGBContext(ctx, reader, image.Point{sqsize, sqsize}, grayColor(3), GravityCenter, interpolation, nil, decode_opts)
+}
+
+func JpegToSquareGray(reader io.Reader, sqsize int, interpolation Interpolation) (pixdata []uint8, err error) {
+	return JpegToSquareGrayContext(context.Background(), reader, sqsize, interpolation, nil)
+}
+
+func JpegToSquareGrayContext(ctx context.Context, reader io.Reader, sqsize int, interpolation Interpolation, decode_opts *DecodeOptions) (pixdata []uint8, err error) {
+	return JpegToPaddedGrayContext(ctx, reader, image.Point{sqsize, sqsize}, grayColor(1), GravityCenter, interpolation, nil, decode_opts)
+}
+
 func JpegToRGBAImage(reader io.Reader, bbox image.Point, interpolation Interpolation) (im image.Image, err error) {
-	var pixdata []uint8
-	var size image.Point
-	pixdata, size, err = JpegToRGBA(reader, bbox, interpolation)
+	return JpegToRGBAImageContext(context.Background(), reader, bbox, interpolation, nil)
+}
+
+func JpegToRGBAImageContext(ctx context.Context, reader io.Reader, bbox image.Point, interpolation Interpolation, decode_opts *DecodeOptions) (im image.Image, err error) {
+	var r *Result
+	r, err = ThumbnailContext(ctx, reader, WithFormat(PixelFormatRGBA), WithSize(bbox), withProportional(), WithInterpolation(interpolation), WithDecodeOptions(decode_opts))
 	if err == nil {
-		im = &image.RGBA{
-			Pix:    pixdata,
-			Stride: size.X * 4,
-			Rect:   image.Rectangle{Max: size},
-		}
+		im = r.Image()
 	}
 	return
 }
 
 func JpegToRGBImage(reader io.Reader, bbox image.Point, interpolation Interpolation) (im image.Image, err error) {
-	var pixdata []uint8
-	var size image.Point
-	pixdata, size, err = JpegToRGB(reader, bbox, interpolation)
+	return JpegToRGBImageContext(context.Background(), reader, bbox, interpolation, nil)
+}
+
+func JpegToRGBImageContext(ctx context.Context, reader io.Reader, bbox image.Point, interpolation Interpolation, decode_opts *DecodeOptions) (im image.Image, err error) {
+	var r *Result
+	r, err = ThumbnailContext(ctx, reader, WithFormat(PixelFormatRGB), WithSize(bbox), withProportional(), WithInterpolation(interpolation), WithDecodeOptions(decode_opts))
 	if err == nil {
-		im = &rgb.Image{
-			Pix:    pixdata,
-			Stride: size.X * 3,
-			Rect:   image.Rectangle{Max: size},
-		}
+		im = r.Image()
 	}
 	return
 }
 
 func JpegToGrayImage(reader io.Reader, bbox image.Point, interpolation Interpolation) (im image.Image, err error) {
-	var pixdata []uint8
-	var size image.Point
-	pixdata, size, err = JpegToGray(reader, bbox, interpolation)
+	return JpegToGrayImageContext(context.Background(), reader, bbox, interpolation, nil)
+}
+
+func JpegToGrayImageContext(ctx context.Context, reader io.Reader, bbox image.Point, interpolation Interpolation, decode_opts *DecodeOptions) (im image.Image, err error) {
+	var r *Result
+	r, err = ThumbnailContext(ctx, reader, WithFormat(PixelFormatGray), WithSize(bbox), withProportional(), WithInterpolation(interpolation), WithDecodeOptions(decode_opts))
 	if err == nil {
-		im = &image.Gray{
-			Pix:    pixdata,
-			Stride: size.X * 1,
-			Rect:   image.Rectangle{Max: size},
-		}
+		im = r.Image()
 	}
 	return
 }
 
 func JpegToImage(reader io.Reader, bbox image.Point, interpolation Interpolation) (im image.Image, err error) {
-	im, err = Decode(reader, jpeg.OutColorSpaceSame, bbox)
+	return JpegToImageContext(context.Background(), reader, bbox, interpolation, nil)
+}
+
+func JpegToImageContext(ctx context.Context, reader io.Reader, bbox image.Point, interpolation Interpolation, decode_opts *DecodeOptions) (im image.Image, err error) {
+	var data []byte
+	data, err = io.ReadAll(reader)
 	if err != nil {
 		return
 	}
 
-	size := GetProportionalLargestInnerSize(im.Bounds().Max, bbox)
+	var orientation Orientation
+	im, _, orientation, _, err = decodeImage(ctx, data, jpeg.OutColorSpaceSame, func(orig_size image.Point) image.Point {
+		return bbox
+	}, decode_opts)
+	if err != nil {
+		return
+	}
+
+	// resize in stored orientation, then orient the smaller resized image
+	size := orientation.Size(GetProportionalLargestInnerSize(orientation.Size(im.Bounds().Max), bbox))
 
 	switch i := im.(type) {
 	case *image.Gray:
-		im, err = ResizeGray(i, size, interpolation)
+		im, err = resizeGray(ctx, i, size, interpolation)
 	case *image.YCbCr:
-		im, err = ResizeLimitedYCbCr(i, size, interpolation)
+		im, err = resizeLimitedYCbCr(ctx, i, size, interpolation)
+	case *rgb.Image:
+		resized := &rgb.Image{Pix: make([]uint8, 3*size.X*size.Y), Stride: 3 * size.X, Rect: image.Rectangle{Max: size}}
+		err = ResizeContext(ctx, i.Pix, i.Stride, i.Bounds().Size(), resized.Pix, resized.Stride, size, 3, interpolation)
+		im = resized
+	case *image.RGBA:
+		resized := image.NewRGBA(image.Rectangle{Max: size})
+		err = ResizeContext(ctx, i.Pix, i.Stride, i.Bounds().Size(), resized.Pix, resized.Stride, size, 4, interpolation)
+		im = resized
 	default:
 		err = NewError(0, "unsupported color model")
 	}
 
+	if err != nil {
+		return
+	}
+
+	im, err = OrientImage(im, orientation)
 	return
 }
 
 func ResizeGray(gray *image.Gray, size image.Point, interpolation Interpolation) (resized *image.Gray, err error) {
+	return resizeGray(context.Background(), gray, size, interpolation)
+}
+
+func resizeGray(ctx context.Context, gray *image.Gray, size image.Point, interpolation Interpolation) (resized *image.Gray, err error) {
 	resized = image.NewGray(image.Rectangle{Max: size})
-	err = Resize(gray.Pix, gray.Stride, image.Point{gray.Bounds().Dx(), gray.Bounds().Dy()}, resized.Pix, resized.Stride, resized.Rect.Max, 1, interpolation)
+	err = ResizeContext(ctx, gray.Pix, gray.Stride, image.Point{gray.Bounds().Dx(), gray.Bounds().Dy()}, resized.Pix, resized.Stride, resized.Rect.Max, 1, interpolation)
 	return
 }
 
 func ResizeLimitedYCbCr(ycbcr *image.YCbCr, size image.Point, interpolation Interpolation) (resized *image.YCbCr, err error) {
+	return resizeLimitedYCbCr(context.Background(), ycbcr, size, interpolation)
+}
+
+func resizeLimitedYCbCr(ctx context.Context, ycbcr *image.YCbCr, size image.Point, interpolation Interpolation) (resized *image.YCbCr, err error) {
 
 	// IPP has no support for images with Y, Cb and Cr separate planes which is a standard golang representation
 	// of the most common jpeg image format so we have to resize each plane individually
 
-	var downresW, downresH int
-
-	switch ycbcr.SubsampleRatio {
-	case image.YCbCrSubsampleRatio444:
-		downresW, downresH = 1, 1
-	case image.YCbCrSubsampleRatio422:
-		downresW, downresH = 2, 1
-	case image.YCbCrSubsampleRatio420:
-		downresW, downresH = 2, 2
-	case image.YCbCrSubsampleRatio440:
-		downresW, downresH = 1, 2
-	case image.YCbCrSubsampleRatio411:
-		downresW, downresH = 4, 1
-	case image.YCbCrSubsampleRatio410:
-		downresW, downresH = 4, 2
-	}
+	downresW, downresH := subsampleFactors(ycbcr.SubsampleRatio)
 
 	// log.Printf("%v -> %v, %v (h%vv%v)", ycbcr.Rect.Max, size, ycbcr.SubsampleRatio, downresW, downresH)
 
@@ -390,23 +882,51 @@ func ResizeLimitedYCbCr(ycbcr *image.YCbCr, size image.Point, interpolation Inte
 
 	resized = image.NewYCbCr(image.Rectangle{Max: size}, ycbcr.SubsampleRatio)
 
-	err = Resize(ycbcr.Y, ycbcr.YStride, image.Point{ycbcr.Bounds().Dx(), ycbcr.Bounds().Dy()}, resized.Y, resized.YStride, size, 1, interpolation)
+	err = ResizeContext(ctx, ycbcr.Y, ycbcr.YStride, image.Point{ycbcr.Bounds().Dx(), ycbcr.Bounds().Dy()}, resized.Y, resized.YStride, size, 1, interpolation)
 
 	if err != nil {
 		return
 	}
 
-	err = Resize(ycbcr.Cb, ycbcr.CStride, image.Point{ycbcr.Bounds().Dx() / downresW, ycbcr.Bounds().Dy() / downresH}, resized.Cb, resized.CStride, image.Point{size.X / downresW, size.Y / downresH}, 1, interpolation)
+	err = ResizeContext(ctx, ycbcr.Cb, ycbcr.CStride, image.Point{ycbcr.Bounds().Dx() / downresW, ycbcr.Bounds().Dy() / downresH}, resized.Cb, resized.CStride, image.Point{size.X / downresW, size.Y / downresH}, 1, interpolation)
 
 	if err != nil {
 		return
 	}
 
-	err = Resize(ycbcr.Cr, ycbcr.CStride, image.Point{ycbcr.Bounds().Dx() / downresW, ycbcr.Bounds().Dy() / downresH}, resized.Cr, resized.CStride, image.Point{size.X / downresW, size.Y / downresH}, 1, interpolation)
+	err = ResizeContext(ctx, ycbcr.Cr, ycbcr.CStride, image.Point{ycbcr.Bounds().Dx() / downresW, ycbcr.Bounds().Dy() / downresH}, resized.Cr, resized.CStride, image.Point{size.X / downresW, size.Y / downresH}, 1, interpolation)
 
 	return
 }
 
+// subsampleFactors returns how many luma pixels share one chroma pixel horizontally and vertically
+func subsampleFactors(ratio image.YCbCrSubsampleRatio) (int, int) {
+	switch ratio {
+	case image.YCbCrSubsampleRatio422:
+		return 2, 1
+	case image.YCbCrSubsampleRatio420:
+		return 2, 2
+	case image.YCbCrSubsampleRatio440:
+		return 1, 2
+	case image.YCbCrSubsampleRatio411:
+		return 4, 1
+	case image.YCbCrSubsampleRatio410:
+		return 4, 2
+	}
+	return 1, 1
+}
+
+var backendVersion string
+
+// BackendVersion returns the name and version of the IPP library used for resizing
+func BackendVersion() string {
+	return backendVersion
+}
+
 func init() {
 	C.image_init()
+
+	var buf [256]C.char
+	C.image_ipp_version(&buf[0], C.size_t(len(buf)))
+	backendVersion = C.GoString(&buf[0])
 }
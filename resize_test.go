@@ -2,12 +2,18 @@ package ippresize
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"flag"
 	"github.com/anight/go-libjpeg/rgb"
 	"image"
+	"image/color"
 	"image/png"
 	"io"
 	"os"
+	"path/filepath"
 	"reflect"
+	"sync/atomic"
 	"testing"
 )
 
@@ -22,7 +28,74 @@ var allInterpolations = [...]Interpolation{
 	InterpolationAntialiasingLanczos,
 }
 
-func testResizeInterpolation(t *testing.T, interpolation Interpolation, channels int, im_type reflect.Type, resize func(io.Reader, image.Point, Interpolation) ([]uint8, image.Point, error)) {
+var update = flag.Bool("update", false, "write the golden images of the resize tests to testdata")
+
+// goldenPath returns the golden image of the proportional resize of test.jpg to 224x224 with the interpolation,
+// gray images have their own
+func goldenPath(interpolation Interpolation, channels int) string {
+	name := "resize-" + interpolation.String()
+	if channels == 1 {
+		name += "-gray"
+	}
+	return filepath.Join("testdata", name+".png")
+}
+
+// goldenResize returns the pixels of the golden image in the channels, with -update it is written from im_data first
+func goldenResize(t *testing.T, interpolation Interpolation, channels int, im_data []uint8, im_size image.Point) []uint8 {
+	path := goldenPath(interpolation, channels)
+
+	if *update {
+		rect := image.Rectangle{Max: im_size}
+		var im image.Image
+		switch channels {
+		case 1:
+			im = &image.Gray{Pix: im_data, Stride: im_size.X, Rect: rect}
+		case 3:
+			im = &rgb.Image{Pix: im_data, Stride: 3 * im_size.X, Rect: rect}
+		case 4:
+			im = &image.RGBA{Pix: im_data, Stride: 4 * im_size.X, Rect: rect}
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, im); err != nil {
+			t.Fatalf("png.Encode() failed: %v", err)
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0666); err != nil {
+			t.Fatalf("os.WriteFile() failed: %v", err)
+		}
+	}
+
+	reader, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("os.Open() failed: %v, run the tests with -update to write the golden images", err)
+	}
+	defer reader.Close()
+
+	src, err := png.Decode(reader)
+	if err != nil {
+		t.Fatalf("png.Decode() failed: %v", err)
+	}
+	if src.Bounds().Size() != im_size {
+		t.Fatalf("%v: the golden image is %v, the resize is %v", interpolation, src.Bounds().Size(), im_size)
+	}
+
+	out := make([]uint8, 0, im_size.X*im_size.Y*channels)
+	for y := 0; y < im_size.Y; y++ {
+		for x := 0; x < im_size.X; x++ {
+			c := color.RGBAModel.Convert(src.At(x, y)).(color.RGBA)
+			switch channels {
+			case 1:
+				out = append(out, c.R)
+			case 3:
+				out = append(out, c.R, c.G, c.B)
+			case 4:
+				out = append(out, c.R, c.G, c.B, c.A)
+			}
+		}
+	}
+	return out
+}
+
+func testResizeInterpolation(t *testing.T, interpolation Interpolation, channels int, im_type reflect.Type, resize func(io.Reader, image.Point, Interpolation) ([]uint8, image.Point, error)) ([]uint8, image.Point) {
 	reader, err := os.Open("./test.jpg")
 	if err != nil {
 		t.Fatalf("os.Open() failed: %v", err)
@@ -53,6 +126,8 @@ func testResizeInterpolation(t *testing.T, interpolation Interpolation, channels
 	if err := png.Encode(writer, im.Interface().(image.Image)); err != nil {
 		t.Fatalf("png.Encode() failed: %v", err)
 	}
+
+	return im_data, im_size
 }
 
 func testResize(t *testing.T, channels int, im_type reflect.Type, resize func(io.Reader, image.Point, Interpolation) ([]uint8, image.Point, error)) {
@@ -85,16 +160,84 @@ func TestSquareGray(t *testing.T) {
 	})
 }
 
+func TestPaddedRGBA(t *testing.T) {
+	testResize(t, 4, reflect.TypeOf(image.RGBA{}), func(reader io.Reader, size image.Point, interpolation Interpolation) ([]uint8, image.Point, error) {
+		box := image.Point{size.X, size.Y / 2}
+		im_data, err := JpegToPaddedRGBA(reader, box, []uint8{0, 0, 0, 0}, GravityTopLeft, interpolation, nil)
+		return im_data, box, err
+	})
+}
+
+func TestPaddedRGB(t *testing.T) {
+	testResize(t, 3, reflect.TypeOf(rgb.Image{}), func(reader io.Reader, size image.Point, interpolation Interpolation) ([]uint8, image.Point, error) {
+		box := image.Point{size.X / 2, size.Y}
+		im_data, err := JpegToPaddedRGB(reader, box, []uint8{114, 114, 114}, GravityBottomRight, interpolation, nil)
+		return im_data, box, err
+	})
+}
+
+func TestCroppedRGBA(t *testing.T) {
+	testResize(t, 4, reflect.TypeOf(image.RGBA{}), func(reader io.Reader, size image.Point, interpolation Interpolation) ([]uint8, image.Point, error) {
+		box := image.Point{size.X, size.Y / 2}
+		im_data, err := JpegToCroppedRGBA(reader, box, GravityCenter, interpolation, nil)
+		return im_data, box, err
+	})
+}
+
+func TestCroppedGray(t *testing.T) {
+	testResize(t, 1, reflect.TypeOf(image.Gray{}), func(reader io.Reader, size image.Point, interpolation Interpolation) ([]uint8, image.Point, error) {
+		box := image.Point{size.X / 2, size.Y}
+		im_data, err := JpegToCroppedGray(reader, box, GravityTop, interpolation, nil)
+		return im_data, box, err
+	})
+}
+
+// goldenBounds are the lowest PSNR and SSIM to the golden images by interpolation, they allow for rounding
+// differences of IPP and libjpeg versions, the filters with more arithmetics get more slack
+var goldenBounds = map[Interpolation]struct {
+	psnr float64
+	ssim float64
+}{
+	InterpolationNearestNeighbour:    {60, 0.999},
+	InterpolationLinear:              {50, 0.998},
+	InterpolationSuper:               {50, 0.998},
+	InterpolationCubic:               {48, 0.997},
+	InterpolationLanczos:             {46, 0.995},
+	InterpolationAntialiasingLinear:  {46, 0.995},
+	InterpolationAntialiasingCubic:   {46, 0.995},
+	InterpolationAntialiasingLanczos: {46, 0.995},
+}
+
+// testResizeGolden checks proportional resizes of the whole test.jpg match the golden images
+func testResizeGolden(t *testing.T, channels int, im_type reflect.Type, resize func(io.Reader, image.Point, Interpolation) ([]uint8, image.Point, error)) {
+	for _, interpolation := range allInterpolations {
+		im_data, im_size := testResizeInterpolation(t, interpolation, channels, im_type, resize)
+		golden := goldenResize(t, interpolation, channels, im_data, im_size)
+
+		psnr, err := PSNR(im_data, im_size.X*channels, golden, im_size.X*channels, im_size, channels)
+		if err != nil {
+			t.Fatalf("PSNR() failed: %v", err)
+		}
+		ssim, err := SSIM(im_data, im_size.X*channels, golden, im_size.X*channels, im_size, channels)
+		if err != nil {
+			t.Fatalf("SSIM() failed: %v", err)
+		}
+		if b := goldenBounds[interpolation]; psnr < b.psnr || ssim < b.ssim {
+			t.Errorf("%v: too far from the golden image: PSNR %.2f dB, SSIM %.4f, expected at least %v dB, %v", interpolation, psnr, ssim, b.psnr, b.ssim)
+		}
+	}
+}
+
 func TestRGBA(t *testing.T) {
-	testResize(t, 4, reflect.TypeOf(image.RGBA{}), JpegToRGBA)
+	testResizeGolden(t, 4, reflect.TypeOf(image.RGBA{}), JpegToRGBA)
 }
 
 func TestRGB(t *testing.T) {
-	testResize(t, 3, reflect.TypeOf(rgb.Image{}), JpegToRGB)
+	testResizeGolden(t, 3, reflect.TypeOf(rgb.Image{}), JpegToRGB)
 }
 
 func TestGray(t *testing.T) {
-	testResize(t, 1, reflect.TypeOf(image.Gray{}), JpegToGray)
+	testResizeGolden(t, 1, reflect.TypeOf(image.Gray{}), JpegToGray)
 }
 
 func TestReplicateBorder(t *testing.T) {
@@ -118,6 +261,111 @@ func TestReplicateBorder(t *testing.T) {
 	}
 }
 
+func TestResizePad(t *testing.T) {
+	pix := []uint8{
+		1, 2,
+		3, 4,
+	}
+	tests := []struct {
+		gravity  Gravity
+		expected []uint8
+	}{
+		{GravityTopLeft, []uint8{
+			1, 2, 9, 9,
+			3, 4, 9, 9,
+		}},
+		{GravityCenter, []uint8{
+			9, 1, 2, 9,
+			9, 3, 4, 9,
+		}},
+		{GravityBottomRight, []uint8{
+			9, 9, 1, 2,
+			9, 9, 3, 4,
+		}},
+	}
+	for _, item := range tests {
+		out, out_size, err := ResizePad(pix, 2, image.Point{2, 2}, 1, image.Point{4, 2}, []uint8{9}, item.gravity, InterpolationNearestNeighbour, nil)
+		if err != nil {
+			t.Fatalf("ResizePad() failed: %v", err)
+		}
+		if out_size != (image.Point{4, 2}) {
+			t.Errorf("%v: expected size %v, got %v", item.gravity, image.Point{4, 2}, out_size)
+		}
+		if !bytes.Equal(out, item.expected) {
+			t.Errorf("%v: expected %v, got %v", item.gravity, item.expected, out)
+		}
+	}
+
+	if _, _, err := ResizePad(pix, 2, image.Point{2, 2}, 1, image.Point{4, 2}, []uint8{9, 9, 9}, GravityCenter, InterpolationNearestNeighbour, nil); err == nil {
+		t.Errorf("expected error for pad color with wrong number of channels")
+	}
+}
+
+func TestResizeCrop(t *testing.T) {
+	pix := []uint8{
+		1, 2, 3, 4,
+		5, 6, 7, 8,
+	}
+	tests := []struct {
+		gravity  Gravity
+		expected []uint8
+	}{
+		{GravityLeft, []uint8{
+			1, 2,
+			5, 6,
+		}},
+		{GravityCenter, []uint8{
+			2, 3,
+			6, 7,
+		}},
+		{GravityBottomRight, []uint8{
+			3, 4,
+			7, 8,
+		}},
+	}
+	for _, item := range tests {
+		out, out_size, err := ResizeCrop(pix, 4, image.Point{4, 2}, 1, image.Point{2, 2}, item.gravity, InterpolationNearestNeighbour, nil)
+		if err != nil {
+			t.Fatalf("ResizeCrop() failed: %v", err)
+		}
+		if out_size != (image.Point{2, 2}) {
+			t.Errorf("%v: expected size %v, got %v", item.gravity, image.Point{2, 2}, out_size)
+		}
+		if !bytes.Equal(out, item.expected) {
+			t.Errorf("%v: expected %v, got %v", item.gravity, item.expected, out)
+		}
+	}
+
+	if r := GetCropRect(image.Point{640, 480}, image.Point{160, 160}, GravityCenter); r != image.Rect(80, 0, 560, 480) {
+		t.Errorf("GetCropRect(): unexpected %v", r)
+	}
+
+	if _, _, err := ResizeRect(pix, 4, image.Point{4, 2}, 1, image.Rect(3, 0, 5, 2), image.Point{2, 2}, InterpolationNearestNeighbour, nil); err == nil {
+		t.Errorf("expected error for source rectangle outside of the image")
+	}
+
+	for _, item := range []struct {
+		in        []uint8
+		in_stride int
+		channels  int
+		out_size  image.Point
+	}{
+		{pix, 4, 1, image.Point{-1, 2}},
+		{pix, 4, 1, image.Point{2, 0}},
+		{pix, 4, 2, image.Point{2, 2}},
+		{pix[:7], 4, 1, image.Point{2, 2}},
+		{pix, 3, 1, image.Point{2, 2}},
+	} {
+		transform := Transform{ScaleX: 1}
+		if _, _, err := ResizeRect(item.in, item.in_stride, image.Point{4, 2}, item.channels, image.Rect(0, 0, 4, 2), item.out_size, InterpolationLinear, &transform); err == nil {
+			t.Errorf("len %v, stride %v, channels %v, size %v: expected an error", len(item.in), item.in_stride, item.channels, item.out_size)
+		}
+		if transform != (Transform{ScaleX: 1}) {
+			t.Errorf("transform should not be set on failure: %+v", transform)
+		}
+	}
+}
+
 type proportionsTest struct {
 	f                func(image.Point, image.Point) image.Point
 	im, to, expected image.Point
@@ -200,3 +448,90 @@ func TestIppResizeEdgeCases(t *testing.T) {
 		}
 	}
 }
+
+// countdownContext is a cancellable context reporting cancellation after n checks
+type countdownContext struct {
+	context.Context
+	n int32
+}
+
+func (c *countdownContext) Err() error {
+	if atomic.AddInt32(&c.n, -1) < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestResizeContext(t *testing.T) {
+	in_size := image.Point{1200, 1400}
+	out_size := image.Point{resizeTilePixels / 256, 2*256 + 10}
+	in := make([]uint8, 3*in_size.X*in_size.Y)
+	for i := range in {
+		in[i] = uint8(i * 7 / 5)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, interpolation := range allInterpolations {
+		expect := make([]uint8, 3*out_size.X*out_size.Y)
+		if err := Resize(in, 3*in_size.X, in_size, expect, 3*out_size.X, out_size, 3, interpolation); err != nil {
+			t.Fatalf("Resize() failed: %v", err)
+		}
+
+		// resized in 3 tiles
+		out := make([]uint8, len(expect))
+		if err := ResizeContext(ctx, in, 3*in_size.X, in_size, out, 3*out_size.X, out_size, 3, interpolation); err != nil {
+			t.Fatalf("ResizeContext() failed: %v", err)
+		}
+		if !bytes.Equal(out, expect) {
+			t.Errorf("%v: tiled result differs from Resize()", interpolation)
+		}
+
+		resizer := NewResizer()
+		out = make([]uint8, len(expect))
+		if err := resizer.ResizeContext(ctx, in, 3*in_size.X, in_size, out, 3*out_size.X, out_size, 3, interpolation); err != nil {
+			t.Fatalf("Resizer.ResizeContext() failed: %v", err)
+		}
+		resizer.Close()
+		if !bytes.Equal(out, expect) {
+			t.Errorf("%v: tiled Resizer result differs from Resize()", interpolation)
+		}
+	}
+
+	// cancelled after the first tile: the check before resizing and the one before the first tile pass
+	out := make([]uint8, 3*out_size.X*out_size.Y)
+	err := ResizeContext(&countdownContext{ctx, 2}, in, 3*in_size.X, in_size, out, 3*out_size.X, out_size, 3, InterpolationLinear)
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	tile := 3 * out_size.X * 256
+	if bytes.Count(out[:tile], []byte{0}) == tile || bytes.Count(out[tile:], []byte{0}) != len(out)-tile {
+		t.Errorf("only the first tile should be resized")
+	}
+
+	cancel()
+	if err := ResizeContext(ctx, in, 3*in_size.X, in_size, out, 3*out_size.X, out_size, 3, InterpolationLinear); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	data, err := os.ReadFile("./test.jpg")
+	if err != nil {
+		t.Fatalf("os.ReadFile() failed: %v", err)
+	}
+	if _, _, err := JpegToRGBContext(ctx, bytes.NewReader(data), image.Point{100, 100}, InterpolationLinear, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if _, err := JpegToImageContext(ctx, bytes.NewReader(data), image.Point{100, 100}, InterpolationLinear, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := ResizeJpegContext(ctx, bytes.NewReader(data), &buf, image.Point{100, 100}, nil); !errors.Is(err, context.Canceled) || buf.Len() != 0 {
+		t.Errorf("expected context.Canceled and no output, got %v, %v bytes", err, buf.Len())
+	}
+
+	// cancelled between decoding and resizing
+	if _, err := ThumbnailContext(&countdownContext{ctx, 1}, bytes.NewReader(data), WithSize(image.Point{100, 100})); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,274 @@
+package ippresize
+
+/*
+#include "image.h"
+*/
+import "C"
+
+import (
+	"context"
+	"image"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// resizeTilePixels is the number of output pixels resized at once when the context can be cancelled
+const resizeTilePixels = 256 * 1024
+
+// resizerMaxSpecs is the number of specifications kept by NewResizer()
+const resizerMaxSpecs = 64
+
+type resizeKey struct {
+	in_size       image.Point
+	out_size      image.Point
+	interpolation Interpolation
+}
+
+// resizerSpec is a cached specification with the time of its last use by the clock of the resizer
+type resizerSpec struct {
+	used uint64 // atomic
+	spec *C.struct_image_resize_spec_s
+}
+
+// Resizer works like Resize() caching IPP resize specifications by image sizes and interpolation,
+// so resizing many images of the same geometry initializes the filters once.
+// At most 64 specifications are kept, the least recently used one is freed first.
+// It is safe for concurrent use, nil *Resizer resizes without caching.
+type Resizer struct {
+	clock     uint64 // atomic
+	mu        sync.RWMutex
+	specs     map[resizeKey]*resizerSpec
+	max_specs int
+}
+
+func NewResizer() *Resizer {
+	return &Resizer{specs: make(map[resizeKey]*resizerSpec), max_specs: resizerMaxSpecs}
+}
+
+// Close frees the cached specifications, the resizer can't be used after that
+func (r *Resizer) Close() {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, e := range r.specs {
+		C.image_ipp_resize_spec_free(e.spec)
+		delete(r.specs, key)
+	}
+	r.specs = nil
+}
+
+// Len returns the number of cached specifications
+func (r *Resizer) Len() int {
+	if r == nil {
+		return 0
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.specs)
+}
+
+// createResizeSpec creates the IPP resize specification
+func createResizeSpec(key resizeKey) (*C.struct_image_resize_spec_s, error) {
+	const err_size = 1024
+	var err [err_size]C.char
+
+	var spec *C.struct_image_resize_spec_s
+	ret := C.image_ipp_resize_spec_create(C.uint(key.in_size.X), C.uint(key.in_size.Y), C.uint(key.out_size.X), C.uint(key.out_size.Y),
+		C.image_interpolation_t(key.interpolation), &spec, &err[0], err_size)
+
+	if ret != 0 {
+		return nil, NewError(int(ret), "C.image_ipp_resize_spec_create() failed: %v", C.GoString(&err[0]))
+	}
+
+	return spec, nil
+}
+
+// touch marks the specification as used now
+func (r *Resizer) touch(e *resizerSpec) {
+	atomic.StoreUint64(&e.used, atomic.AddUint64(&r.clock, 1))
+}
+
+// evict frees the least recently used specification, the write lock is held
+func (r *Resizer) evict() {
+	var oldest resizeKey
+	var oldest_e *resizerSpec
+	for key, e := range r.specs {
+		if oldest_e == nil || atomic.LoadUint64(&e.used) < atomic.LoadUint64(&oldest_e.used) {
+			oldest, oldest_e = key, e
+		}
+	}
+	if oldest_e != nil {
+		C.image_ipp_resize_spec_free(oldest_e.spec)
+		delete(r.specs, oldest)
+	}
+}
+
+// create creates and caches the specification unless it is already cached
+func (r *Resizer) create(key resizeKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.specs == nil {
+		return NewError(0, "resizer is closed")
+	}
+
+	if _, ok := r.specs[key]; ok {
+		return nil
+	}
+
+	spec, err := createResizeSpec(key)
+	if err != nil {
+		return err
+	}
+
+	for len(r.specs) > 0 && len(r.specs) >= r.max_specs {
+		r.evict()
+	}
+
+	e := &resizerSpec{spec: spec}
+	r.touch(e)
+	r.specs[key] = e
+	return nil
+}
+
+// Resize works like Resize() function
+func (r *Resizer) Resize(in []uint8, in_stride int, in_size image.Point, out []uint8, out_stride int, out_size image.Point, channels int, interpolation Interpolation) error {
+	return r.ResizeContext(context.Background(), in, in_stride, in_size, out, out_stride, out_size, channels, interpolation)
+}
+
+// ResizeContext works like ResizeContext() function
+func (r *Resizer) ResizeContext(ctx context.Context, in []uint8, in_stride int, in_size image.Point, out []uint8, out_stride int, out_size image.Point, channels int, interpolation Interpolation) (err error) {
+	if r == nil {
+		return ResizeContext(ctx, in, in_stride, in_size, out, out_stride, out_size, channels, interpolation)
+	}
+
+	ctx, span := startResizeSpan(ctx, in_size, out_size, channels, interpolation)
+	defer func() {
+		span.End(err)
+	}()
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	if err = checkResize(in, in_size, out, out_size, channels); err != nil {
+		return
+	}
+
+	s := startStage()
+
+	// the specification is used under the read lock, so Close() can't free it in the middle
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key := resizeKey{in_size, out_size, interpolation}
+	e, ok := r.specs[key]
+	if !ok {
+		r.mu.RUnlock()
+		err = r.create(key)
+		r.mu.RLock()
+		if err != nil {
+			s.resized(interpolation, in_size, out_size, err)
+			return
+		}
+		// the resizer might have been closed in between
+		if e, ok = r.specs[key]; !ok {
+			err = NewError(0, "resizer is closed")
+			s.resized(interpolation, in_size, out_size, err)
+			return
+		}
+	}
+
+	r.touch(e)
+
+	err = resizeWithSpec(ctx, e.spec, in, in_stride, in_size, out, out_stride, out_size, channels)
+	s.resized(interpolation, in_size, out_size, err)
+	return
+}
+
+// resizeWithSpec resizes the image with the specification at once, or in tiles of rows checking the context
+// for cancellation in between if the context can be cancelled
+func resizeWithSpec(ctx context.Context, spec *C.struct_image_resize_spec_s, in []uint8, in_stride int, in_size image.Point, out []uint8, out_stride int, out_size image.Point, channels int) error {
+	var img_in C.struct_image_s
+	img_in.w = C.uint(in_size.X)
+	img_in.h = C.uint(in_size.Y)
+	img_in.channels = C.uint(channels)
+	img_in.rowstep = C.size_t(in_stride)
+
+	var img_out C.struct_image_s
+	img_out.w = C.uint(out_size.X)
+	img_out.h = C.uint(out_size.Y)
+	img_out.channels = C.uint(channels)
+	img_out.rowstep = C.size_t(out_stride)
+
+	const err_size = 1024
+	var cerr [err_size]C.char
+
+	if ctx.Done() == nil {
+		img_in_data := (*C.uchar)(unsafe.Pointer(&in[0]))
+		img_out_data := (*C.uchar)(unsafe.Pointer(&out[0]))
+
+		ret := C.image_ipp_resize_with_spec(spec, &img_in, img_in_data, &img_out, img_out_data, &cerr[0], err_size)
+
+		/* make 100% sure garbage collector wont kill these objects in the middle of execution of c function */
+		runtime.KeepAlive(img_in)
+		runtime.KeepAlive(img_in_data)
+		runtime.KeepAlive(img_out)
+		runtime.KeepAlive(img_out_data)
+
+		if ret != 0 {
+			return NewError(int(ret), "C.image_ipp_resize_with_spec() failed: %v", C.GoString(&cerr[0]))
+		}
+		return nil
+	}
+
+	tile_h := resizeTilePixels / out_size.X
+	if tile_h < 1 {
+		tile_h = 1
+	}
+
+	for out_y := 0; out_y < out_size.Y; out_y += tile_h {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		out_h := tile_h
+		if out_y+out_h > out_size.Y {
+			out_h = out_size.Y - out_y
+		}
+
+		var in_y, in_h, in_offset_y C.uint
+		ret := C.image_ipp_resize_src_rows(spec, C.uint(out_y), C.uint(out_h), &in_y, &in_h, &in_offset_y, &cerr[0], err_size)
+		if ret != 0 {
+			return NewError(int(ret), "C.image_ipp_resize_src_rows() failed: %v", C.GoString(&cerr[0]))
+		}
+
+		// the whole source is in memory, so the rows around the tile are there for the filter
+		img_in.h = C.uint(in_size.Y) - in_offset_y
+		img_in_data := (*C.uchar)(unsafe.Pointer(&in[int(in_offset_y)*in_stride]))
+
+		img_out.h = C.uint(out_h)
+		img_out_data := (*C.uchar)(unsafe.Pointer(&out[out_y*out_stride]))
+
+		ret = C.image_ipp_resize_rows(spec, &img_in, img_in_data, &img_out, img_out_data, C.uint(out_y), &cerr[0], err_size)
+
+		/* make 100% sure garbage collector wont kill these objects in the middle of execution of c function */
+		runtime.KeepAlive(img_in)
+		runtime.KeepAlive(img_in_data)
+		runtime.KeepAlive(img_out)
+		runtime.KeepAlive(img_out_data)
+
+		if ret != 0 {
+			return NewError(int(ret), "C.image_ipp_resize_rows() failed: %v", C.GoString(&cerr[0]))
+		}
+	}
+
+	return nil
+}
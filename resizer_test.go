@@ -0,0 +1,111 @@
+package ippresize
+
+import (
+	"bytes"
+	"image"
+	"sync"
+	"testing"
+)
+
+func TestResizer(t *testing.T) {
+	in_size := image.Point{64, 48}
+	in := make([]uint8, 3*in_size.X*in_size.Y)
+	for i := range in {
+		in[i] = uint8(i * 7)
+	}
+
+	out_size := image.Point{20, 15}
+	expect := make([]uint8, 3*out_size.X*out_size.Y)
+	if err := Resize(in, 3*in_size.X, in_size, expect, 3*out_size.X, out_size, 3, InterpolationLanczos); err != nil {
+		t.Fatalf("Resize() failed: %v", err)
+	}
+
+	for _, resizer := range []*Resizer{nil, NewResizer()} {
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				out := make([]uint8, len(expect))
+				if err := resizer.Resize(in, 3*in_size.X, in_size, out, 3*out_size.X, out_size, 3, InterpolationLanczos); err != nil {
+					t.Errorf("Resizer.Resize() failed: %v", err)
+					return
+				}
+				if !bytes.Equal(out, expect) {
+					t.Errorf("Resizer.Resize() result differs from Resize()")
+				}
+			}()
+		}
+		wg.Wait()
+
+		if resizer == nil {
+			continue
+		}
+
+		if resizer.Len() != 1 {
+			t.Errorf("expected 1 cached spec, got %v", resizer.Len())
+		}
+
+		out := make([]uint8, len(expect))
+		if err := resizer.Resize(in, 3*in_size.X, in_size, out, 3*out_size.X, out_size, 3, InterpolationLinear); err != nil {
+			t.Fatalf("Resizer.Resize() failed: %v", err)
+		}
+		if resizer.Len() != 2 {
+			t.Errorf("expected 2 cached specs, got %v", resizer.Len())
+		}
+
+		if err := resizer.Resize(in, 3*in_size.X, in_size, out, 3*out_size.X, out_size, 3, Interpolation(100)); err == nil {
+			t.Errorf("invalid interpolation should fail")
+		}
+
+		resizer.Close()
+		if resizer.Len() != 0 {
+			t.Errorf("expected no cached specs after Close()")
+		}
+		if err := resizer.Resize(in, 3*in_size.X, in_size, out, 3*out_size.X, out_size, 3, InterpolationLinear); err == nil {
+			t.Errorf("closed resizer should fail")
+		}
+	}
+}
+
+func TestResizerLimit(t *testing.T) {
+	in_size := image.Point{64, 48}
+	in := make([]uint8, in_size.X*in_size.Y)
+	for i := range in {
+		in[i] = uint8(i * 7)
+	}
+
+	resizer := NewResizer()
+	defer resizer.Close()
+	resizer.max_specs = 2
+
+	resize := func(out_size image.Point) {
+		out := make([]uint8, out_size.X*out_size.Y)
+		if err := resizer.Resize(in, in_size.X, in_size, out, out_size.X, out_size, 1, InterpolationLinear); err != nil {
+			t.Fatalf("Resizer.Resize() failed: %v", err)
+		}
+		expect := make([]uint8, len(out))
+		Resize(in, in_size.X, in_size, expect, out_size.X, out_size, 1, InterpolationLinear)
+		if !bytes.Equal(out, expect) {
+			t.Errorf("%v: Resizer.Resize() result differs from Resize()", out_size)
+		}
+	}
+
+	a, b, c := image.Point{10, 10}, image.Point{20, 20}, image.Point{30, 30}
+	resize(a)
+	resize(b)
+	resize(a)
+	resize(c)
+
+	if resizer.Len() != 2 {
+		t.Errorf("expected 2 cached specs, got %v", resizer.Len())
+	}
+	for _, item := range []struct {
+		size   image.Point
+		cached bool
+	}{{a, true}, {b, false}, {c, true}} {
+		if _, ok := resizer.specs[resizeKey{in_size, item.size, InterpolationLinear}]; ok != item.cached {
+			t.Errorf("%v: expected cached %v", item.size, item.cached)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package ippresize
+
+//go:generate stringer -type=CropStrategy -trimprefix Crop
+
+import (
+	"image"
+	"math"
+)
+
+// CropStrategy defines how FindSmartCrop() scores candidate crop windows
+type CropStrategy int
+
+const (
+	CropEdges   CropStrategy = iota // sum of luma gradients
+	CropEntropy                     // shannon entropy of the luma histogram
+	CropSkin                        // skin tones and saturated colors, edges for grayscale images
+)
+
+// ParseCropStrategy returns the crop strategy by its name, e.g. "entropy"
+func ParseCropStrategy(name string) (CropStrategy, error) {
+	for c := CropEdges; c <= CropSkin; c++ {
+		if matchName(name, c) {
+			return c, nil
+		}
+	}
+	return 0, NewError(0, "unknown crop strategy: %q", name)
+}
+
+// longest side of the preview the crop windows are scored on
+const smartCropPreviewSize = 96
+
+// FindSmartCrop returns the rectangle of the input image with the aspect ratio of out_size_box
+// which has the most detail according to the strategy. The rectangle is as large as GetCropRect() one
+// and can be stored and passed to ResizeRect() later.
+func FindSmartCrop(in []uint8, in_stride int, in_size image.Point, channels int, out_size_box image.Point, strategy CropStrategy) (image.Rectangle, error) {
+
+	if in_size.X <= 0 || in_size.Y <= 0 {
+		return image.Rectangle{}, NewError(0, "one of the input image dimensions is invalid: {width: %v, height: %v}", in_size.X, in_size.Y)
+	}
+
+	if out_size_box.X <= 0 || out_size_box.Y <= 0 {
+		return image.Rectangle{}, NewError(0, "one of the output box dimensions is invalid: {width: %v, height: %v}", out_size_box.X, out_size_box.Y)
+	}
+
+	if channels != 1 && channels != 3 && channels != 4 {
+		return image.Rectangle{}, NewError(0, "invalid number of channels: %v", channels)
+	}
+
+	window := GetCropRect(in_size, out_size_box, GravityCenter).Size()
+	if window == in_size {
+		return image.Rectangle{Max: in_size}, nil
+	}
+
+	preview, preview_stride, preview_size := in, in_stride, in_size
+	if in_size.X > smartCropPreviewSize || in_size.Y > smartCropPreviewSize {
+		preview_size = GetProportionalLargestInnerSize(in_size, image.Point{smartCropPreviewSize, smartCropPreviewSize})
+		preview_stride = channels * preview_size.X
+		preview = make([]uint8, preview_stride*preview_size.Y)
+		err := Resize(in, in_stride, in_size, preview, preview_stride, preview_size, channels, InterpolationSuper)
+		if err != nil {
+			return image.Rectangle{}, err
+		}
+	}
+
+	// crop window in preview coordinates
+	pw := image.Point{
+		X: clampInt(int(math.Round(float64(window.X)*float64(preview_size.X)/float64(in_size.X))), 1, preview_size.X),
+		Y: clampInt(int(math.Round(float64(window.Y)*float64(preview_size.Y)/float64(in_size.Y))), 1, preview_size.Y),
+	}
+
+	var score func(r image.Rectangle) float64
+
+	switch strategy {
+	case CropEntropy:
+		luma := previewLuma(preview, preview_stride, preview_size, channels)
+		score = func(r image.Rectangle) float64 {
+			return windowEntropy(luma, preview_size.X, r)
+		}
+	case CropSkin:
+		if channels >= 3 {
+			sum := newIntegral(previewSkin(preview, preview_stride, preview_size, channels), preview_size)
+			score = sum.rect
+			break
+		}
+		fallthrough
+	default:
+		luma := previewLuma(preview, preview_stride, preview_size, channels)
+		sum := newIntegral(previewEdges(luma, preview_size), preview_size)
+		score = sum.rect
+	}
+
+	center := image.Point{(preview_size.X - pw.X) / 2, (preview_size.Y - pw.Y) / 2}
+	best := image.Rectangle{center, center.Add(pw)}
+	best_score := score(best)
+	best_dist := 0
+
+	for y := 0; y <= preview_size.Y-pw.Y; y++ {
+		for x := 0; x <= preview_size.X-pw.X; x++ {
+			r := image.Rect(x, y, x+pw.X, y+pw.Y)
+			s := score(r)
+			// on a tie prefer the window closest to the center
+			dist := absInt(x-center.X) + absInt(y-center.Y)
+			if s > best_score || (s == best_score && dist < best_dist) {
+				best, best_score, best_dist = r, s, dist
+			}
+		}
+	}
+
+	pos := image.Point{
+		X: clampInt(int(math.Round(float64(best.Min.X)*float64(in_size.X)/float64(preview_size.X))), 0, in_size.X-window.X),
+		Y: clampInt(int(math.Round(float64(best.Min.Y)*float64(in_size.Y)/float64(preview_size.Y))), 0, in_size.Y-window.Y),
+	}
+
+	return image.Rectangle{pos, pos.Add(window)}, nil
+}
+
+// ResizeSmartCrop crops the rectangle found by FindSmartCrop() and resizes it to out_size_box.
+// The rectangle is returned as well.
+func ResizeSmartCrop(in []uint8, in_stride int, in_size image.Point, channels int, out_size_box image.Point, strategy CropStrategy, interpolation Interpolation, transform *Transform) ([]uint8, image.Point, image.Rectangle, error) {
+	src, err := FindSmartCrop(in, in_stride, in_size, channels, out_size_box, strategy)
+	if err != nil {
+		return nil, image.Point{}, src, err
+	}
+	out, out_size, err := ResizeRect(in, in_stride, in_size, channels, src, out_size_box, interpolation, transform)
+	return out, out_size, src, err
+}
+
+// smartLayout moves the crop of the layout to the rectangle found by FindSmartCrop() if the gravity is GravitySmart.
+// The layout is in display orientation, the image is stored with the orientation.
+func smartLayout(layout Layout, opts *FitOptions, in []uint8, in_stride int, in_size image.Point, channels int, orientation Orientation) (Layout, error) {
+	if opts == nil || opts.Gravity != GravitySmart || layout.Src == (image.Rectangle{Max: orientation.Size(in_size)}) {
+		return layout, nil
+	}
+
+	window := orientation.Inverse().Size(layout.Src.Size())
+	src, err := FindSmartCrop(in, in_stride, in_size, channels, window, opts.CropStrategy)
+	if err != nil {
+		return layout, err
+	}
+
+	layout.Src = orientation.Rect(src, in_size)
+	return layout, nil
+}
+
+// smartLayoutImage works like smartLayout() for a decoded image, YCbCr images are scored on luma
+// unless the strategy needs colors
+func smartLayoutImage(layout Layout, opts *FitOptions, im image.Image, orientation Orientation) (Layout, error) {
+	if opts == nil || opts.Gravity != GravitySmart {
+		return layout, nil
+	}
+
+	if ycbcr, ok := im.(*image.YCbCr); ok {
+		if opts.CropStrategy == CropSkin {
+			im = toRGB(ycbcr, nil)
+		} else {
+			size := ycbcr.Rect.Size()
+			y := ycbcr.Y[ycbcr.YOffset(ycbcr.Rect.Min.X, ycbcr.Rect.Min.Y):]
+			return smartLayout(layout, opts, y, ycbcr.YStride, size, 1, orientation)
+		}
+	}
+
+	pix, stride, channels, err := imagePix(im)
+	if err != nil {
+		return layout, err
+	}
+	return smartLayout(layout, opts, pix, stride, im.Bounds().Size(), channels, orientation)
+}
+
+func previewLuma(pix []uint8, stride int, size image.Point, channels int) []float64 {
+	luma := make([]float64, size.X*size.Y)
+	for y := 0; y < size.Y; y++ {
+		row := pix[y*stride:]
+		for x := 0; x < size.X; x++ {
+			p := row[x*channels:]
+			if channels == 1 {
+				luma[y*size.X+x] = float64(p[0])
+			} else {
+				luma[y*size.X+x] = 0.299*float64(p[0]) + 0.587*float64(p[1]) + 0.114*float64(p[2])
+			}
+		}
+	}
+	return luma
+}
+
+func previewEdges(luma []float64, size image.Point) []float64 {
+	edges := make([]float64, size.X*size.Y)
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			i := y*size.X + x
+			if x+1 < size.X {
+				edges[i] += math.Abs(luma[i+1] - luma[i])
+			}
+			if y+1 < size.Y {
+				edges[i] += math.Abs(luma[i+size.X] - luma[i])
+			}
+		}
+	}
+	return edges
+}
+
+func previewSkin(pix []uint8, stride int, size image.Point, channels int) []float64 {
+	skin := make([]float64, size.X*size.Y)
+	for y := 0; y < size.Y; y++ {
+		row := pix[y*stride:]
+		for x := 0; x < size.X; x++ {
+			p := row[x*channels:]
+			r, g, b := int(p[0]), int(p[1]), int(p[2])
+			hi, lo := r, r
+			if g > hi {
+				hi = g
+			}
+			if b > hi {
+				hi = b
+			}
+			if g < lo {
+				lo = g
+			}
+			if b < lo {
+				lo = b
+			}
+			v := float64(hi-lo) / 255
+			// well known rgb skin color rule by Kovac et al.
+			if r > 95 && g > 40 && b > 20 && hi-lo > 15 && absInt(r-g) > 15 && r > g && r > b {
+				v += 1
+			}
+			skin[y*size.X+x] = v
+		}
+	}
+	return skin
+}
+
+func windowEntropy(luma []float64, width int, r image.Rectangle) float64 {
+	const bins = 32
+	var hist [bins]int
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			hist[int(luma[y*width+x])*bins/256]++
+		}
+	}
+	total := float64(r.Dx() * r.Dy())
+	entropy := 0.
+	for _, n := range hist {
+		if n > 0 {
+			p := float64(n) / total
+			entropy -= p * math.Log2(p)
+		}
+	}
+	return entropy
+}
+
+// integral is a summed-area table allowing to get the sum over any rectangle in constant time
+type integral struct {
+	sum   []float64
+	width int
+}
+
+func newIntegral(v []float64, size image.Point) *integral {
+	w := size.X + 1
+	sum := make([]float64, w*(size.Y+1))
+	for y := 0; y < size.Y; y++ {
+		row := 0.
+		for x := 0; x < size.X; x++ {
+			row += v[y*size.X+x]
+			sum[(y+1)*w+x+1] = sum[y*w+x+1] + row
+		}
+	}
+	return &integral{sum: sum, width: w}
+}
+
+func (s *integral) rect(r image.Rectangle) float64 {
+	w := s.width
+	return s.sum[r.Max.Y*w+r.Max.X] - s.sum[r.Min.Y*w+r.Max.X] - s.sum[r.Max.Y*w+r.Min.X] + s.sum[r.Min.Y*w+r.Min.X]
+}
+
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
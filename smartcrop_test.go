@@ -0,0 +1,138 @@
+package ippresize
+
+import (
+	"bytes"
+	"github.com/anight/go-libjpeg/rgb"
+	"image"
+	stdjpeg "image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// smartCropImages returns the gray and the rgb test images of the size 400x100: flat gray with a detailed area
+// at x in [300, 360), y in [20, 80), the rgb one has a skin colored patch at x in [20, 80) as well
+func smartCropImages() (gray []uint8, rgb []uint8, size image.Point) {
+	size = image.Point{400, 100}
+	gray = make([]uint8, size.X*size.Y)
+	rgb = make([]uint8, 3*size.X*size.Y)
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			v := uint8(100)
+			if x >= 300 && x < 360 && y >= 20 && y < 80 && (x/4+y/4)%2 == 0 {
+				v = 250
+			}
+			gray[y*size.X+x] = v
+			rgb[3*(y*size.X+x)], rgb[3*(y*size.X+x)+1], rgb[3*(y*size.X+x)+2] = v, v, v
+			// skin colored patch on the left
+			if x >= 20 && x < 80 && y >= 20 && y < 80 {
+				rgb[3*(y*size.X+x)], rgb[3*(y*size.X+x)+1], rgb[3*(y*size.X+x)+2] = 224, 172, 105
+			}
+		}
+	}
+	return
+}
+
+func TestSmartCrop(t *testing.T) {
+	gray, rgb, size := smartCropImages()
+	box := image.Point{50, 50}
+
+	for _, strategy := range [...]CropStrategy{CropEdges, CropEntropy} {
+		r, err := FindSmartCrop(gray, size.X, size, 1, box, strategy)
+		if err != nil {
+			t.Fatalf("FindSmartCrop() failed: %v", err)
+		}
+		if r.Size() != (image.Point{100, 100}) {
+			t.Errorf("%v: unexpected crop size: %v", strategy, r)
+		}
+		if r.Min.X < 260 || r.Max.X > 400 {
+			t.Errorf("%v: crop %v misses the detailed area", strategy, r)
+		}
+	}
+
+	r, err := FindSmartCrop(rgb, 3*size.X, size, 3, box, CropSkin)
+	if err != nil {
+		t.Fatalf("FindSmartCrop() failed: %v", err)
+	}
+	if r.Min.X > 25 || r.Max.X < 80 {
+		t.Errorf("%v: crop %v misses the skin colored area", CropSkin, r)
+	}
+
+	out, out_size, src, err := ResizeSmartCrop(gray, size.X, size, 1, box, CropEdges, InterpolationLinear, nil)
+	if err != nil {
+		t.Fatalf("ResizeSmartCrop() failed: %v", err)
+	}
+	if out_size != box || len(out) != box.X*box.Y || src.Empty() {
+		t.Errorf("unexpected result: size=%v, len=%v, src=%v", out_size, len(out), src)
+	}
+}
+
+func TestSmartCropFit(t *testing.T) {
+	gray, pix, size := smartCropImages()
+	box := image.Point{50, 50}
+
+	expected, err := FindSmartCrop(gray, size.X, size, 1, box, CropEdges)
+	if err != nil {
+		t.Fatalf("FindSmartCrop() failed: %v", err)
+	}
+
+	var transform Transform
+	_, out_size, err := ResizeFit(gray, size.X, size, 1, box, FitCover, &FitOptions{Gravity: GravitySmart}, InterpolationLinear, &transform)
+	if err != nil {
+		t.Fatalf("ResizeFit() failed: %v", err)
+	}
+	if out_size != box || transform.Crop != expected {
+		t.Errorf("ResizeFit(): expected crop %v, got %v", expected, transform.Crop)
+	}
+
+	// contain has nothing to crop, smart is centered
+	_, _, err = ResizeFit(gray, size.X, size, 1, box, FitContain, &FitOptions{Gravity: GravitySmart}, InterpolationLinear, &transform)
+	if err != nil || transform.Crop != (image.Rectangle{Max: size}) {
+		t.Errorf("ResizeFit() with FitContain: %+v, %v", transform, err)
+	}
+
+	im := &rgb.Image{Pix: pix, Stride: 3 * size.X, Rect: image.Rectangle{Max: size}}
+	var png_data, jpeg_data bytes.Buffer
+	png.Encode(&png_data, &image.Gray{Pix: gray, Stride: size.X, Rect: image.Rectangle{Max: size}})
+	stdjpeg.Encode(&jpeg_data, im, &stdjpeg.Options{Quality: 95})
+
+	r, err := Thumbnail(bytes.NewReader(png_data.Bytes()), WithSize(box), WithFit(FitCover), WithGravity(GravitySmart))
+	if err != nil {
+		t.Fatalf("Thumbnail() failed: %v", err)
+	}
+	if r.Transform.Crop != expected {
+		t.Errorf("Thumbnail(): expected crop %v, got %v", expected, r.Transform.Crop)
+	}
+
+	// the crop is reusable by ResizeRect()
+	var reused Transform
+	_, _, err = ResizeRect(gray, size.X, size, 1, r.Transform.Crop, box, InterpolationLinear, &reused)
+	if err != nil || reused.Crop != expected || reused.ScaleX != r.Transform.ScaleX || reused.OffsetX != r.Transform.OffsetX {
+		t.Errorf("ResizeRect() with the stored crop: %+v, %v", reused, err)
+	}
+
+	rs, err := ThumbnailSet(bytes.NewReader(png_data.Bytes()), []Spec{
+		{Size: box, Fit: FitCover, Options: []Option{WithGravity(GravitySmart)}},
+		{Size: box, Fit: FitCover},
+	}, nil)
+	if err != nil {
+		t.Fatalf("ThumbnailSet() failed: %v", err)
+	}
+	if rs[0].Transform.Crop != expected || rs[1].Transform.Crop != GetCropRect(size, box, GravityCenter) {
+		t.Errorf("ThumbnailSet(): unexpected crops %v, %v", rs[0].Transform.Crop, rs[1].Transform.Crop)
+	}
+
+	// jpeg is scored on luma, the skin strategy uses colors; the crop covers the area [x0, x1)
+	for _, c := range []struct {
+		strategy CropStrategy
+		x0, x1   int
+	}{{CropEdges, 300, 360}, {CropSkin, 20, 80}} {
+		var out bytes.Buffer
+		transform, err := ResizeJpeg(bytes.NewReader(jpeg_data.Bytes()), &out, box, nil, WithFit(FitCover), WithGravity(GravitySmart), WithCropStrategy(c.strategy))
+		if err != nil {
+			t.Fatalf("ResizeJpeg() failed: %v", err)
+		}
+		if transform.Crop.Size() != expected.Size() || transform.Crop.Min.X > c.x0 || transform.Crop.Max.X < c.x1 {
+			t.Errorf("ResizeJpeg() with %v: unexpected crop %v", c.strategy, transform.Crop)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package ippresize
+
+/*
+#include "image.h"
+*/
+import "C"
+
+import (
+	"image"
+	"runtime"
+	"unsafe"
+)
+
+// source rows covered by the destination rows resized at once by ResizeStream(), and the most destination rows
+const streamStripHeight = 16
+
+// streamStripRows returns the number of destination rows resized at once, heavy downscaling goes row by row
+func streamStripRows(in_h, out_h int) int {
+	rows := streamStripHeight * out_h / in_h
+	if rows < 1 {
+		return 1
+	}
+	if rows > streamStripHeight {
+		return streamStripHeight
+	}
+	return rows
+}
+
+// RowReader is a source of image rows read from top to bottom
+type RowReader interface {
+	Size() image.Point
+	Channels() int
+	// ReadRow reads the next row of Size().X * Channels() bytes
+	ReadRow(row []uint8) error
+}
+
+// RowWriter receives the rows of the resized image from top to bottom
+type RowWriter interface {
+	// WriteRow is passed a row of out_size.X * channels bytes, it is not retained after the call
+	WriteRow(row []uint8) error
+}
+
+// ResizeStream resizes the image read row by row to out_size writing the rows as soon as they are ready.
+// Only the source rows needed by the filter for a strip of destination rows are kept in memory,
+// so memory usage is proportional to the image width, not the area.
+func ResizeStream(reader RowReader, writer RowWriter, out_size image.Point, interpolation Interpolation) error {
+	in_size := reader.Size()
+	channels := reader.Channels()
+
+	if channels != 1 && channels != 3 && channels != 4 {
+		return NewError(0, "invalid number of channels: %v", channels)
+	}
+
+	if in_size.X <= 0 || in_size.Y <= 0 {
+		return NewError(0, "invalid input size: %v", in_size)
+	}
+
+	if out_size.X <= 0 || out_size.Y <= 0 {
+		return NewError(0, "invalid output size: %v", out_size)
+	}
+
+	const err_size = 1024
+	var cerr [err_size]C.char
+
+	var spec *C.struct_image_resize_spec_s
+	ret := C.image_ipp_resize_spec_create(C.uint(in_size.X), C.uint(in_size.Y), C.uint(out_size.X), C.uint(out_size.Y),
+		C.image_interpolation_t(interpolation), &spec, &cerr[0], err_size)
+
+	if ret != 0 {
+		return NewError(int(ret), "C.image_ipp_resize_spec_create() failed: %v", C.GoString(&cerr[0]))
+	}
+
+	defer C.image_ipp_resize_spec_free(spec)
+
+	in_stride := channels * in_size.X
+	out_stride := channels * out_size.X
+
+	// window holds window_rows source rows starting at window_y
+	var window []uint8
+	window_y := 0
+	window_rows := 0
+
+	strip := streamStripRows(in_size.Y, out_size.Y)
+	out := make([]uint8, out_stride*strip)
+
+	for out_y := 0; out_y < out_size.Y; out_y += strip {
+		out_h := strip
+		if out_y+out_h > out_size.Y {
+			out_h = out_size.Y - out_y
+		}
+
+		var in_y, in_h, in_offset_y C.uint
+		ret := C.image_ipp_resize_src_rows(spec, C.uint(out_y), C.uint(out_h), &in_y, &in_h, &in_offset_y, &cerr[0], err_size)
+		if ret != 0 {
+			return NewError(int(ret), "C.image_ipp_resize_src_rows() failed: %v", C.GoString(&cerr[0]))
+		}
+
+		// the rows above the strip are not needed anymore
+		if drop := int(in_y) - window_y; drop > 0 {
+			if drop > window_rows {
+				drop = window_rows
+			}
+			copy(window, window[drop*in_stride:window_rows*in_stride])
+			window_y += drop
+			window_rows -= drop
+		}
+
+		for window_y+window_rows < int(in_y+in_h) {
+			if need := (window_rows + 1) * in_stride; need > len(window) {
+				window = append(window, make([]uint8, need-len(window))...)
+			}
+			if err := reader.ReadRow(window[window_rows*in_stride : (window_rows+1)*in_stride]); err != nil {
+				return err
+			}
+			window_rows++
+		}
+
+		if int(in_offset_y) < window_y {
+			return NewError(0, "source offset %v is above the buffered rows %v..%v", in_offset_y, window_y, window_y+window_rows)
+		}
+
+		var img_in C.struct_image_s
+		img_in.w = C.uint(in_size.X)
+		img_in.h = C.uint(window_rows)
+		img_in.channels = C.uint(channels)
+		img_in.rowstep = C.size_t(in_stride)
+		img_in_data := (*C.uchar)(unsafe.Pointer(&window[(int(in_offset_y)-window_y)*in_stride]))
+
+		var img_out C.struct_image_s
+		img_out.w = C.uint(out_size.X)
+		img_out.h = C.uint(out_h)
+		img_out.channels = C.uint(channels)
+		img_out.rowstep = C.size_t(out_stride)
+		img_out_data := (*C.uchar)(unsafe.Pointer(&out[0]))
+
+		ret = C.image_ipp_resize_rows(spec, &img_in, img_in_data, &img_out, img_out_data, C.uint(out_y), &cerr[0], err_size)
+
+		/* make 100% sure garbage collector wont kill these objects in the middle of execution of c function */
+		runtime.KeepAlive(img_in)
+		runtime.KeepAlive(img_in_data)
+		runtime.KeepAlive(img_out)
+		runtime.KeepAlive(img_out_data)
+
+		if ret != 0 {
+			return NewError(int(ret), "C.image_ipp_resize_rows() failed: %v", C.GoString(&cerr[0]))
+		}
+
+		for i := 0; i < out_h; i++ {
+			if err := writer.WriteRow(out[i*out_stride : (i+1)*out_stride]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
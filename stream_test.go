@@ -0,0 +1,108 @@
+package ippresize
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"testing"
+)
+
+// pixRows reads the rows of the pixel buffer
+type pixRows struct {
+	pix      []uint8
+	size     image.Point
+	channels int
+	row      int
+}
+
+func (r *pixRows) Size() image.Point {
+	return r.size
+}
+
+func (r *pixRows) Channels() int {
+	return r.channels
+}
+
+func (r *pixRows) ReadRow(row []uint8) error {
+	stride := r.channels * r.size.X
+	copy(row, r.pix[r.row*stride:(r.row+1)*stride])
+	r.row++
+	return nil
+}
+
+// rowsBuffer collects the written rows, first_read is the number of rows read when the first row was written
+type rowsBuffer struct {
+	bytes.Buffer
+	reader     *pixRows
+	first_read int
+	err        error
+}
+
+func (w *rowsBuffer) WriteRow(row []uint8) error {
+	if w.Len() == 0 {
+		w.first_read = w.reader.row
+	}
+	w.Write(row)
+	return w.err
+}
+
+func TestResizeStream(t *testing.T) {
+	in_size := image.Point{150, 400}
+
+	for _, channels := range []int{1, 3, 4} {
+		in := make([]uint8, channels*in_size.X*in_size.Y)
+		for i := range in {
+			in[i] = uint8(i*7 + i/(channels*in_size.X)*3)
+		}
+
+		for _, out_size := range []image.Point{{50, 100}, {15, 13}, {300, 800}, {150, 37}} {
+			for _, interpolation := range []Interpolation{InterpolationLinear, InterpolationLanczos, InterpolationNearestNeighbour, InterpolationAntialiasingCubic} {
+				expect := make([]uint8, channels*out_size.X*out_size.Y)
+				if err := Resize(in, channels*in_size.X, in_size, expect, channels*out_size.X, out_size, channels, interpolation); err != nil {
+					t.Fatalf("Resize() failed: %v", err)
+				}
+
+				reader := &pixRows{pix: in, size: in_size, channels: channels}
+				writer := &rowsBuffer{reader: reader}
+				if err := ResizeStream(reader, writer, out_size, interpolation); err != nil {
+					t.Fatalf("ResizeStream() failed: %v", err)
+				}
+
+				if !bytes.Equal(writer.Bytes(), expect) {
+					t.Errorf("%v channels, %v, %v: result differs from Resize()", channels, out_size, interpolation)
+				}
+				if reader.row > in_size.Y {
+					t.Errorf("%v channels, %v, %v: %v rows read", channels, out_size, interpolation, reader.row)
+				}
+				// the first strip is written long before the end of the image
+				if out_size.Y > 2*streamStripHeight && writer.first_read > in_size.Y/2 {
+					t.Errorf("%v channels, %v, %v: %v rows read before the first row is written", channels, out_size, interpolation, writer.first_read)
+				}
+				// the strips of heavy downscaling cover about streamStripHeight source rows plus the filter support
+				if factor := in_size.Y / out_size.Y; factor > 1 && writer.first_read > 2*streamStripHeight+2*factor {
+					t.Errorf("%v channels, %v, %v: %v rows read before the first row is written", channels, out_size, interpolation, writer.first_read)
+				}
+			}
+		}
+	}
+
+	in := make([]uint8, 3*in_size.X*in_size.Y)
+
+	write_err := errors.New("write failed")
+	reader := &pixRows{pix: in, size: in_size, channels: 3}
+	if err := ResizeStream(reader, &rowsBuffer{reader: reader, err: write_err}, image.Point{10, 10}, InterpolationLinear); err != write_err {
+		t.Errorf("expected writer error, got %v", err)
+	}
+
+	if err := ResizeStream(&pixRows{pix: in, size: in_size, channels: 2}, &rowsBuffer{}, image.Point{10, 10}, InterpolationLinear); err == nil {
+		t.Errorf("invalid number of channels should fail")
+	}
+
+	if err := ResizeStream(&pixRows{pix: in, size: in_size, channels: 3}, &rowsBuffer{}, image.Point{0, 10}, InterpolationLinear); err == nil {
+		t.Errorf("invalid output size should fail")
+	}
+
+	if err := ResizeStream(&pixRows{pix: in, size: in_size, channels: 3}, &rowsBuffer{}, image.Point{10, 10}, Interpolation(100)); err == nil {
+		t.Errorf("invalid interpolation should fail")
+	}
+}
@@ -0,0 +1,260 @@
+package ippresize
+
+//go:generate stringer -type=PixelFormat -trimprefix PixelFormat
+
+import (
+	"context"
+	"github.com/anight/go-libjpeg/jpeg"
+	"github.com/anight/go-libjpeg/rgb"
+	"image"
+	"image/png"
+	"io"
+)
+
+// PixelFormat is the layout of pixels of the output image
+type PixelFormat int
+
+const (
+	PixelFormatRGB  PixelFormat = iota // 3 bytes per pixel, *rgb.Image
+	PixelFormatRGBA                    // 4 bytes per pixel, *image.RGBA
+	PixelFormatGray                    // 1 byte per pixel, *image.Gray
+)
+
+// Channels returns the number of bytes per pixel
+func (f PixelFormat) Channels() int {
+	switch f {
+	case PixelFormatRGBA:
+		return 4
+	case PixelFormatGray:
+		return 1
+	}
+	return 3
+}
+
+func (f PixelFormat) colorspace() jpeg.OutColorSpace {
+	switch f {
+	case PixelFormatRGBA:
+		return jpeg.OutColorSpaceRGBA
+	case PixelFormatGray:
+		return jpeg.OutColorSpaceGray
+	}
+	return jpeg.OutColorSpaceRGB
+}
+
+// Result is the output image of Thumbnail()
+type Result struct {
+	Pix       []uint8
+	Stride    int
+	Size      image.Point
+	Format    PixelFormat
+	Source    ImageFormat // format of the input image
+	Transform Transform   // geometry of the operation, see Transform
+}
+
+// Image returns the result as *rgb.Image, *image.RGBA or *image.Gray sharing pixel data with the result
+func (r *Result) Image() image.Image {
+	rect := image.Rectangle{Max: r.Size}
+	switch r.Format {
+	case PixelFormatRGBA:
+		return &image.RGBA{Pix: r.Pix, Stride: r.Stride, Rect: rect}
+	case PixelFormatGray:
+		return &image.Gray{Pix: r.Pix, Stride: r.Stride, Rect: rect}
+	}
+	return &rgb.Image{Pix: r.Pix, Stride: r.Stride, Rect: rect}
+}
+
+// Encode writes the result as JPEG, PNG or WebP, quality 1..100 applies to JPEG and WebP, 0 means 75.
+// Alpha channel is composed over white for JPEG.
+func (r *Result) Encode(writer io.Writer, format ImageFormat, quality int) error {
+	if quality < 0 || quality > 100 {
+		return NewError(0, "invalid quality: %v", quality)
+	}
+
+	s := startStage()
+
+	var err error
+	switch format {
+	case ImageFormatJPEG:
+		im := r.Image()
+		if r.Format == PixelFormatRGBA {
+			im = toRGB(im, (*DecodeOptions)(nil).background())
+		}
+		err = jpeg.Encode(writer, im, (&JpegOptions{Quality: quality}).encoderOptions())
+	case ImageFormatPNG:
+		err = png.Encode(writer, r.Image())
+	case ImageFormatWebP:
+		// measured by EncodeWebP()
+		return EncodeWebP(writer, r.Pix, r.Stride, r.Size, r.Format.Channels(), &WebPOptions{Quality: float32(quality)})
+	default:
+		return NewError(0, "unsupported output format: %v", format)
+	}
+
+	s.encoded(format, r.Size, err)
+	return err
+}
+
+type thumbnailOptions struct {
+	format        PixelFormat
+	box           image.Point
+	fit           Fit
+	fit_opts      FitOptions
+	proportional  bool // legacy JpegTo{RGBA,RGB,Gray}() layout: fit into the box without padding, enlarge if needed
+	interpolation Interpolation
+	decode_opts   *DecodeOptions
+}
+
+// Option configures Thumbnail()
+type Option func(*thumbnailOptions)
+
+// WithFormat sets the pixel format of the result, PixelFormatRGB by default
+func WithFormat(format PixelFormat) Option {
+	return func(o *thumbnailOptions) {
+		o.format = format
+	}
+}
+
+// WithSize sets the box the image is resized to, zero dimension follows the aspect ratio of the image.
+// By default the image is not resized.
+func WithSize(box image.Point) Option {
+	return func(o *thumbnailOptions) {
+		o.box = box
+	}
+}
+
+// WithFit sets how the image is sized to the box, FitContain by default
+func WithFit(fit Fit) Option {
+	return func(o *thumbnailOptions) {
+		o.fit = fit
+		o.proportional = false
+	}
+}
+
+// WithFitOptions sets all the fit options at once
+func WithFitOptions(opts FitOptions) Option {
+	return func(o *thumbnailOptions) {
+		o.fit_opts = opts
+	}
+}
+
+// WithGravity sets the placement of the image for FitContain and FitCover, GravityCenter by default
+func WithGravity(gravity Gravity) Option {
+	return func(o *thumbnailOptions) {
+		o.fit_opts.Gravity = gravity
+	}
+}
+
+// WithCropStrategy sets the scoring of the crop windows for GravitySmart, CropEdges by default
+func WithCropStrategy(strategy CropStrategy) Option {
+	return func(o *thumbnailOptions) {
+		o.fit_opts.CropStrategy = strategy
+	}
+}
+
+// WithPadding sets the padding color for FitContain, one value per channel of the pixel format, gray by default
+func WithPadding(color []uint8) Option {
+	return func(o *thumbnailOptions) {
+		o.fit_opts.PadColor = color
+	}
+}
+
+// WithoutEnlargement never makes the image larger than the source
+func WithoutEnlargement() Option {
+	return func(o *thumbnailOptions) {
+		o.fit_opts.WithoutEnlargement = true
+	}
+}
+
+// WithInterpolation sets the interpolation, InterpolationLinear by default
+func WithInterpolation(interpolation Interpolation) Option {
+	return func(o *thumbnailOptions) {
+		o.interpolation = interpolation
+	}
+}
+
+// WithDecodeOptions sets jpeg decoder options
+func WithDecodeOptions(opts *DecodeOptions) Option {
+	return func(o *thumbnailOptions) {
+		o.decode_opts = opts
+	}
+}
+
+// withFitOptions is WithFitOptions() accepting nil
+func withFitOptions(opts *FitOptions) Option {
+	return func(o *thumbnailOptions) {
+		if opts != nil {
+			o.fit_opts = *opts
+		}
+	}
+}
+
+// withProportional selects the layout of JpegTo{RGBA,RGB,Gray}() functions
+func withProportional() Option {
+	return func(o *thumbnailOptions) {
+		o.proportional = true
+	}
+}
+
+// newThumbnailOptions returns the defaults with the options applied
+func newThumbnailOptions(opts []Option) thumbnailOptions {
+	o := thumbnailOptions{
+		format:        PixelFormatRGB,
+		fit:           FitContain,
+		interpolation: InterpolationLinear,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// layoutFuncs returns the functions computing the scale target and the layout for decodeToLayout()
+func (o *thumbnailOptions) layoutFuncs() (scale_target func(orig_size image.Point) image.Point, layout func(orig_size image.Point, decoded_size image.Point) Layout) {
+	if o.proportional {
+		scale_target = func(orig_size image.Point) image.Point {
+			return o.box
+		}
+		layout = func(orig_size image.Point, decoded_size image.Point) Layout {
+			size := GetProportionalLargestInnerSize(decoded_size, o.box)
+			return Layout{Size: size, Src: image.Rectangle{Max: decoded_size}, Dst: image.Rectangle{Max: size}}
+		}
+		return
+	}
+
+	scale_target = func(orig_size image.Point) image.Point {
+		return ComputeLayout(orig_size, o.box, o.fit, &o.fit_opts).scaleTarget(orig_size)
+	}
+	layout = func(orig_size image.Point, decoded_size image.Point) Layout {
+		return ComputeLayout(decoded_size, ResolveBox(orig_size, o.box), o.fit, &o.fit_opts)
+	}
+	return
+}
+
+// Thumbnail decodes the image and resizes it according to the options.
+// JPEG, WebP, PNG, GIF and BMP images are supported, see DecodeAnyWithOptions() for handling of alpha channel.
+func Thumbnail(reader io.Reader, opts ...Option) (*Result, error) {
+	return ThumbnailContext(context.Background(), reader, opts...)
+}
+
+// ThumbnailContext works like Thumbnail(), it stops with the error of the context when it is done.
+// The context is checked between decoding and resizing and between the tiles of the resize.
+func ThumbnailContext(ctx context.Context, reader io.Reader, opts ...Option) (*Result, error) {
+	o := newThumbnailOptions(opts)
+
+	if o.format != PixelFormatRGB && o.format != PixelFormatRGBA && o.format != PixelFormatGray {
+		return nil, NewError(0, "invalid pixel format: %v", o.format)
+	}
+
+	scale_target, layout := o.layoutFuncs()
+
+	r := &Result{Format: o.format}
+	pix, size, source, err := decodeToLayout(ctx, reader, o.format.colorspace(), scale_target, layout, &o.fit_opts, o.interpolation, &r.Transform, o.decode_opts)
+	if pix == nil {
+		return nil, err
+	}
+
+	r.Pix = pix
+	r.Size = size
+	r.Source = source
+	r.Stride = o.format.Channels() * size.X
+	return r, err
+}
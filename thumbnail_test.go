@@ -0,0 +1,108 @@
+package ippresize
+
+import (
+	"bytes"
+	"github.com/anight/go-libjpeg/rgb"
+	"image"
+	"os"
+	"testing"
+)
+
+func TestThumbnail(t *testing.T) {
+	data, err := os.ReadFile("./test.jpg")
+	if err != nil {
+		t.Fatalf("os.ReadFile() failed: %v", err)
+	}
+
+	r, err := Thumbnail(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Thumbnail() failed: %v", err)
+	}
+	if r.Size != (image.Point{566, 850}) || r.Format != PixelFormatRGB || r.Stride != 3*566 {
+		t.Errorf("unexpected result: size=%v, format=%v, stride=%v", r.Size, r.Format, r.Stride)
+	}
+	if _, ok := r.Image().(*rgb.Image); !ok {
+		t.Errorf("unexpected image type: %T", r.Image())
+	}
+
+	r, err = Thumbnail(bytes.NewReader(data), WithFormat(PixelFormatRGBA), WithSize(image.Point{100, 100}),
+		WithPadding([]uint8{1, 2, 3, 4}), WithGravity(GravityLeft), WithInterpolation(InterpolationSuper))
+	if err != nil {
+		t.Fatalf("Thumbnail() failed: %v", err)
+	}
+	if r.Size != (image.Point{100, 100}) || len(r.Pix) != 4*100*100 {
+		t.Fatalf("unexpected size: %v", r.Size)
+	}
+	if !bytes.Equal(r.Pix[len(r.Pix)-4:], []uint8{1, 2, 3, 4}) {
+		t.Errorf("right side should be padded: %v", r.Pix[len(r.Pix)-4:])
+	}
+	if dst := r.Transform.RectToOutput(image.Rect(0, 0, 566, 850)); dst.Min != (image.Point{}) || dst.Max.Y != 100 || dst.Max.X < 66 || dst.Max.X > 67 {
+		t.Errorf("unexpected image placement: %v", dst)
+	}
+	if im, ok := r.Image().(*image.RGBA); !ok || im.Bounds() != image.Rect(0, 0, 100, 100) {
+		t.Errorf("unexpected image: %T", r.Image())
+	}
+
+	r, err = Thumbnail(bytes.NewReader(data), WithFormat(PixelFormatGray), WithSize(image.Point{1000, 0}), WithFit(FitCover), WithoutEnlargement())
+	if err != nil {
+		t.Fatalf("Thumbnail() failed: %v", err)
+	}
+	if r.Size != (image.Point{566, 850}) || r.Stride != 566 {
+		t.Errorf("unexpected result: size=%v, stride=%v", r.Size, r.Stride)
+	}
+
+	_, err = Thumbnail(bytes.NewReader(data), WithFormat(PixelFormat(42)))
+	if err == nil {
+		t.Errorf("invalid pixel format should fail")
+	}
+
+	// legacy wrappers are equivalent to Thumbnail() calls
+	pix, size, err := JpegToGray(bytes.NewReader(data), image.Point{64, 64}, InterpolationLinear)
+	if err != nil {
+		t.Fatalf("JpegToGray() failed: %v", err)
+	}
+	r, err = Thumbnail(bytes.NewReader(data), WithFormat(PixelFormatGray), WithSize(image.Point{64, 64}), WithFit(FitInside))
+	if err != nil {
+		t.Fatalf("Thumbnail() failed: %v", err)
+	}
+	if r.Size != size || !bytes.Equal(r.Pix, pix) {
+		t.Errorf("JpegToGray() doesn't match Thumbnail(): %v vs %v", size, r.Size)
+	}
+}
+
+func TestResultEncode(t *testing.T) {
+	data, err := os.ReadFile("./test.jpg")
+	if err != nil {
+		t.Fatalf("os.ReadFile() failed: %v", err)
+	}
+
+	for _, format := range []PixelFormat{PixelFormatRGB, PixelFormatRGBA, PixelFormatGray} {
+		r, err := Thumbnail(bytes.NewReader(data), WithFormat(format), WithSize(image.Point{60, 60}))
+		if err != nil {
+			t.Fatalf("Thumbnail() failed: %v", err)
+		}
+		for _, output := range []ImageFormat{ImageFormatJPEG, ImageFormatPNG, ImageFormatWebP} {
+			var buf bytes.Buffer
+			if err := r.Encode(&buf, output, 0); err != nil {
+				t.Fatalf("%v %v: Encode() failed: %v", format, output, err)
+			}
+			if f := SniffFormat(buf.Bytes()); f != output {
+				t.Errorf("%v: expected %v, got %v", format, output, f)
+			}
+			if output == ImageFormatWebP {
+				continue
+			}
+			config, _, err := image.DecodeConfig(&buf)
+			if err != nil || config.Width != 60 || config.Height != 60 {
+				t.Errorf("%v %v: unexpected encoded image: %+v, %v", format, output, config, err)
+			}
+		}
+
+		if err := r.Encode(new(bytes.Buffer), ImageFormatGIF, 0); err == nil {
+			t.Errorf("unsupported format should fail")
+		}
+		if err := r.Encode(new(bytes.Buffer), ImageFormatJPEG, 101); err == nil {
+			t.Errorf("invalid quality should fail")
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package ippresize
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"io"
+	"sort"
+)
+
+// Spec is an output of ThumbnailSet()
+type Spec struct {
+	Size    image.Point // the box, see WithSize()
+	Fit     Fit
+	Format  PixelFormat
+	Options []Option // other Thumbnail() options applied after the fields, WithDecodeOptions() is ignored
+}
+
+// SetOptions control ThumbnailSet(), nil means defaults
+type SetOptions struct {
+	DecodeOptions *DecodeOptions
+
+	// Cascade resizes an output from a larger one of the same crop instead of the decoded image
+	// if the larger one is at least twice as large in both dimensions
+	Cascade bool
+
+	Resizer *Resizer // cache of resize specifications, a temporary one serves the set if nil
+}
+
+func (o *SetOptions) decodeOptions() *DecodeOptions {
+	if o == nil {
+		return nil
+	}
+	return o.DecodeOptions
+}
+
+// ThumbnailSet decodes the image once at the scale needed by the largest output and produces an output per spec,
+// the results are in the order of specs. The image is resized in the widest pixel format of the specs
+// and the outputs are converted to their formats, see DecodeAnyWithOptions() for handling of alpha channel.
+func ThumbnailSet(reader io.Reader, specs []Spec, opts *SetOptions) ([]*Result, error) {
+	if len(specs) == 0 {
+		return nil, NewError(0, "no thumbnail specs")
+	}
+
+	decode_opts := opts.decodeOptions()
+
+	resizer := (*Resizer)(nil)
+	if opts != nil {
+		resizer = opts.Resizer
+	}
+	if resizer == nil {
+		resizer = NewResizer()
+		defer resizer.Close()
+	}
+
+	options := make([]thumbnailOptions, len(specs))
+	decoded_format := PixelFormatGray
+	for i, spec := range specs {
+		o := newThumbnailOptions(append([]Option{WithSize(spec.Size), WithFit(spec.Fit), WithFormat(spec.Format)}, spec.Options...))
+		o.decode_opts = decode_opts
+
+		switch o.format {
+		case PixelFormatRGBA:
+			decoded_format = PixelFormatRGBA
+		case PixelFormatRGB:
+			if decoded_format == PixelFormatGray {
+				decoded_format = PixelFormatRGB
+			}
+		case PixelFormatGray:
+		default:
+			return nil, NewError(0, "invalid pixel format of spec %v: %v", i, o.format)
+		}
+
+		options[i] = o
+	}
+
+	scale_target := func(orig_size image.Point) (target image.Point) {
+		for i := range options {
+			f, _ := options[i].layoutFuncs()
+			t := f(orig_size)
+			if t.X > target.X {
+				target.X = t.X
+			}
+			if t.Y > target.Y {
+				target.Y = t.Y
+			}
+		}
+		return
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	im, orig_size, orientation, source, err := decodeImage(context.Background(), data, decoded_format.colorspace(), scale_target, decode_opts)
+	if err != nil {
+		return nil, err
+	}
+
+	pix, stride, channels, err := imagePix(im)
+	if err != nil {
+		return nil, err
+	}
+
+	in_size := im.Bounds().Size()
+	decoded_size := orientation.Size(in_size)
+
+	layouts := make([]Layout, len(specs))
+	for i := range options {
+		_, layout_func := options[i].layoutFuncs()
+		layouts[i], err = smartLayout(layout_func(orig_size, decoded_size), &options[i].fit_opts, pix, stride, in_size, channels, orientation)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// larger outputs first, so they can serve as sources of the smaller ones
+	order := make([]int, len(specs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		da, db := layouts[order[a]].Dst.Size(), layouts[order[b]].Dst.Size()
+		return da.X*da.Y > db.X*db.Y
+	})
+
+	cascade := opts != nil && opts.Cascade
+	outputs := make([][]uint8, len(specs))
+
+	for n, i := range order {
+		o := &options[i]
+		layout := layouts[i]
+		pad_color := expandPadColor(o.fit_opts.PadColor, o.format.Channels(), channels)
+
+		from := -1
+		if cascade {
+			// the smallest of the larger outputs with the same crop
+			for _, j := range order[:n] {
+				lj := layouts[j]
+				if lj.Src == layout.Src && lj.Dst.Dx() >= 2*layout.Dst.Dx() && lj.Dst.Dy() >= 2*layout.Dst.Dy() {
+					from = j
+				}
+			}
+		}
+
+		if from >= 0 {
+			ls := layouts[from]
+			outputs[i], err = resizeLayout(context.Background(), resizer, outputs[from], channels*ls.Size.X, ls.Size, channels,
+				Layout{Size: layout.Size, Src: ls.Dst, Dst: layout.Dst}, pad_color, OrientationNormal, o.interpolation)
+		} else {
+			outputs[i], err = resizeLayout(context.Background(), resizer, pix, stride, in_size, channels, layout, pad_color, orientation, o.interpolation)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]*Result, len(specs))
+	for i := range options {
+		o := &options[i]
+		layout := layouts[i]
+		r := &Result{
+			Pix:    convertPixels(outputs[i], channels, o.format, decode_opts.background()),
+			Stride: o.format.Channels() * layout.Size.X,
+			Size:   layout.Size,
+			Format: o.format,
+			Source: source,
+		}
+		r.Transform = newTransform(decoded_size, layout.Src, layout.Dst, layout.Size)
+		r.Transform.Orientation = orientation
+		r.Transform.rebase(orig_size)
+		results[i] = r
+	}
+
+	return results, nil
+}
+
+// expandPadColor converts the pad color given for the output channels to the resized image channels
+func expandPadColor(c []uint8, channels int, resized_channels int) []uint8 {
+	if len(c) == 0 {
+		c = grayColor(channels)
+	}
+	if len(c) != channels || channels == resized_channels {
+		return c
+	}
+	if len(c) == 1 {
+		c = []uint8{c[0], c[0], c[0]}
+	}
+	if resized_channels == 4 && len(c) == 3 {
+		c = append(c[:3:3], 255)
+	}
+	return c
+}
+
+// convertPixels converts densely packed pixels with the given number of channels to the format,
+// premultiplied RGBA is composed over the background
+func convertPixels(pix []uint8, channels int, format PixelFormat, background color.Color) []uint8 {
+	if channels == format.Channels() {
+		return pix
+	}
+
+	n := len(pix) / channels
+	out := make([]uint8, n*format.Channels())
+
+	br, bg, bb, _ := background.RGBA()
+	bgc := [3]uint32{br >> 8, bg >> 8, bb >> 8}
+
+	for i := 0; i < n; i++ {
+		p := pix[i*channels : (i+1)*channels]
+		var c [3]uint32
+		if channels == 1 {
+			c = [3]uint32{uint32(p[0]), uint32(p[0]), uint32(p[0])}
+		} else {
+			c = [3]uint32{uint32(p[0]), uint32(p[1]), uint32(p[2])}
+		}
+		if channels == 4 {
+			a := uint32(p[3])
+			for k := range c {
+				c[k] += ((255-a)*bgc[k] + 127) / 255
+			}
+		}
+
+		switch format {
+		case PixelFormatGray:
+			// same weights as color.GrayModel
+			out[i] = uint8((19595*c[0] + 38470*c[1] + 7471*c[2] + 1<<15) >> 16)
+		case PixelFormatRGB:
+			out[3*i], out[3*i+1], out[3*i+2] = uint8(c[0]), uint8(c[1]), uint8(c[2])
+		case PixelFormatRGBA:
+			out[4*i], out[4*i+1], out[4*i+2], out[4*i+3] = uint8(c[0]), uint8(c[1]), uint8(c[2]), 255
+		}
+	}
+
+	return out
+}
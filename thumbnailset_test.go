@@ -0,0 +1,117 @@
+package ippresize
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"testing"
+)
+
+// meanDiff returns the mean absolute difference of the pixel buffers
+func meanDiff(a, b []uint8) float64 {
+	var sum int
+	for i := range a {
+		d := int(a[i]) - int(b[i])
+		if d < 0 {
+			d = -d
+		}
+		sum += d
+	}
+	return float64(sum) / float64(len(a))
+}
+
+func TestThumbnailSet(t *testing.T) {
+	data, err := os.ReadFile("./test.jpg")
+	if err != nil {
+		t.Fatalf("os.ReadFile() failed: %v", err)
+	}
+
+	specs := []Spec{
+		{Size: image.Point{64, 64}},
+		{Size: image.Point{256, 256}},
+		{Size: image.Point{128, 128}, Options: []Option{WithPadding([]uint8{255, 0, 0})}},
+		{Size: image.Point{50, 50}, Fit: FitCover, Format: PixelFormatGray},
+		{Size: image.Point{100, 0}, Format: PixelFormatRGBA, Options: []Option{WithInterpolation(InterpolationSuper)}},
+	}
+
+	resizer := NewResizer()
+	defer resizer.Close()
+
+	// without prescaling the image is decoded at the same scale as by Thumbnail()
+	decode_opts := &DecodeOptions{MaxPrescale: 1}
+
+	for _, opts := range []*SetOptions{{DecodeOptions: decode_opts}, {DecodeOptions: decode_opts, Cascade: true, Resizer: resizer}} {
+		results, err := ThumbnailSet(bytes.NewReader(data), specs, opts)
+		if err != nil {
+			t.Fatalf("ThumbnailSet() failed: %v", err)
+		}
+		if len(results) != len(specs) {
+			t.Fatalf("expected %v results, got %v", len(specs), len(results))
+		}
+
+		for i, spec := range specs {
+			expect, err := Thumbnail(bytes.NewReader(data), append([]Option{WithSize(spec.Size), WithFit(spec.Fit), WithFormat(spec.Format), WithDecodeOptions(decode_opts)}, spec.Options...)...)
+			if err != nil {
+				t.Fatalf("Thumbnail() failed: %v", err)
+			}
+			r := results[i]
+			if r.Size != expect.Size || r.Format != expect.Format || r.Stride != expect.Stride || r.Source != ImageFormatJPEG {
+				t.Errorf("spec %v: expected %v %v, got %v %v", i, expect.Size, expect.Format, r.Size, r.Format)
+				continue
+			}
+			if r.Transform != expect.Transform {
+				t.Errorf("spec %v: expected transform %+v, got %+v", i, expect.Transform, r.Transform)
+			}
+			// cascaded outputs are resized twice, gray output is converted from rgb
+			max_diff := 0.0
+			if opts.Cascade {
+				max_diff = 4
+			} else if spec.Format == PixelFormatGray {
+				max_diff = 1
+			}
+			if d := meanDiff(r.Pix, expect.Pix); d > max_diff {
+				t.Errorf("spec %v (cascade %v): mean difference from Thumbnail() is %v", i, opts.Cascade, d)
+			}
+		}
+	}
+
+	if resizer.Len() == 0 {
+		t.Errorf("resizer cache is not used")
+	}
+
+	// prescaled for the largest output
+	results, err := ThumbnailSet(bytes.NewReader(data), specs, nil)
+	if err != nil {
+		t.Fatalf("ThumbnailSet() failed: %v", err)
+	}
+	for _, r := range results {
+		if r.Transform.DecodedSize != (image.Point{213, 319}) {
+			t.Errorf("unexpected decoded size: %v", r.Transform.DecodedSize)
+		}
+	}
+
+	if _, err := ThumbnailSet(bytes.NewReader(data), nil, nil); err == nil {
+		t.Errorf("empty specs should fail")
+	}
+
+	if _, err := ThumbnailSet(bytes.NewReader(data), []Spec{{Format: PixelFormat(10)}}, nil); err == nil {
+		t.Errorf("invalid format should fail")
+	}
+}
+
+func TestConvertPixels(t *testing.T) {
+	rgba := []uint8{128, 0, 0, 128, 10, 20, 30, 255}
+	if got := convertPixels(rgba, 4, PixelFormatRGB, (*DecodeOptions)(nil).background()); !bytes.Equal(got, []uint8{255, 127, 127, 10, 20, 30}) {
+		t.Errorf("unexpected rgb: %v", got)
+	}
+	if got := convertPixels([]uint8{200, 200, 200}, 3, PixelFormatGray, (*DecodeOptions)(nil).background()); !bytes.Equal(got, []uint8{200}) {
+		t.Errorf("unexpected gray: %v", got)
+	}
+
+	if got := expandPadColor(nil, 3, 4); !bytes.Equal(got, []uint8{128, 128, 128, 255}) {
+		t.Errorf("unexpected pad color: %v", got)
+	}
+	if got := expandPadColor([]uint8{7}, 1, 3); !bytes.Equal(got, []uint8{7, 7, 7}) {
+		t.Errorf("unexpected pad color: %v", got)
+	}
+}
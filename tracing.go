@@ -0,0 +1,46 @@
+package ippresize
+
+import (
+	"context"
+	"image"
+)
+
+// Span is an operation traced by Tracer
+type Span interface {
+	SetAttribute(key string, value interface{})
+	// End finishes the span, err is the outcome of the operation
+	End(err error)
+}
+
+// Tracer starts the spans of the processing stages: "decode", "resize" and "encode".
+// The context returned by Start carries the new span and is passed to the nested operations.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+type tracerKey struct{}
+
+// WithTracer returns the context making ...Context functions trace with the tracer
+func WithTracer(ctx context.Context, tracer Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, tracer)
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(key string, value interface{}) {}
+func (noopSpan) End(err error)                              {}
+
+// startSpan starts the span with the tracer of the context, it does nothing without a tracer
+func startSpan(ctx context.Context, name string) (context.Context, Span) {
+	tracer, _ := ctx.Value(tracerKey{}).(Tracer)
+	if tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return tracer.Start(ctx, name)
+}
+
+// setSizeAttributes sets prefix.width and prefix.height attributes
+func setSizeAttributes(span Span, prefix string, size image.Point) {
+	span.SetAttribute(prefix+".width", size.X)
+	span.SetAttribute(prefix+".height", size.Y)
+}
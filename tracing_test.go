@@ -0,0 +1,108 @@
+package ippresize
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"os"
+	"sync"
+	"testing"
+)
+
+type recordedSpan struct {
+	name       string
+	parent     *recordedSpan
+	attributes map[string]interface{}
+	ended      bool
+	err        error
+}
+
+func (s *recordedSpan) SetAttribute(key string, value interface{}) {
+	s.attributes[key] = value
+}
+
+func (s *recordedSpan) End(err error) {
+	s.ended, s.err = true, err
+}
+
+type spanKey struct{}
+
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	parent, _ := ctx.Value(spanKey{}).(*recordedSpan)
+	span := &recordedSpan{name: name, parent: parent, attributes: make(map[string]interface{})}
+	t.mu.Lock()
+	t.spans = append(t.spans, span)
+	t.mu.Unlock()
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func TestTracer(t *testing.T) {
+	data, err := os.ReadFile("./test.jpg")
+	if err != nil {
+		t.Fatalf("os.ReadFile() failed: %v", err)
+	}
+
+	tracer := &recordingTracer{}
+	root, _ := tracer.Start(context.Background(), "request")
+	ctx := WithTracer(root, tracer)
+
+	r, err := ThumbnailContext(ctx, bytes.NewReader(data), WithSize(image.Point{100, 100}), WithFit(FitCover), WithInterpolation(InterpolationLanczos))
+	if err != nil {
+		t.Fatalf("ThumbnailContext() failed: %v", err)
+	}
+
+	if len(tracer.spans) != 3 {
+		t.Fatalf("expected request, decode and resize spans, got %v", len(tracer.spans))
+	}
+	decode, resize := tracer.spans[1], tracer.spans[2]
+	if decode.name != "decode" || resize.name != "resize" || decode.parent != tracer.spans[0] || resize.parent != tracer.spans[0] {
+		t.Fatalf("unexpected spans: %+v %+v", decode, resize)
+	}
+	if !decode.ended || !resize.ended || decode.err != nil || resize.err != nil {
+		t.Errorf("spans should be ended without error")
+	}
+	if decode.attributes["format"] != "JPEG" || decode.attributes["source.width"] != r.Transform.OrigSize.X ||
+		decode.attributes["decoded.height"] != r.Transform.DecodedSize.Y {
+		t.Errorf("unexpected decode attributes: %v", decode.attributes)
+	}
+	if resize.attributes["target.width"] != 100 || resize.attributes["target.height"] != 100 ||
+		resize.attributes["interpolation"] != "Lanczos" || resize.attributes["channels"] != 3 {
+		t.Errorf("unexpected resize attributes: %v", resize.attributes)
+	}
+
+	tracer.spans = nil
+	var buf bytes.Buffer
+	if _, err := ResizeJpegContext(ctx, bytes.NewReader(data), &buf, image.Point{60, 0}, nil); err != nil {
+		t.Fatalf("ResizeJpegContext() failed: %v", err)
+	}
+	var names []string
+	for _, span := range tracer.spans {
+		names = append(names, span.name)
+	}
+	if len(names) < 3 || names[0] != "decode" || names[1] != "resize" || names[len(names)-1] != "encode" {
+		t.Fatalf("unexpected spans: %v", names)
+	}
+	if encode := tracer.spans[len(names)-1]; !encode.ended || encode.attributes["target.width"] != 60 || encode.attributes["format"] != "JPEG" {
+		t.Errorf("unexpected encode span: %+v", encode)
+	}
+
+	// failures end the spans with the error
+	tracer.spans = nil
+	if _, err := ThumbnailContext(ctx, bytes.NewReader([]byte("garbage"))); err == nil {
+		t.Fatalf("garbage should fail")
+	}
+	if len(tracer.spans) != 1 || tracer.spans[0].err == nil {
+		t.Errorf("decode span should end with the error")
+	}
+
+	// nothing is traced without the tracer in the context
+	tracer.spans = nil
+	if _, err := ThumbnailContext(root, bytes.NewReader(data), WithSize(image.Point{100, 100})); err != nil || len(tracer.spans) != 0 {
+		t.Errorf("unexpected spans: %v", err)
+	}
+}
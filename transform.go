@@ -0,0 +1,94 @@
+package ippresize
+
+import (
+	"image"
+	"math"
+)
+
+// Transform describes the geometry of a resize operation: a point (x, y) of the original image
+// lands at (x*ScaleX + OffsetX, y*ScaleY + OffsetY) in the output image.
+// Coordinates are continuous, pixel (i, j) covers the square [i, i+1) x [j, j+1).
+// For jpeg images the original image is taken in display orientation, after Orientation is applied,
+// use Orientation.Point() to map coordinates of the image as stored in the jpeg stream.
+type Transform struct {
+	OrigSize    image.Point     // size of the original image, in display orientation
+	DecodedSize image.Point     // size of the decoded image, after libjpeg DCT prescaling, in display orientation
+	OutSize     image.Point     // size of the output image, including padding
+	Orientation Orientation     // exif orientation of the jpeg image, zero for other sources
+	Crop        image.Rectangle // rectangle of the original image resized to the output, e.g. the one chosen by GravitySmart
+
+	ScaleX, ScaleY   float64
+	OffsetX, OffsetY float64
+}
+
+// newTransform returns the transform for a resize of src rectangle of the image with in_size dimensions
+// into dst rectangle of the output image with out_size dimensions
+func newTransform(in_size image.Point, src image.Rectangle, dst image.Rectangle, out_size image.Point) Transform {
+	scale_x := float64(dst.Dx()) / float64(src.Dx())
+	scale_y := float64(dst.Dy()) / float64(src.Dy())
+	return Transform{
+		OrigSize:    in_size,
+		DecodedSize: in_size,
+		OutSize:     out_size,
+		Crop:        src,
+		ScaleX:      scale_x,
+		ScaleY:      scale_y,
+		OffsetX:     float64(dst.Min.X) - float64(src.Min.X)*scale_x,
+		OffsetY:     float64(dst.Min.Y) - float64(src.Min.Y)*scale_y,
+	}
+}
+
+// rebase makes the transform map coordinates of the original image of orig_size dimensions
+// instead of the decoded one
+func (t *Transform) rebase(orig_size image.Point) {
+	fx := float64(orig_size.X) / float64(t.DecodedSize.X)
+	fy := float64(orig_size.Y) / float64(t.DecodedSize.Y)
+	t.ScaleX /= fx
+	t.ScaleY /= fy
+	t.OrigSize = orig_size
+	t.Crop = coveringRect(float64(t.Crop.Min.X)*fx, float64(t.Crop.Min.Y)*fy, float64(t.Crop.Max.X)*fx, float64(t.Crop.Max.Y)*fy).
+		Intersect(image.Rectangle{Max: orig_size})
+}
+
+// ToOutput maps a point of the original image to the output image
+func (t Transform) ToOutput(x, y float64) (float64, float64) {
+	return x*t.ScaleX + t.OffsetX, y*t.ScaleY + t.OffsetY
+}
+
+// ToSource maps a point of the output image back to the original image
+func (t Transform) ToSource(x, y float64) (float64, float64) {
+	return (x - t.OffsetX) / t.ScaleX, (y - t.OffsetY) / t.ScaleY
+}
+
+func (t Transform) PointToOutput(p image.Point) image.Point {
+	x, y := t.ToOutput(float64(p.X), float64(p.Y))
+	return image.Point{int(math.Round(x)), int(math.Round(y))}
+}
+
+func (t Transform) PointToSource(p image.Point) image.Point {
+	x, y := t.ToSource(float64(p.X), float64(p.Y))
+	return image.Point{int(math.Round(x)), int(math.Round(y))}
+}
+
+// RectToOutput returns the smallest rectangle of the output image covering r, clipped to the output bounds
+func (t Transform) RectToOutput(r image.Rectangle) image.Rectangle {
+	x0, y0 := t.ToOutput(float64(r.Min.X), float64(r.Min.Y))
+	x1, y1 := t.ToOutput(float64(r.Max.X), float64(r.Max.Y))
+	return coveringRect(x0, y0, x1, y1).Intersect(image.Rectangle{Max: t.OutSize})
+}
+
+// RectToSource returns the smallest rectangle of the original image covering r, clipped to the original bounds
+func (t Transform) RectToSource(r image.Rectangle) image.Rectangle {
+	x0, y0 := t.ToSource(float64(r.Min.X), float64(r.Min.Y))
+	x1, y1 := t.ToSource(float64(r.Max.X), float64(r.Max.Y))
+	return coveringRect(x0, y0, x1, y1).Intersect(image.Rectangle{Max: t.OrigSize})
+}
+
+func coveringRect(x0, y0, x1, y1 float64) image.Rectangle {
+	// eps keeps exact pixel borders from growing by a pixel due to floating point errors
+	const eps = 1e-6
+	return image.Rect(
+		int(math.Floor(x0+eps)), int(math.Floor(y0+eps)),
+		int(math.Ceil(x1-eps)), int(math.Ceil(y1-eps)),
+	).Canon()
+}
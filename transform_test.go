@@ -0,0 +1,84 @@
+package ippresize
+
+import (
+	"image"
+	"math"
+	"os"
+	"testing"
+)
+
+func TestTransformPad(t *testing.T) {
+	in := make([]uint8, 640*480)
+	var transform Transform
+	_, out_size, err := ResizePad(in, 640, image.Point{640, 480}, 1, image.Point{160, 160}, []uint8{0}, GravityCenter, InterpolationLinear, &transform)
+	if err != nil {
+		t.Fatalf("ResizePad() failed: %v", err)
+	}
+
+	if out_size != transform.OutSize {
+		t.Errorf("expected OutSize %v, got %v", out_size, transform.OutSize)
+	}
+
+	tests := []struct {
+		src, out image.Point
+	}{
+		{image.Point{0, 0}, image.Point{0, 20}},
+		{image.Point{640, 480}, image.Point{160, 140}},
+		{image.Point{320, 240}, image.Point{80, 80}},
+	}
+	for _, item := range tests {
+		if p := transform.PointToOutput(item.src); p != item.out {
+			t.Errorf("PointToOutput(%v): expected %v, got %v", item.src, item.out, p)
+		}
+		if p := transform.PointToSource(item.out); p != item.src {
+			t.Errorf("PointToSource(%v): expected %v, got %v", item.out, item.src, p)
+		}
+	}
+
+	if r := transform.RectToOutput(image.Rect(0, 0, 640, 480)); r != image.Rect(0, 20, 160, 140) {
+		t.Errorf("RectToOutput(): unexpected %v", r)
+	}
+	if r := transform.RectToSource(image.Rect(0, 0, 160, 160)); r != image.Rect(0, 0, 640, 480) {
+		t.Errorf("RectToSource(): unexpected %v", r)
+	}
+	if r := transform.RectToSource(image.Rect(1, 21, 2, 22)); r != image.Rect(4, 4, 8, 8) {
+		t.Errorf("RectToSource(): unexpected %v", r)
+	}
+}
+
+func TestTransformJpeg(t *testing.T) {
+	reader, err := os.Open("./test.jpg")
+	if err != nil {
+		t.Fatalf("os.Open() failed: %v", err)
+	}
+	defer reader.Close()
+
+	var transform Transform
+	box := image.Point{100, 100}
+	_, err = JpegToPaddedRGB(reader, box, []uint8{0, 0, 0}, GravityCenter, InterpolationLinear, &transform)
+	if err != nil {
+		t.Fatalf("JpegToPaddedRGB() failed: %v", err)
+	}
+
+	if transform.OrigSize != (image.Point{566, 850}) {
+		t.Fatalf("unexpected OrigSize: %v", transform.OrigSize)
+	}
+	// the decoded image must have at least the resolution of the resized one
+	if transform.DecodedSize.Y < box.Y || transform.DecodedSize.X > transform.OrigSize.X {
+		t.Errorf("unexpected DecodedSize: %v", transform.DecodedSize)
+	}
+
+	x0, y0 := transform.ToOutput(0, 0)
+	x1, y1 := transform.ToOutput(566, 850)
+	if math.Abs(y0) > 1e-9 || math.Abs(y1-100) > 1e-9 {
+		t.Errorf("image should span the full height of the box: y0=%v, y1=%v", y0, y1)
+	}
+	if math.Abs(x0+x1-100) > 1 {
+		t.Errorf("image should be centered horizontally: x0=%v, x1=%v", x0, x1)
+	}
+
+	x, y := transform.ToSource(transform.ToOutput(123, 456))
+	if math.Abs(x-123) > 1e-9 || math.Abs(y-456) > 1e-9 {
+		t.Errorf("round trip failed: %v, %v", x, y)
+	}
+}
@@ -0,0 +1,104 @@
+// Package urlsign signs the paths of the thumbnail server URLs with HMAC-SHA256.
+//
+// A signed path is the path prefixed with the signature segment:
+//
+//	/<signature>/w_320,h_240,fit_cover/path/to/image.jpg
+//
+// where the signature is unpadded base64url of HMAC-SHA256 of the unescaped path following it.
+package urlsign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// Signer signs paths with the first of its keys and accepts signatures made with any of them,
+// so a key is rotated by putting the new key first and removing the old one when its URLs are not used anymore
+type Signer struct {
+	keys [][]byte
+}
+
+// New returns a signer with the keys, the first one is used for signing
+func New(keys ...[]byte) (*Signer, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no keys")
+	}
+	for i, key := range keys {
+		if len(key) == 0 {
+			return nil, fmt.Errorf("key %v is empty", i)
+		}
+	}
+	return &Signer{keys: keys}, nil
+}
+
+// ParseKeys parses comma separated hex encoded keys
+func ParseKeys(s string) ([][]byte, error) {
+	var keys [][]byte
+	for i, k := range strings.Split(s, ",") {
+		key, err := hex.DecodeString(strings.TrimSpace(k))
+		if err != nil || len(key) == 0 {
+			return nil, fmt.Errorf("key %v is not a valid hex string", i)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func sign(key []byte, path string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(path))
+	return mac.Sum(nil)
+}
+
+// Sign returns the signature of the path
+func (s *Signer) Sign(path string) string {
+	return base64.RawURLEncoding.EncodeToString(sign(s.keys[0], path))
+}
+
+// SignPath returns the path prefixed with its signature, the path must start with a slash
+func (s *Signer) SignPath(path string) string {
+	return "/" + s.Sign(path) + path
+}
+
+// URL returns the escaped URL of the signed path on the server with the base URL, e.g. "https://thumbs.example.com"
+func (s *Signer) URL(base string, path string) string {
+	return strings.TrimSuffix(base, "/") + (&url.URL{Path: s.SignPath(path)}).EscapedPath()
+}
+
+// Verify checks the signature of the path against all the keys
+func (s *Signer) Verify(path string, signature string) bool {
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || len(mac) != sha256.Size {
+		return false
+	}
+	for _, key := range s.keys {
+		if hmac.Equal(mac, sign(key, path)) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyPath checks the signed path and returns the path without the signature
+func (s *Signer) VerifyPath(signed string) (string, error) {
+	if !strings.HasPrefix(signed, "/") {
+		return "", ErrInvalidSignature
+	}
+	i := strings.IndexByte(signed[1:], '/')
+	if i < 0 {
+		return "", ErrInvalidSignature
+	}
+	signature, path := signed[1:i+1], signed[i+1:]
+	if !s.Verify(path, signature) {
+		return "", ErrInvalidSignature
+	}
+	return path, nil
+}
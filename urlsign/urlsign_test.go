@@ -0,0 +1,80 @@
+package urlsign
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSigner(t *testing.T) {
+	old_key := []byte("old secret")
+	new_key := []byte("new secret")
+
+	old_signer, err := New(old_key)
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	signer, err := New(new_key, old_key)
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	path := "/w_320,h_240,fit_cover/photos/a b.jpg"
+
+	signed := signer.SignPath(path)
+	if !strings.HasSuffix(signed, path) || strings.Count(signed, "/") != strings.Count(path, "/")+1 {
+		t.Fatalf("unexpected signed path: %v", signed)
+	}
+	if p, err := signer.VerifyPath(signed); err != nil || p != path {
+		t.Errorf("VerifyPath() returned %q, %v", p, err)
+	}
+
+	// paths signed with the old key are still accepted, the new key is not known to the old signer
+	if _, err := signer.VerifyPath(old_signer.SignPath(path)); err != nil {
+		t.Errorf("old signature should be accepted: %v", err)
+	}
+	if _, err := old_signer.VerifyPath(signed); err != ErrInvalidSignature {
+		t.Errorf("new signature should be rejected by the old signer")
+	}
+
+	for _, bad := range []string{
+		"",
+		path,
+		"/" + signer.Sign(path),
+		"/" + signer.Sign(path) + "/w_321,h_240,fit_cover/photos/a b.jpg",
+		"/" + signer.Sign(path)[1:] + path,
+		"/!!!" + path,
+	} {
+		if _, err := signer.VerifyPath(bad); err != ErrInvalidSignature {
+			t.Errorf("%q should be rejected", bad)
+		}
+	}
+
+	u := signer.URL("https://thumbs.example.com/", path)
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Host != "thumbs.example.com" || !strings.Contains(u, "a%20b.jpg") {
+		t.Fatalf("unexpected URL: %v", u)
+	}
+	if p, err := signer.VerifyPath(parsed.Path); err != nil || p != path {
+		t.Errorf("URL path doesn't verify: %q, %v", p, err)
+	}
+
+	if _, err := New(); err == nil {
+		t.Errorf("no keys should fail")
+	}
+	if _, err := New(new_key, nil); err == nil {
+		t.Errorf("empty key should fail")
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	keys, err := ParseKeys("0a0b, ff")
+	if err != nil || len(keys) != 2 || string(keys[0]) != "\x0a\x0b" || string(keys[1]) != "\xff" {
+		t.Errorf("unexpected keys: %v, %v", keys, err)
+	}
+	for _, s := range []string{"", "0a,", "xyz"} {
+		if _, err := ParseKeys(s); err == nil {
+			t.Errorf("%q should fail", s)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+#include <stdio.h>
+#include <string.h>
+
+#include <webp/decode.h>
+#include <webp/encode.h>
+
+#include "image.h"
+
+#define error_code(code, fmt...) ({ \
+	char temp[err_size]; \
+	snprintf(temp, err_size, fmt); temp[err_size - 1] = '\0'; \
+	snprintf(err, err_size, "%s: %s (%d)", temp, image_strerror(code), code); \
+	(code); \
+})
+
+
+int image_webp_get_features(const unsigned char *data, size_t data_size, unsigned *w, unsigned *h, int *has_alpha, char *err, size_t err_size)
+{
+	WebPBitstreamFeatures features;
+
+	VP8StatusCode status = WebPGetFeatures(data, data_size, &features);
+
+	if (status != VP8_STATUS_OK) {
+		return error_code(IMAGE_ERR_WEBP_DECODE_FAILED, "WebPGetFeatures() failed, status=%d", status);
+	}
+
+	*w = features.width;
+	*h = features.height;
+	*has_alpha = features.has_alpha;
+
+	return 0;
+}
+
+
+/* decodes the image scaled to out->w x out->h, rgb for 3 channels, rgba with premultiplied alpha for 4 channels */
+int image_webp_decode(const unsigned char *data, size_t data_size, struct image_s *out, unsigned char *out_data, int no_fancy_upsampling, char *err, size_t err_size)
+{
+	if (out->channels != 3 && out->channels != 4) {
+		return error_code(IMAGE_ERR_INVALID_NUMBER_CHANNELS, "out->channels=%u", out->channels);
+	}
+
+	if (out_data == NULL) {
+		return error_code(IMAGE_ERR_OUT_IMAGE_UNALLOCATED, "out_data == NULL");
+	}
+
+	WebPDecoderConfig config;
+
+	if (!WebPInitDecoderConfig(&config)) {
+		return error_code(IMAGE_ERR_WEBP_DECODE_FAILED, "WebPInitDecoderConfig() failed");
+	}
+
+	VP8StatusCode status = WebPGetFeatures(data, data_size, &config.input);
+
+	if (status != VP8_STATUS_OK) {
+		return error_code(IMAGE_ERR_WEBP_DECODE_FAILED, "WebPGetFeatures() failed, status=%d", status);
+	}
+
+	if (out->w != (unsigned) config.input.width || out->h != (unsigned) config.input.height) {
+		config.options.use_scaling = 1;
+		config.options.scaled_width = out->w;
+		config.options.scaled_height = out->h;
+	}
+
+	config.options.no_fancy_upsampling = no_fancy_upsampling;
+
+	config.output.colorspace = out->channels == 3 ? MODE_RGB : MODE_rgbA;
+	config.output.is_external_memory = 1;
+	config.output.u.RGBA.rgba = out_data;
+	config.output.u.RGBA.stride = out->rowstep;
+	config.output.u.RGBA.size = out->rowstep * out->h;
+
+	status = WebPDecode(data, data_size, &config);
+
+	/* no-op for external memory, but keeps the decoder contract */
+	WebPFreeDecBuffer(&config.output);
+
+	if (status != VP8_STATUS_OK) {
+		return error_code(IMAGE_ERR_WEBP_DECODE_FAILED, "WebPDecode() failed, status=%d, scaled={width: %u, height: %u}", status, out->w, out->h);
+	}
+
+	return 0;
+}
+
+
+/* encodes rgb or rgba image with non-premultiplied alpha, the output is freed with image_webp_free() */
+int image_webp_encode(const struct image_s *in, const unsigned char *in_data, float quality, int lossless, int method, unsigned char **out_data, size_t *out_size, char *err, size_t err_size)
+{
+	if (in->channels != 3 && in->channels != 4) {
+		return error_code(IMAGE_ERR_INVALID_NUMBER_CHANNELS, "in->channels=%u", in->channels);
+	}
+
+	WebPConfig config;
+
+	if (!WebPConfigInit(&config)) {
+		return error_code(IMAGE_ERR_WEBP_ENCODE_FAILED, "WebPConfigInit() failed");
+	}
+
+	config.quality = quality;
+	config.lossless = lossless;
+	config.method = method;
+
+	if (!WebPValidateConfig(&config)) {
+		return error_code(IMAGE_ERR_WEBP_ENCODE_FAILED, "WebPValidateConfig() failed, quality=%f, lossless=%d, method=%d", quality, lossless, method);
+	}
+
+	WebPPicture picture;
+
+	if (!WebPPictureInit(&picture)) {
+		return error_code(IMAGE_ERR_WEBP_ENCODE_FAILED, "WebPPictureInit() failed");
+	}
+
+	picture.width = in->w;
+	picture.height = in->h;
+	picture.use_argb = lossless;
+
+	int ok = in->channels == 3 ?
+		WebPPictureImportRGB(&picture, in_data, in->rowstep) :
+		WebPPictureImportRGBA(&picture, in_data, in->rowstep);
+
+	if (!ok) {
+		WebPPictureFree(&picture);
+		return error_code(IMAGE_ERR_MEMORY_ALLOCATION_FAILED, "WebPPictureImport() failed, {width: %u, height: %u}", in->w, in->h);
+	}
+
+	WebPMemoryWriter writer;
+	WebPMemoryWriterInit(&writer);
+	picture.writer = WebPMemoryWrite;
+	picture.custom_ptr = &writer;
+
+	ok = WebPEncode(&config, &picture);
+
+	WebPEncodingError encoding_error = picture.error_code;
+	WebPPictureFree(&picture);
+
+	if (!ok) {
+		WebPMemoryWriterClear(&writer);
+		return error_code(IMAGE_ERR_WEBP_ENCODE_FAILED, "WebPEncode() failed, error_code=%d", encoding_error);
+	}
+
+	*out_data = writer.mem;
+	*out_size = writer.size;
+
+	return 0;
+}
+
+
+void image_webp_free(void *ptr)
+{
+	WebPFree(ptr);
+}
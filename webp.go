@@ -0,0 +1,263 @@
+package ippresize
+
+/*
+#include <stdlib.h>
+#include "image.h"
+#cgo pkg-config: libwebp
+*/
+import "C"
+
+import (
+	"bytes"
+	"github.com/anight/go-libjpeg/jpeg"
+	"github.com/anight/go-libjpeg/rgb"
+	"image"
+	"io"
+	"math"
+	"runtime"
+	"unsafe"
+)
+
+// WebPOptions control WebP encoding, nil means defaults
+type WebPOptions struct {
+	Quality  float32 // 1..100, for lossless it is the compression effort, 0 means 75 like for JpegOptions
+	Lossless bool
+	Method   int // speed/size trade-off from 1 (fastest) to 6 (slowest, smallest), 0 means 4
+}
+
+// webpFeatures returns the size of the WebP image and whether it has alpha channel
+func webpFeatures(data []byte) (size image.Point, has_alpha bool, err error) {
+	if len(data) == 0 {
+		err = NewError(0, "empty WebP data")
+		return
+	}
+
+	var w, h C.uint
+	var alpha C.int
+
+	const err_size = 1024
+	var cerr [err_size]C.char
+
+	data_ptr := (*C.uchar)(unsafe.Pointer(&data[0]))
+
+	ret := C.image_webp_get_features(data_ptr, C.size_t(len(data)), &w, &h, &alpha, &cerr[0], err_size)
+
+	runtime.KeepAlive(data)
+
+	if ret != 0 {
+		err = NewError(int(ret), "C.image_webp_get_features() failed: %v", C.GoString(&cerr[0]))
+		return
+	}
+
+	return image.Point{int(w), int(h)}, alpha != 0, nil
+}
+
+// webpScaledSize returns the smallest size of the image not smaller than target, keeping the aspect ratio.
+// The image is never enlarged.
+func webpScaledSize(size image.Point, target image.Point) image.Point {
+	if target.X <= 0 && target.Y <= 0 {
+		return size
+	}
+
+	scale := math.Max(float64(target.X)/float64(size.X), float64(target.Y)/float64(size.Y))
+	if scale >= 1 {
+		return size
+	}
+
+	return image.Point{
+		X: clampInt(int(math.Ceil(float64(size.X)*scale)), 1, size.X),
+		Y: clampInt(int(math.Ceil(float64(size.Y)*scale)), 1, size.Y),
+	}
+}
+
+// DecodeWebP works like Decode() for WebP images: libwebp scales the image to the smallest size covering bbox
+func DecodeWebP(reader io.Reader, colorspace jpeg.OutColorSpace, bbox image.Point) (image.Image, error) {
+	return DecodeWebPWithOptions(reader, colorspace, bbox, nil)
+}
+
+// DecodeWebPWithOptions works like DecodeWebP() with the given options, alpha channel is handled like DecodeAnyWithOptions() does
+func DecodeWebPWithOptions(reader io.Reader, colorspace jpeg.OutColorSpace, bbox image.Point, opts *DecodeOptions) (image.Image, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	return decodeWebP(data, colorspace, bbox, opts)
+}
+
+func decodeWebP(data []byte, colorspace jpeg.OutColorSpace, target image.Point, opts *DecodeOptions) (image.Image, error) {
+	orig_size, has_alpha, err := webpFeatures(data)
+	if err != nil {
+		return nil, err
+	}
+
+	size := webpScaledSize(orig_size, target)
+
+	channels := 3
+	if has_alpha || colorspace == jpeg.OutColorSpaceRGBA {
+		channels = 4
+	}
+
+	stride := channels * size.X
+	pix := make([]uint8, stride*size.Y)
+
+	var img C.struct_image_s
+	img.w = C.uint(size.X)
+	img.h = C.uint(size.Y)
+	img.channels = C.uint(channels)
+	img.rowstep = C.size_t(stride)
+	img_data := (*C.uchar)(unsafe.Pointer(&pix[0]))
+	data_ptr := (*C.uchar)(unsafe.Pointer(&data[0]))
+
+	no_fancy_upsampling := 0
+	if opts != nil && opts.DisableFancyUpsampling {
+		no_fancy_upsampling = 1
+	}
+
+	const err_size = 1024
+	var cerr [err_size]C.char
+
+	ret := C.image_webp_decode(data_ptr, C.size_t(len(data)), &img, img_data, C.int(no_fancy_upsampling), &cerr[0], err_size)
+
+	/* make 100% sure garbage collector wont kill these objects in the middle of execution of c function */
+	runtime.KeepAlive(data)
+	runtime.KeepAlive(img)
+	runtime.KeepAlive(img_data)
+
+	if ret != 0 {
+		return nil, NewError(int(ret), "C.image_webp_decode() failed: %v", C.GoString(&cerr[0]))
+	}
+
+	rect := image.Rectangle{Max: size}
+
+	if channels == 3 {
+		im := &rgb.Image{Pix: pix, Stride: stride, Rect: rect}
+		if colorspace == jpeg.OutColorSpaceGray {
+			return normalizeImage(im, colorspace, opts.background()), nil
+		}
+		return im, nil
+	}
+
+	// libwebp premultiplies alpha the same way image.RGBA does
+	im := &image.RGBA{Pix: pix, Stride: stride, Rect: rect}
+	if colorspace == jpeg.OutColorSpaceRGBA || colorspace == jpeg.OutColorSpaceSame {
+		return im, nil
+	}
+	return normalizeImage(im, colorspace, opts.background()), nil
+}
+
+// EncodeWebP encodes the image with 3 (RGB) or 4 (RGBA with premultiplied alpha, like image.RGBA) channels,
+// gray images are expanded to RGB
+func EncodeWebP(writer io.Writer, pix []uint8, stride int, size image.Point, channels int, opts *WebPOptions) error {
+	s := startStage()
+	err := encodeWebP(writer, pix, stride, size, channels, opts)
+	s.encoded(ImageFormatWebP, size, err)
+	return err
+}
+
+func encodeWebP(writer io.Writer, pix []uint8, stride int, size image.Point, channels int, opts *WebPOptions) error {
+
+	if size.X <= 0 || size.Y <= 0 {
+		return NewError(0, "one of the image dimensions is invalid: {width: %v, height: %v}", size.X, size.Y)
+	}
+
+	if channels != 1 && channels != 3 && channels != 4 {
+		return NewError(0, "invalid number of channels: %v", channels)
+	}
+
+	if len(pix) < stride*(size.Y-1)+channels*size.X {
+		return NewError(0, "image buffer size doesn't match image dimensions: {width: %v, height: %v, channels: %v}, len=%v",
+			size.X, size.Y, channels, len(pix))
+	}
+
+	quality, lossless, method := float32(75), 0, 4
+	if opts != nil {
+		if opts.Quality != 0 {
+			quality = opts.Quality
+		}
+		if opts.Lossless {
+			lossless = 1
+		}
+		if opts.Method != 0 {
+			method = opts.Method
+		}
+	}
+
+	// 0 is taken by the default, so the range starts at 1 as for jpeg
+	if quality < 1 || quality > 100 {
+		return NewError(0, "invalid WebP quality: %v", quality)
+	}
+
+	// libwebp takes gray pixels as rgb and rgba pixels with straight alpha
+	switch channels {
+	case 1:
+		pix, stride, channels = grayToRGB(pix, stride, size), 3*size.X, 3
+	case 4:
+		pix, stride = unpremultiply(pix, stride, size), 4*size.X
+	}
+
+	var img C.struct_image_s
+	img.w = C.uint(size.X)
+	img.h = C.uint(size.Y)
+	img.channels = C.uint(channels)
+	img.rowstep = C.size_t(stride)
+	img_data := (*C.uchar)(unsafe.Pointer(&pix[0]))
+
+	var out *C.uchar
+	var out_size C.size_t
+
+	const err_size = 1024
+	var cerr [err_size]C.char
+
+	ret := C.image_webp_encode(&img, img_data, C.float(quality), C.int(lossless), C.int(method), &out, &out_size, &cerr[0], err_size)
+
+	/* make 100% sure garbage collector wont kill these objects in the middle of execution of c function */
+	runtime.KeepAlive(img)
+	runtime.KeepAlive(img_data)
+
+	if ret != 0 {
+		return NewError(int(ret), "C.image_webp_encode() failed: %v", C.GoString(&cerr[0]))
+	}
+
+	defer C.image_webp_free(unsafe.Pointer(out))
+
+	_, err := writer.Write(C.GoBytes(unsafe.Pointer(out), C.int(out_size)))
+	return err
+}
+
+func grayToRGB(pix []uint8, stride int, size image.Point) []uint8 {
+	out := make([]uint8, 3*size.X*size.Y)
+	for y := 0; y < size.Y; y++ {
+		row := pix[y*stride : y*stride+size.X]
+		o := out[3*size.X*y:]
+		for x, v := range row {
+			o[3*x], o[3*x+1], o[3*x+2] = v, v, v
+		}
+	}
+	return out
+}
+
+func unpremultiply(pix []uint8, stride int, size image.Point) []uint8 {
+	out := make([]uint8, 4*size.X*size.Y)
+	for y := 0; y < size.Y; y++ {
+		copy(out[4*size.X*y:4*size.X*(y+1)], pix[y*stride:])
+	}
+	for i := 0; i < len(out); i += 4 {
+		a := uint32(out[i+3])
+		if a == 0 || a == 255 {
+			continue
+		}
+		for k := 0; k < 3; k++ {
+			v := (uint32(out[i+k])*255 + a/2) / a
+			if v > 255 {
+				v = 255
+			}
+			out[i+k] = uint8(v)
+		}
+	}
+	return out
+}
+
+// isWebP reports whether data is a WebP image
+func isWebP(data []byte) bool {
+	return len(data) >= 12 && bytes.Equal(data[:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WEBP"))
+}
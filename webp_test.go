@@ -0,0 +1,124 @@
+package ippresize
+
+import (
+	"bytes"
+	"github.com/anight/go-libjpeg/jpeg"
+	"github.com/anight/go-libjpeg/rgb"
+	"image"
+	"testing"
+)
+
+func TestWebPScaledSize(t *testing.T) {
+	tests := []struct {
+		size, target, expected image.Point
+	}{
+		{image.Point{800, 600}, image.Point{}, image.Point{800, 600}},
+		{image.Point{800, 600}, image.Point{100, 100}, image.Point{134, 100}},
+		{image.Point{800, 600}, image.Point{400, 0}, image.Point{400, 300}},
+		{image.Point{800, 600}, image.Point{1000, 1000}, image.Point{800, 600}},
+	}
+	for _, item := range tests {
+		if size := webpScaledSize(item.size, item.target); size != item.expected {
+			t.Errorf("webpScaledSize(%v, %v): expected %v, got %v", item.size, item.target, item.expected, size)
+		}
+	}
+}
+
+func TestWebP(t *testing.T) {
+	size := image.Point{64, 48}
+	pix := make([]uint8, 3*size.X*size.Y)
+	for i := range pix {
+		pix[i] = uint8(i * 7)
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeWebP(&buf, pix, 3*size.X, size, 3, &WebPOptions{Lossless: true, Method: 6}); err != nil {
+		t.Fatalf("EncodeWebP() failed: %v", err)
+	}
+	data := buf.Bytes()
+
+	if format := SniffFormat(data); format != ImageFormatWebP {
+		t.Fatalf("unexpected format: %v", format)
+	}
+
+	im, err := DecodeWebP(bytes.NewReader(data), jpeg.OutColorSpaceRGB, image.Point{})
+	if err != nil {
+		t.Fatalf("DecodeWebP() failed: %v", err)
+	}
+	if i := im.(*rgb.Image); i.Rect.Max != size || !bytes.Equal(i.Pix, pix) {
+		t.Errorf("lossless round trip failed")
+	}
+
+	im, format, err := DecodeAny(bytes.NewReader(data), jpeg.OutColorSpaceGray, image.Point{16, 16})
+	if err != nil {
+		t.Fatalf("DecodeAny() failed: %v", err)
+	}
+	if format != ImageFormatWebP || im.Bounds().Size() != (image.Point{22, 16}) {
+		t.Errorf("unexpected result: format=%v, size=%v", format, im.Bounds().Size())
+	}
+	if _, ok := im.(*image.Gray); !ok {
+		t.Errorf("unexpected image type: %T", im)
+	}
+
+	r, err := Thumbnail(bytes.NewReader(data), WithFormat(PixelFormatRGBA), WithSize(image.Point{16, 16}), WithFit(FitCover))
+	if err != nil {
+		t.Fatalf("Thumbnail() failed: %v", err)
+	}
+	if r.Source != ImageFormatWebP || r.Size != (image.Point{16, 16}) || r.Transform.OrigSize != size {
+		t.Errorf("unexpected result: source=%v, size=%v, transform=%+v", r.Source, r.Size, r.Transform)
+	}
+
+	for _, quality := range []float32{101, 0.5, -1} {
+		if err := EncodeWebP(&buf, pix, 3*size.X, size, 3, &WebPOptions{Quality: quality}); err == nil {
+			t.Errorf("invalid quality %v should fail", quality)
+		}
+	}
+
+	var unset, default_quality bytes.Buffer
+	if err := EncodeWebP(&unset, pix, 3*size.X, size, 3, &WebPOptions{}); err != nil {
+		t.Fatalf("EncodeWebP() failed: %v", err)
+	}
+	if err := EncodeWebP(&default_quality, pix, 3*size.X, size, 3, &WebPOptions{Quality: 75}); err != nil {
+		t.Fatalf("EncodeWebP() failed: %v", err)
+	}
+	if !bytes.Equal(unset.Bytes(), default_quality.Bytes()) {
+		t.Errorf("unset quality should mean 75")
+	}
+
+	if _, err := DecodeWebP(bytes.NewReader([]byte("RIFF\x00\x00\x00\x00WEBP")), jpeg.OutColorSpaceRGB, image.Point{}); err == nil {
+		t.Errorf("truncated image should fail")
+	}
+}
+
+func TestWebPAlpha(t *testing.T) {
+	size := image.Point{2, 1}
+	// premultiplied: opaque red, half transparent white
+	pix := []uint8{255, 0, 0, 255, 128, 128, 128, 128}
+
+	var buf bytes.Buffer
+	if err := EncodeWebP(&buf, pix, 8, size, 4, &WebPOptions{Lossless: true}); err != nil {
+		t.Fatalf("EncodeWebP() failed: %v", err)
+	}
+
+	im, err := DecodeWebP(bytes.NewReader(buf.Bytes()), jpeg.OutColorSpaceRGBA, image.Point{})
+	if err != nil {
+		t.Fatalf("DecodeWebP() failed: %v", err)
+	}
+	if i := im.(*image.RGBA); !bytes.Equal(i.Pix, pix) {
+		t.Errorf("unexpected rgba pixels: %v", i.Pix)
+	}
+
+	// gray input is expanded to rgb
+	var gray bytes.Buffer
+	if err := EncodeWebP(&gray, []uint8{0, 255}, 2, size, 1, nil); err != nil {
+		t.Fatalf("EncodeWebP() failed: %v", err)
+	}
+	// transparency is composed over white background
+	im, err = DecodeWebPWithOptions(bytes.NewReader(buf.Bytes()), jpeg.OutColorSpaceRGB, image.Point{}, nil)
+	if err != nil {
+		t.Fatalf("DecodeWebPWithOptions() failed: %v", err)
+	}
+	if i := im.(*rgb.Image); !bytes.Equal(i.Pix, []uint8{255, 0, 0, 255, 255, 255}) {
+		t.Errorf("unexpected rgb pixels: %v", i.Pix)
+	}
+}